@@ -0,0 +1,695 @@
+// Package catalog records sources, processing runs and outputs in SQL
+//
+// It implements schema.sql over database/sql so the same code runs on the
+// native server (pure-Go SQLite) and on Workers (D1). The KV status record is
+// last-write-wins; the catalog keeps the full history for queries and stats.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//go:embed schema.sql
+var Schema string
+
+// ErrUnknownSource is returned when a run is started for a source that was never recorded
+var ErrUnknownSource = errors.New("catalog: unknown source")
+
+// Run status values, matching processing_runs.status
+const (
+	RunProcessing = "processing"
+	RunComplete   = "complete"
+	RunError      = "error"
+)
+
+// Output file types, matching outputs.file_type
+const (
+	FileSVG       = "svg"
+	FileManifest  = "manifest"
+	FileThumbnail = "thumbnail"
+)
+
+// Source is a tracked source file
+type Source struct {
+	ID          int64     `json:"id"`
+	Key         string    `json:"key"`
+	Bucket      string    `json:"bucket"`
+	SizeBytes   int64     `json:"sizeBytes"`
+	ETag        string    `json:"etag,omitempty"`
+	ContentHash string    `json:"contentHash,omitempty"` // SHA-256 hex
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Version is a retained revision of a source (versions table)
+type Version struct {
+	Number      int
+	ContentHash string
+	ETag        string
+	SizeBytes   int64
+}
+
+// Deck is the listing entry of a deck (decks table)
+type Deck struct {
+	Key         string
+	Status      string
+	Error       string
+	Title       string
+	SlideCount  int
+	ETag        string
+	Thumbnail   string
+	ProcessedAt string // RFC 3339; empty when the update carries no render
+	UpdatedAt   string // RFC 3339
+}
+
+// DeckQuery selects a page of decks
+type DeckQuery struct {
+	Prefix string   // Source key prefix
+	Status []string // Any of these statuses; all when empty
+	Sort   string   // A DeckSorts key; "key" when empty
+	Desc   bool
+	Offset int
+	Limit  int
+}
+
+// DeckSorts maps the accepted deck sort orders to their columns
+var DeckSorts = map[string]string{
+	"key":         "key",
+	"title":       "lower(title)",
+	"processedAt": "processed_at",
+	"updatedAt":   "updated_at",
+	"slideCount":  "slide_count",
+	"status":      "status",
+}
+
+// TagCount is a tag and the number of live sources carrying it
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// RunResult is the outcome of a processing run
+type RunResult struct {
+	Status     string
+	SlideCount int
+	Title      string
+	Error      string
+	Duration   time.Duration
+}
+
+// Run is one processing attempt of a source
+type Run struct {
+	ID          int64      `json:"id"`
+	Status      string     `json:"status"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	DurationMs  int64      `json:"durationMs"`
+	Error       string     `json:"error,omitempty"`
+	SlideCount  int        `json:"slideCount"`
+	Title       string     `json:"title,omitempty"`
+	WorkerID    string     `json:"workerId,omitempty"`
+}
+
+// Output is a file produced by a run
+type Output struct {
+	Key         string `json:"key"`
+	FileType    string `json:"fileType"`
+	SlideNumber int    `json:"slideNumber,omitempty"` // 0 for the manifest
+	SizeBytes   int64  `json:"sizeBytes"`
+}
+
+// SourceStatus is the latest run of a source (v_source_status)
+type SourceStatus struct {
+	Key           string     `json:"key"`
+	SizeBytes     int64      `json:"sizeBytes"`
+	SourceUpdated *time.Time `json:"sourceUpdated,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	SlideCount    int        `json:"slideCount"`
+	Title         string     `json:"title,omitempty"`
+	LastProcessed *time.Time `json:"lastProcessed,omitempty"`
+	DurationMs    int64      `json:"durationMs"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// DailyStats aggregates processing runs per day (v_processing_stats)
+type DailyStats struct {
+	Date          string  `json:"date"`
+	TotalRuns     int     `json:"totalRuns"`
+	Successful    int     `json:"successful"`
+	Failed        int     `json:"failed"`
+	AvgDurationMs float64 `json:"avgDurationMs"`
+	TotalSlides   int     `json:"totalSlides"`
+}
+
+// Catalog is the processing history store
+type Catalog interface {
+	// RecordSource inserts or updates a source and clears any soft delete
+	RecordSource(ctx context.Context, src Source) (int64, error)
+
+	// DeleteSource soft-deletes a source; its history is kept
+	DeleteSource(ctx context.Context, key string) error
+
+	// RecordVersion records a retained revision of a recorded source; duplicates are ignored
+	RecordVersion(ctx context.Context, key string, v Version) error
+
+	// AddVersion records v under the next free number above both the recorded
+	// versions and after, and returns that number. The insert is one statement,
+	// so concurrent writers never share a number.
+	AddVersion(ctx context.Context, key string, v Version, after int) (int, error)
+
+	// SetTags replaces the tags of a recorded source
+	SetTags(ctx context.Context, key string, tags []string) error
+
+	// Tags returns every tag on a live source with its source count, by name
+	Tags(ctx context.Context) ([]TagCount, error)
+
+	// IndexSearch replaces the search terms and ranking document of a recorded source
+	IndexSearch(ctx context.Context, key string, terms []string, doc []byte) error
+
+	// Search returns the ranking documents of live sources that match every
+	// term by prefix and, if set, carry tag
+	Search(ctx context.Context, terms []string, tag string) ([][]byte, error)
+
+	// UpdateDeck upserts the listing entry of a deck in one statement. When
+	// d.ProcessedAt is empty only the status, error and update time change.
+	UpdateDeck(ctx context.Context, d Deck) error
+
+	// DeleteDeck removes a deck from the listing
+	DeleteDeck(ctx context.Context, key string) error
+
+	// Deck returns the listing entry of key, or nil if it isn't listed
+	Deck(ctx context.Context, key string) (*Deck, error)
+
+	// Decks returns one page of decks and the number matching across all pages
+	Decks(ctx context.Context, q DeckQuery) ([]Deck, int, error)
+
+	// StartRun opens a processing run for a recorded source
+	StartRun(ctx context.Context, key, workerID string) (int64, error)
+
+	// FinishRun records the outcome of a run
+	FinishRun(ctx context.Context, runID int64, result RunResult) error
+
+	// RecordOutputs records the files written by a run
+	RecordOutputs(ctx context.Context, runID int64, outputs []Output) error
+
+	// Status returns the latest run of a source, or nil if it isn't tracked
+	Status(ctx context.Context, key string) (*SourceStatus, error)
+
+	// Runs returns the most recent runs of a source, newest first
+	Runs(ctx context.Context, key string, limit int) ([]Run, error)
+
+	// Stats returns per-day processing stats for the most recent days
+	Stats(ctx context.Context, days int) ([]DailyStats, error)
+
+	// NeedsProcessing returns sources changed since their last successful run
+	NeedsProcessing(ctx context.Context) ([]string, error)
+
+	Close() error
+}
+
+// SQLCatalog implements Catalog over any SQLite-compatible database/sql driver
+type SQLCatalog struct {
+	db *sql.DB
+}
+
+// New wraps an open database; call Migrate to create the schema
+func New(db *sql.DB) *SQLCatalog {
+	return &SQLCatalog{db: db}
+}
+
+// Migrate applies the embedded schema; every statement is idempotent
+// Statements are executed one at a time because D1 rejects multi-statement queries.
+func (c *SQLCatalog) Migrate(ctx context.Context) error {
+	for _, stmt := range strings.Split(Schema, ";\n") {
+		if isBlankSQL(stmt) {
+			continue
+		}
+		if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("catalog: migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *SQLCatalog) RecordSource(ctx context.Context, src Source) (int64, error) {
+	if src.Bucket == "" {
+		src.Bucket = "input"
+	}
+
+	// updated_at only moves when the content changes, so v_needs_processing
+	// isn't tripped by duplicate notifications for the same object
+	var id int64
+	err := c.db.QueryRowContext(ctx, `
+		INSERT INTO sources (key, bucket, size_bytes, etag, content_hash)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			bucket = excluded.bucket,
+			size_bytes = excluded.size_bytes,
+			etag = excluded.etag,
+			updated_at = CASE WHEN sources.content_hash IS excluded.content_hash AND sources.deleted_at IS NULL
+				THEN sources.updated_at ELSE CURRENT_TIMESTAMP END,
+			content_hash = excluded.content_hash,
+			deleted_at = NULL
+		RETURNING id`,
+		src.Key, src.Bucket, src.SizeBytes, src.ETag, src.ContentHash,
+	).Scan(&id)
+	return id, err
+}
+
+func (c *SQLCatalog) DeleteSource(ctx context.Context, key string) error {
+	_, err := c.db.ExecContext(ctx,
+		`UPDATE sources SET deleted_at = CURRENT_TIMESTAMP WHERE key = ? AND deleted_at IS NULL`, key)
+	return err
+}
+
+func (c *SQLCatalog) RecordVersion(ctx context.Context, key string, v Version) error {
+	_, err := c.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO versions (source_id, version_number, content_hash, etag, size_bytes)
+		SELECT id, ?, ?, ?, ? FROM sources WHERE key = ?`,
+		v.Number, v.ContentHash, nullString(v.ETag), v.SizeBytes, key,
+	)
+	return err
+}
+
+func (c *SQLCatalog) AddVersion(ctx context.Context, key string, v Version, after int) (int, error) {
+	var number int
+	err := c.db.QueryRowContext(ctx, `
+		INSERT INTO versions (source_id, version_number, content_hash, etag, size_bytes)
+		SELECT id, MAX(COALESCE((SELECT MAX(version_number) FROM versions WHERE source_id = sources.id), 0), ?) + 1, ?, ?, ?
+		FROM sources WHERE key = ?
+		RETURNING version_number`,
+		after, v.ContentHash, nullString(v.ETag), v.SizeBytes, key,
+	).Scan(&number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUnknownSource
+	}
+	return number, err
+}
+
+func (c *SQLCatalog) SetTags(ctx context.Context, key string, tags []string) error {
+	_, err := c.db.ExecContext(ctx, `
+		DELETE FROM source_tags WHERE source_id = (SELECT id FROM sources WHERE key = ?)`, key)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := c.db.ExecContext(ctx, `INSERT OR IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+			return err
+		}
+		_, err := c.db.ExecContext(ctx, `
+			INSERT OR IGNORE INTO source_tags (source_id, tag_id)
+			SELECT s.id, t.id FROM sources s, tags t WHERE s.key = ? AND t.name = ?`, key, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SQLCatalog) Tags(ctx context.Context) ([]TagCount, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT t.name, COUNT(*) FROM tags t
+		JOIN source_tags st ON st.tag_id = t.id
+		JOIN sources s ON s.id = st.source_id
+		WHERE s.deleted_at IS NULL
+		GROUP BY t.name ORDER BY t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []TagCount
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+	return tags, rows.Err()
+}
+
+func (c *SQLCatalog) IndexSearch(ctx context.Context, key string, terms []string, doc []byte) error {
+	_, err := c.db.ExecContext(ctx, `
+		DELETE FROM search_terms WHERE source_id = (SELECT id FROM sources WHERE key = ?)`, key)
+	if err != nil {
+		return err
+	}
+	// One statement for every term: D1 caps bound parameters per query
+	list, err := json.Marshal(terms)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO search_terms (source_id, term)
+		SELECT s.id, j.value FROM sources s, json_each(?) j WHERE s.key = ?`, string(list), key)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.ExecContext(ctx, `
+		INSERT INTO search_docs (source_id, doc)
+		SELECT id, ? FROM sources WHERE key = ?
+		ON CONFLICT(source_id) DO UPDATE SET doc = excluded.doc`, string(doc), key)
+	return err
+}
+
+// likeEscaper escapes LIKE wildcards so a term only matches as a literal prefix
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (c *SQLCatalog) Search(ctx context.Context, terms []string, tag string) ([][]byte, error) {
+	query := `
+		SELECT d.doc FROM search_docs d JOIN sources s ON s.id = d.source_id
+		WHERE s.deleted_at IS NULL`
+	var args []any
+	for _, term := range terms {
+		query += `
+		AND EXISTS (SELECT 1 FROM search_terms t WHERE t.source_id = d.source_id AND t.term LIKE ? ESCAPE '\')`
+		args = append(args, likeEscaper.Replace(term)+"%")
+	}
+	if tag != "" {
+		query += `
+		AND EXISTS (SELECT 1 FROM source_tags st JOIN tags g ON g.id = st.tag_id WHERE st.source_id = d.source_id AND g.name = ?)`
+		args = append(args, tag)
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs [][]byte
+	for rows.Next() {
+		var doc string
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, []byte(doc))
+	}
+	return docs, rows.Err()
+}
+
+func (c *SQLCatalog) UpdateDeck(ctx context.Context, d Deck) error {
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO decks (key, status, error, title, slide_count, etag, thumbnail, processed_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			status = excluded.status,
+			error = excluded.error,
+			updated_at = excluded.updated_at,
+			title = CASE WHEN excluded.processed_at IS NULL THEN decks.title ELSE excluded.title END,
+			slide_count = CASE WHEN excluded.processed_at IS NULL THEN decks.slide_count ELSE excluded.slide_count END,
+			etag = CASE WHEN excluded.processed_at IS NULL THEN decks.etag ELSE excluded.etag END,
+			thumbnail = CASE WHEN excluded.processed_at IS NULL THEN decks.thumbnail ELSE excluded.thumbnail END,
+			processed_at = COALESCE(excluded.processed_at, decks.processed_at)`,
+		d.Key, d.Status, nullString(d.Error), nullString(d.Title), d.SlideCount,
+		nullString(d.ETag), nullString(d.Thumbnail), nullString(d.ProcessedAt), d.UpdatedAt,
+	)
+	return err
+}
+
+func (c *SQLCatalog) DeleteDeck(ctx context.Context, key string) error {
+	_, err := c.db.ExecContext(ctx, `DELETE FROM decks WHERE key = ?`, key)
+	return err
+}
+
+// deckColumns are selected in the field order of scanDeck
+const deckColumns = `key, status, COALESCE(error, ''), COALESCE(title, ''), slide_count,
+	COALESCE(etag, ''), COALESCE(thumbnail, ''), COALESCE(processed_at, ''), updated_at`
+
+func scanDeck(row interface{ Scan(...any) error }) (Deck, error) {
+	var d Deck
+	err := row.Scan(&d.Key, &d.Status, &d.Error, &d.Title, &d.SlideCount,
+		&d.ETag, &d.Thumbnail, &d.ProcessedAt, &d.UpdatedAt)
+	return d, err
+}
+
+func (c *SQLCatalog) Deck(ctx context.Context, key string) (*Deck, error) {
+	d, err := scanDeck(c.db.QueryRowContext(ctx, `SELECT `+deckColumns+` FROM decks WHERE key = ?`, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (c *SQLCatalog) Decks(ctx context.Context, q DeckQuery) ([]Deck, int, error) {
+	where := ` WHERE substr(key, 1, length(?)) = ?`
+	args := []any{q.Prefix, q.Prefix}
+	if len(q.Status) > 0 {
+		where += ` AND status IN (?` + strings.Repeat(`, ?`, len(q.Status)-1) + `)`
+		for _, s := range q.Status {
+			args = append(args, s)
+		}
+	}
+
+	var total int
+	if err := c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM decks`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := DeckSorts[q.Sort]
+	if !ok {
+		column = DeckSorts["key"]
+	}
+	order := " ASC"
+	if q.Desc {
+		order = " DESC"
+	}
+	// Ties break by key so pages are stable
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT `+deckColumns+` FROM decks`+where+` ORDER BY `+column+order+`, key`+order+` LIMIT ? OFFSET ?`,
+		append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	decks := make([]Deck, 0)
+	for rows.Next() {
+		d, err := scanDeck(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		decks = append(decks, d)
+	}
+	return decks, total, rows.Err()
+}
+
+func (c *SQLCatalog) StartRun(ctx context.Context, key, workerID string) (int64, error) {
+	var id int64
+	err := c.db.QueryRowContext(ctx, `
+		INSERT INTO processing_runs (source_id, status, started_at, worker_id)
+		SELECT id, ?, CURRENT_TIMESTAMP, ? FROM sources WHERE key = ?
+		RETURNING id`,
+		RunProcessing, workerID, key,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUnknownSource
+	}
+	return id, err
+}
+
+func (c *SQLCatalog) FinishRun(ctx context.Context, runID int64, result RunResult) error {
+	_, err := c.db.ExecContext(ctx, `
+		UPDATE processing_runs SET
+			status = ?, completed_at = CURRENT_TIMESTAMP, duration_ms = ?,
+			error_message = ?, slide_count = ?, title = ?
+		WHERE id = ?`,
+		result.Status, result.Duration.Milliseconds(),
+		nullString(result.Error), result.SlideCount, nullString(result.Title), runID,
+	)
+	return err
+}
+
+func (c *SQLCatalog) RecordOutputs(ctx context.Context, runID int64, outputs []Output) error {
+	for _, out := range outputs {
+		var slide any
+		if out.SlideNumber > 0 {
+			slide = out.SlideNumber
+		}
+		_, err := c.db.ExecContext(ctx, `
+			INSERT INTO outputs (run_id, source_id, key, file_type, slide_number, size_bytes)
+			SELECT id, source_id, ?, ?, ?, ? FROM processing_runs WHERE id = ?`,
+			out.Key, out.FileType, slide, out.SizeBytes, runID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SQLCatalog) Status(ctx context.Context, key string) (*SourceStatus, error) {
+	var s SourceStatus
+	var status, title, errMsg sql.NullString
+	var size, slides, duration sql.NullInt64
+	err := c.db.QueryRowContext(ctx, `
+		SELECT key, size_bytes, source_updated, status, slide_count, title,
+			last_processed, duration_ms, error_message
+		FROM v_source_status WHERE key = ?`, key,
+	).Scan(&s.Key, &size, sqlTime{&s.SourceUpdated}, &status, &slides, &title,
+		sqlTime{&s.LastProcessed}, &duration, &errMsg)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.SizeBytes = size.Int64
+	s.Status = status.String
+	s.SlideCount = int(slides.Int64)
+	s.Title = title.String
+	s.DurationMs = duration.Int64
+	s.Error = errMsg.String
+	return &s, nil
+}
+
+func (c *SQLCatalog) Runs(ctx context.Context, key string, limit int) ([]Run, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT r.id, r.status, r.started_at, r.completed_at, r.duration_ms,
+			r.error_message, r.slide_count, r.title, r.worker_id
+		FROM processing_runs r JOIN sources s ON s.id = r.source_id
+		WHERE s.key = ?
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT ?`, key, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]Run, 0)
+	for rows.Next() {
+		var r Run
+		var errMsg, title, worker sql.NullString
+		var duration, slides sql.NullInt64
+		err := rows.Scan(&r.ID, &r.Status, sqlTime{&r.StartedAt}, sqlTime{&r.CompletedAt},
+			&duration, &errMsg, &slides, &title, &worker)
+		if err != nil {
+			return nil, err
+		}
+		r.DurationMs = duration.Int64
+		r.Error = errMsg.String
+		r.SlideCount = int(slides.Int64)
+		r.Title = title.String
+		r.WorkerID = worker.String
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+func (c *SQLCatalog) Stats(ctx context.Context, days int) ([]DailyStats, error) {
+	if days <= 0 {
+		days = 30
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT date, total_runs, successful, failed, avg_duration_ms, total_slides
+		FROM v_processing_stats LIMIT ?`, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]DailyStats, 0)
+	for rows.Next() {
+		var d DailyStats
+		var date sql.NullString
+		var avg sql.NullFloat64
+		var successful, failed, slides sql.NullInt64
+		if err := rows.Scan(&date, &d.TotalRuns, &successful, &failed, &avg, &slides); err != nil {
+			return nil, err
+		}
+		d.Date = date.String
+		d.Successful = int(successful.Int64)
+		d.Failed = int(failed.Int64)
+		d.AvgDurationMs = avg.Float64
+		d.TotalSlides = int(slides.Int64)
+		stats = append(stats, d)
+	}
+	return stats, rows.Err()
+}
+
+func (c *SQLCatalog) NeedsProcessing(ctx context.Context) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT key FROM v_needs_processing ORDER BY key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c *SQLCatalog) Close() error {
+	return c.db.Close()
+}
+
+// sqlTime scans a nullable SQLite timestamp into a *time.Time
+// Drivers return TIMESTAMP columns either as time.Time or as
+// CURRENT_TIMESTAMP text ("2006-01-02 15:04:05").
+type sqlTime struct {
+	t **time.Time
+}
+
+func (s sqlTime) Scan(v any) error {
+	switch v := v.(type) {
+	case nil:
+		*s.t = nil
+		return nil
+	case time.Time:
+		t := v.UTC()
+		*s.t = &t
+		return nil
+	case []byte:
+		return s.Scan(string(v))
+	case string:
+		for _, layout := range []string{time.DateTime, time.RFC3339Nano} {
+			if t, err := time.Parse(layout, v); err == nil {
+				*s.t = &t
+				return nil
+			}
+		}
+		return fmt.Errorf("catalog: invalid timestamp %q", v)
+	}
+	return fmt.Errorf("catalog: unsupported timestamp type %T", v)
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// isBlankSQL reports whether a schema chunk holds only whitespace and comments
+func isBlankSQL(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,299 @@
+//go:build !cloudflare
+
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestCatalog(t *testing.T) *SQLCatalog {
+	t.Helper()
+	c, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCatalog_RunLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c := openTestCatalog(t)
+
+	if _, err := c.RecordSource(ctx, Source{Key: "a.dsh", SizeBytes: 10, ETag: "e1", ContentHash: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := c.NeedsProcessing(ctx); len(pending) != 1 || pending[0] != "a.dsh" {
+		t.Fatalf("pending = %v", pending)
+	}
+
+	runID, err := c.StartRun(ctx, "a.dsh", "host-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.FinishRun(ctx, runID, RunResult{Status: RunComplete, SlideCount: 2, Title: "Hello", Duration: 40 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.RecordOutputs(ctx, runID, []Output{
+		{Key: "a/slide-0001.svg", FileType: FileSVG, SlideNumber: 1, SizeBytes: 100},
+		{Key: "a/slide-0002.svg", FileType: FileSVG, SlideNumber: 2, SizeBytes: 120},
+		{Key: "a/manifest.json", FileType: FileManifest, SizeBytes: 80},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := c.Status(ctx, "a.dsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status == nil || status.Status != RunComplete || status.SlideCount != 2 || status.Title != "Hello" || status.LastProcessed == nil {
+		t.Fatalf("status = %+v", status)
+	}
+
+	runs, err := c.Runs(ctx, "a.dsh", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].WorkerID != "host-1" || runs[0].DurationMs != 40 {
+		t.Fatalf("runs = %+v", runs)
+	}
+
+	var outputs int
+	c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outputs WHERE run_id = ?`, runID).Scan(&outputs)
+	if outputs != 3 {
+		t.Errorf("outputs = %d, want 3", outputs)
+	}
+
+	if pending, _ := c.NeedsProcessing(ctx); len(pending) != 0 {
+		t.Errorf("pending after complete run = %v", pending)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.RecordVersion(ctx, "a.dsh", Version{Number: 1, ContentHash: "h1", ETag: "e1", SizeBytes: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var versions int
+	c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM versions`).Scan(&versions)
+	if versions != 1 {
+		t.Errorf("versions = %d, want 1", versions)
+	}
+
+	if n, err := c.AddVersion(ctx, "a.dsh", Version{ContentHash: "h2"}, 0); err != nil || n != 2 {
+		t.Errorf("AddVersion = %d, %v; want 2", n, err)
+	}
+	if n, _ := c.AddVersion(ctx, "a.dsh", Version{ContentHash: "h3"}, 7); n != 8 {
+		t.Errorf("AddVersion after 7 = %d, want 8", n)
+	}
+	if _, err := c.AddVersion(ctx, "missing.dsh", Version{ContentHash: "h1"}, 0); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("AddVersion of unknown source = %v", err)
+	}
+}
+
+func TestCatalog_StatsAndErrors(t *testing.T) {
+	ctx := context.Background()
+	c := openTestCatalog(t)
+	c.RecordSource(ctx, Source{Key: "a.dsh", ContentHash: "h1"})
+
+	ok, _ := c.StartRun(ctx, "a.dsh", "")
+	c.FinishRun(ctx, ok, RunResult{Status: RunComplete, SlideCount: 3})
+	bad, _ := c.StartRun(ctx, "a.dsh", "")
+	c.FinishRun(ctx, bad, RunResult{Status: RunError, Error: "parse error"})
+
+	status, _ := c.Status(ctx, "a.dsh")
+	if status.Status != RunError || status.Error != "parse error" {
+		t.Errorf("latest status = %+v", status)
+	}
+
+	stats, err := c.Stats(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].TotalRuns != 2 || stats[0].Successful != 1 || stats[0].Failed != 1 || stats[0].TotalSlides != 3 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	if runs, _ := c.Runs(ctx, "a.dsh", 10); len(runs) != 2 || runs[0].ID != bad {
+		t.Errorf("runs should be newest first: %+v", runs)
+	}
+}
+
+func TestCatalog_UnknownAndDeletedSources(t *testing.T) {
+	ctx := context.Background()
+	c := openTestCatalog(t)
+
+	if _, err := c.StartRun(ctx, "missing.dsh", ""); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("StartRun unknown = %v", err)
+	}
+	if status, err := c.Status(ctx, "missing.dsh"); err != nil || status != nil {
+		t.Errorf("Status unknown = %+v, %v", status, err)
+	}
+
+	id, _ := c.RecordSource(ctx, Source{Key: "a.dsh", ContentHash: "h1"})
+	if err := c.DeleteSource(ctx, "a.dsh"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := c.Status(ctx, "a.dsh"); status != nil {
+		t.Errorf("deleted source still reported: %+v", status)
+	}
+
+	// Re-uploading restores the same row
+	again, _ := c.RecordSource(ctx, Source{Key: "a.dsh", ContentHash: "h1"})
+	if again != id {
+		t.Errorf("id = %d, want %d", again, id)
+	}
+	if status, _ := c.Status(ctx, "a.dsh"); status == nil {
+		t.Error("restored source not reported")
+	}
+}
+
+func TestCatalog_MigrateIsIdempotent(t *testing.T) {
+	c := openTestCatalog(t)
+	if err := c.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatalog_SetTags(t *testing.T) {
+	ctx := context.Background()
+	c := openTestCatalog(t)
+	c.RecordSource(ctx, Source{Key: "a.dsh", ContentHash: "h1"})
+
+	if err := c.SetTags(ctx, "a.dsh", []string{"geo", "client"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetTags(ctx, "a.dsh", []string{"geo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT t.name FROM source_tags st JOIN tags t ON t.id = st.tag_id ORDER BY t.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	if len(names) != 1 || names[0] != "geo" {
+		t.Errorf("source tags = %v", names)
+	}
+}
+
+func TestCatalog_Search(t *testing.T) {
+	ctx := context.Background()
+	c := openTestCatalog(t)
+	c.RecordSource(ctx, Source{Key: "a.dsh", ContentHash: "h1"})
+	c.RecordSource(ctx, Source{Key: "b.dsh", ContentHash: "h2"})
+	c.IndexSearch(ctx, "a.dsh", []string{"election", "county", "100%"}, []byte(`"a"`))
+	c.IndexSearch(ctx, "b.dsh", []string{"election", "welcome"}, []byte(`"b"`))
+	c.SetTags(ctx, "a.dsh", []string{"geo", "2024"})
+	c.SetTags(ctx, "b.dsh", []string{"geo"})
+	if tags, err := c.Tags(ctx); err != nil || fmt.Sprint(tags) != "[{2024 1} {geo 2}]" {
+		t.Errorf("Tags = %v, %v", tags, err)
+	}
+
+	search := func(tag string, terms ...string) string {
+		t.Helper()
+		docs, err := c.Search(ctx, terms, tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range docs {
+			got = append(got, string(d))
+		}
+		sort.Strings(got)
+		return strings.Join(got, ",")
+	}
+
+	if got := search("", "elect"); got != `"a","b"` {
+		t.Errorf("prefix search = %s", got)
+	}
+	if got := search("", "elect", "coun"); got != `"a"` {
+		t.Errorf("every term must match: %s", got)
+	}
+	if got := search("2024", "elect"); got != `"a"` {
+		t.Errorf("tag filter = %s", got)
+	}
+	if got := search("", "1_0"); got != "" {
+		t.Errorf("LIKE wildcard in a term matched %s", got)
+	}
+
+	// Re-indexing replaces the terms; deleted sources drop out
+	c.IndexSearch(ctx, "a.dsh", []string{"budget"}, []byte(`"a2"`))
+	if got := search("", "county"); got != "" {
+		t.Errorf("stale term matched %s", got)
+	}
+	c.DeleteSource(ctx, "b.dsh")
+	if got := search("", "elect"); got != "" {
+		t.Errorf("deleted source matched %s", got)
+	}
+	if tags, _ := c.Tags(ctx); fmt.Sprint(tags) != "[{2024 1} {geo 1}]" {
+		t.Errorf("Tags counted a deleted source: %v", tags)
+	}
+}
+
+func TestCatalog_Decks(t *testing.T) {
+	ctx := context.Background()
+	c := openTestCatalog(t)
+
+	c.UpdateDeck(ctx, Deck{Key: "b.dsh", Status: "complete", Title: "Beta", SlideCount: 2, ProcessedAt: "2024-01-02T00:00:00Z", UpdatedAt: "2024-01-02T00:00:00Z"})
+	c.UpdateDeck(ctx, Deck{Key: "team/a.dsh", Status: "complete", Title: "alpha", SlideCount: 5, ProcessedAt: "2024-01-01T00:00:00Z", UpdatedAt: "2024-01-01T00:00:00Z"})
+	c.UpdateDeck(ctx, Deck{Key: "team/c.dsh", Status: "error", Error: "parse", UpdatedAt: "2024-01-03T00:00:00Z"})
+
+	// A status-only update keeps the render fields
+	if err := c.UpdateDeck(ctx, Deck{Key: "b.dsh", Status: "processing", UpdatedAt: "2024-01-04T00:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Deck(ctx, "b.dsh")
+	if err != nil || b == nil || b.Status != "processing" || b.Title != "Beta" || b.SlideCount != 2 || b.ProcessedAt != "2024-01-02T00:00:00Z" {
+		t.Fatalf("b.dsh = %+v, %v", b, err)
+	}
+
+	keys := func(q DeckQuery) (string, int) {
+		t.Helper()
+		q.Limit = max(q.Limit, 10)
+		decks, total, err := c.Decks(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range decks {
+			got = append(got, d.Key)
+		}
+		return strings.Join(got, ","), total
+	}
+	if got, total := keys(DeckQuery{Sort: "title"}); got != "team/c.dsh,team/a.dsh,b.dsh" || total != 3 {
+		t.Errorf("by title = %s (%d)", got, total)
+	}
+	if got, _ := keys(DeckQuery{Sort: "slideCount", Desc: true}); got != "team/a.dsh,b.dsh,team/c.dsh" {
+		t.Errorf("by slide count desc = %s", got)
+	}
+	if got, total := keys(DeckQuery{Prefix: "team/", Status: []string{"error"}}); got != "team/c.dsh" || total != 1 {
+		t.Errorf("prefix and status = %s (%d)", got, total)
+	}
+	if got, total := keys(DeckQuery{Prefix: "TEAM/"}); got != "" || total != 0 {
+		t.Errorf("prefix must match case: %s", got)
+	}
+	if decks, total, _ := c.Decks(ctx, DeckQuery{Limit: 1, Offset: 2}); len(decks) != 1 || decks[0].Key != "team/c.dsh" || total != 3 {
+		t.Errorf("last page = %+v (%d)", decks, total)
+	}
+
+	c.DeleteDeck(ctx, "b.dsh")
+	if d, _ := c.Deck(ctx, "b.dsh"); d != nil {
+		t.Errorf("deleted deck = %+v", d)
+	}
+}
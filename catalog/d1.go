@@ -0,0 +1,19 @@
+//go:build cloudflare
+
+package catalog
+
+import (
+	"database/sql"
+
+	"github.com/syumai/workers/cloudflare/d1"
+)
+
+// OpenD1 opens the D1 database bound as binding
+// The schema is applied out of band with `wrangler d1 execute`, not per request.
+func OpenD1(binding string) (*SQLCatalog, error) {
+	connector, err := d1.OpenConnector(binding)
+	if err != nil {
+		return nil, err
+	}
+	return New(sql.OpenDB(connector)), nil
+}
@@ -1,5 +1,8 @@
 -- DeckFS Schema for D1 (Cloudflare's SQLite) or DuckDB
 -- Tracks files, processing status, and enables queries
+--
+-- Embedded by the catalog package and applied on startup by the native server.
+-- For D1: wrangler d1 execute deckfs --remote --file catalog/schema.sql
 
 -- Source files (.dsh)
 CREATE TABLE IF NOT EXISTS sources (
@@ -14,8 +17,8 @@ CREATE TABLE IF NOT EXISTS sources (
     deleted_at TIMESTAMP                 -- Soft delete
 );
 
-CREATE INDEX idx_sources_key ON sources(key);
-CREATE INDEX idx_sources_updated ON sources(updated_at);
+CREATE INDEX IF NOT EXISTS idx_sources_key ON sources(key);
+CREATE INDEX IF NOT EXISTS idx_sources_updated ON sources(updated_at);
 
 -- Processing runs
 CREATE TABLE IF NOT EXISTS processing_runs (
@@ -32,9 +35,9 @@ CREATE TABLE IF NOT EXISTS processing_runs (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE INDEX idx_runs_source ON processing_runs(source_id);
-CREATE INDEX idx_runs_status ON processing_runs(status);
-CREATE INDEX idx_runs_created ON processing_runs(created_at);
+CREATE INDEX IF NOT EXISTS idx_runs_source ON processing_runs(source_id);
+CREATE INDEX IF NOT EXISTS idx_runs_status ON processing_runs(status);
+CREATE INDEX IF NOT EXISTS idx_runs_created ON processing_runs(created_at);
 
 -- Output files (SVGs, manifests)
 CREATE TABLE IF NOT EXISTS outputs (
@@ -48,9 +51,9 @@ CREATE TABLE IF NOT EXISTS outputs (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE INDEX idx_outputs_run ON outputs(run_id);
-CREATE INDEX idx_outputs_source ON outputs(source_id);
-CREATE INDEX idx_outputs_key ON outputs(key);
+CREATE INDEX IF NOT EXISTS idx_outputs_run ON outputs(run_id);
+CREATE INDEX IF NOT EXISTS idx_outputs_source ON outputs(source_id);
+CREATE INDEX IF NOT EXISTS idx_outputs_key ON outputs(key);
 
 -- File versions (for history/rollback)
 CREATE TABLE IF NOT EXISTS versions (
@@ -64,7 +67,7 @@ CREATE TABLE IF NOT EXISTS versions (
     UNIQUE(source_id, version_number)
 );
 
-CREATE INDEX idx_versions_source ON versions(source_id);
+CREATE INDEX IF NOT EXISTS idx_versions_source ON versions(source_id);
 
 -- Tags for organization
 CREATE TABLE IF NOT EXISTS tags (
@@ -80,6 +83,34 @@ CREATE TABLE IF NOT EXISTS source_tags (
     PRIMARY KEY (source_id, tag_id)
 );
 
+-- Search index: the terms of each source, for prefix lookup, and the
+-- document used to rank hits (processor.SearchDoc as JSON)
+CREATE TABLE IF NOT EXISTS search_terms (
+    source_id INTEGER NOT NULL REFERENCES sources(id),
+    term TEXT NOT NULL,
+    PRIMARY KEY (term, source_id)
+);
+
+CREATE TABLE IF NOT EXISTS search_docs (
+    source_id INTEGER PRIMARY KEY REFERENCES sources(id),
+    doc TEXT NOT NULL
+);
+
+-- Deck listing: one row per deck, updated on every status change
+CREATE TABLE IF NOT EXISTS decks (
+    key TEXT PRIMARY KEY,                -- Source key
+    status TEXT NOT NULL,
+    error TEXT,
+    title TEXT,
+    slide_count INTEGER NOT NULL DEFAULT 0,
+    etag TEXT,                           -- Source version of the last successful render
+    thumbnail TEXT,
+    processed_at TEXT,                   -- RFC 3339, last successful render
+    updated_at TEXT NOT NULL             -- RFC 3339
+);
+
+CREATE INDEX IF NOT EXISTS idx_decks_status ON decks(status);
+
 -- Watch patterns (which paths to monitor)
 CREATE TABLE IF NOT EXISTS watch_patterns (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -108,7 +139,7 @@ FROM sources s
 LEFT JOIN processing_runs pr ON pr.id = (
     SELECT id FROM processing_runs 
     WHERE source_id = s.id 
-    ORDER BY created_at DESC 
+    ORDER BY created_at DESC, id DESC 
     LIMIT 1
 )
 WHERE s.deleted_at IS NULL;
@@ -124,7 +155,7 @@ FROM sources s
 LEFT JOIN processing_runs pr ON pr.id = (
     SELECT id FROM processing_runs 
     WHERE source_id = s.id AND status = 'complete'
-    ORDER BY created_at DESC 
+    ORDER BY created_at DESC, id DESC 
     LIMIT 1
 )
 WHERE s.deleted_at IS NULL
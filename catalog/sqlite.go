@@ -0,0 +1,32 @@
+//go:build !cloudflare
+
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // Pure-Go driver, no cgo
+)
+
+// OpenSQLite opens (creating if needed) a SQLite catalog file and applies the schema
+func OpenSQLite(ctx context.Context, path string) (*SQLCatalog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// WAL lets status queries run while a render is being recorded
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(db)
+	if err := c.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return c, nil
+}
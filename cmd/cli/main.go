@@ -10,7 +10,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/deckdiff"
+	"github.com/joeblew999/deckfs/pkg/fonts"
 	"github.com/joeblew999/deckfs/pkg/pipeline"
 )
 
@@ -25,6 +29,10 @@ func main() {
 	switch cmd {
 	case "process":
 		doProcess()
+	case "diff":
+		doDiff()
+	case "fonts":
+		doFonts()
 	case "version":
 		fmt.Println("deckfs v0.1.0 (native)")
 	case "help":
@@ -41,6 +49,11 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "Commands:")
 	fmt.Fprintln(os.Stderr, "  process [file]  Process decksh file (or stdin if no file)")
 	fmt.Fprintln(os.Stderr, "                  When file is provided, includes are resolved relative to it")
+	fmt.Fprintln(os.Stderr, "  diff a b [dir]  Compare two decksh files slide by slide (JSON report)")
+	fmt.Fprintln(os.Stderr, "                  With dir, writes a side-by-side SVG for each changed slide")
+	fmt.Fprintln(os.Stderr, "                  Exits 1 when the decks differ, 2 on error")
+	fmt.Fprintln(os.Stderr, "  fonts f [dir]   List the fonts a deck uses, where, and whether dir has them")
+	fmt.Fprintln(os.Stderr, "                  dir defaults to $DECKFONTS or .src/deckfonts")
 	fmt.Fprintln(os.Stderr, "  version         Print version")
 	fmt.Fprintln(os.Stderr, "  help            Print this help")
 }
@@ -118,6 +131,145 @@ func doProcess() {
 	json.NewEncoder(os.Stdout).Encode(output)
 }
 
+func doDiff() {
+	if len(os.Args) < 4 {
+		printUsage()
+		os.Exit(2)
+	}
+	fileA, fileB := os.Args[2], os.Args[3]
+
+	a, err := parseFile(fileA)
+	if err != nil {
+		outputError(fmt.Sprintf("%s: %v", fileA, err))
+		os.Exit(2)
+	}
+	b, err := parseFile(fileB)
+	if err != nil {
+		outputError(fmt.Sprintf("%s: %v", fileB, err))
+		os.Exit(2)
+	}
+
+	report := deckdiff.Compare(a, b)
+
+	if len(os.Args) > 4 {
+		if err := writeDiffSVGs(report, fileA, fileB, float64(b.Canvas.Width), float64(b.Canvas.Height), os.Args[4]); err != nil {
+			outputError(err.Error())
+			os.Exit(2)
+		}
+	}
+
+	json.NewEncoder(os.Stdout).Encode(report)
+	if !report.Identical() {
+		os.Exit(1)
+	}
+}
+
+func doFonts() {
+	if len(os.Args) < 3 {
+		printUsage()
+		os.Exit(1)
+	}
+	d, err := parseFile(os.Args[2])
+	if err != nil {
+		outputError(fmt.Sprintf("%s: %v", os.Args[2], err))
+		os.Exit(1)
+	}
+
+	dir := fonts.DefaultDir()
+	if len(os.Args) > 3 {
+		dir = os.Args[3]
+	}
+	found := fonts.Detect(d)
+	fonts.Check(context.Background(), found, fonts.Dir(dir))
+
+	json.NewEncoder(os.Stdout).Encode(map[string]any{
+		"success": true,
+		"fontDir": dir,
+		"fonts":   found,
+		"count":   len(found),
+	})
+}
+
+// parseFile reads a decksh file, expanding imports relative to its directory
+func parseFile(path string) (*deck.Deck, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	resolver := pipeline.NewImportResolver(func(ctx context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, strings.TrimPrefix(p, "/")))
+	}, "")
+	source, err = resolver.Expand(context.Background(), source, filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("import resolution failed: %w", err)
+	}
+	return pipeline.Parse(context.Background(), source)
+}
+
+// writeDiffSVGs renders both decks and writes diff-NNN.svg for every changed slide pair
+func writeDiffSVGs(report *deckdiff.Report, fileA, fileB string, cw, ch float64, outDir string) error {
+	binDir := os.Getenv("DECKFS_BIN_DIR")
+	if binDir == "" {
+		binDir = ".bin/deck"
+	}
+	p, err := pipeline.NewNativePipeline(binDir)
+	if err != nil {
+		return fmt.Errorf("failed to initialize pipeline: %w", err)
+	}
+
+	render := func(file string) ([][]byte, error) {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		result, err := p.ProcessWithWorkDir(context.Background(), source, pipeline.FormatSVG, filepath.Dir(absPath))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return result.Slides, nil
+	}
+	slidesA, err := render(fileA)
+	if err != nil {
+		return err
+	}
+	slidesB, err := render(fileB)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	for i, diff := range report.Slides {
+		if diff.Change == deckdiff.Unchanged {
+			continue
+		}
+		var before, after []byte
+		if diff.Before > 0 && diff.Before <= len(slidesA) {
+			before = slidesA[diff.Before-1]
+		}
+		if diff.After > 0 && diff.After <= len(slidesB) {
+			after = slidesB[diff.After-1]
+		}
+
+		f, err := os.Create(filepath.Join(outDir, fmt.Sprintf("diff-%03d.svg", i+1)))
+		if err != nil {
+			return err
+		}
+		deckdiff.SideBySide(f, diff, before, after, cw, ch)
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func outputError(msg string) {
 	output := map[string]any{
 		"success": false,
@@ -5,16 +5,20 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"io"
+	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
+	"syscall/js"
 	"time"
 
+	"github.com/joeblew999/deckfs/catalog"
 	"github.com/joeblew999/deckfs/handler"
-	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/pkg/fonts"
+	"github.com/joeblew999/deckfs/processor"
 	"github.com/joeblew999/deckfs/runtime"
 	"github.com/syumai/workers"
+	"github.com/syumai/workers/cloudflare"
+	"github.com/syumai/workers/cloudflare/fetch"
 	"github.com/syumai/workers/cloudflare/queues"
 )
 
@@ -35,130 +39,191 @@ func main() {
 func initRuntime() {
 	inputStorage, _ := runtime.NewR2Storage("DECKFS_INPUT")
 	outputStorage, _ := runtime.NewR2Storage("DECKFS_OUTPUT")
+	fontStorage, _ := runtime.NewR2Storage("DECKFS_FONTS")
 	kvStore, _ := runtime.NewCloudflareKV("DECKFS_STATUS")
 
+	// Workers have no raw sockets; all outbound HTTP goes through fetch
+	client := fetch.NewClient().HTTPClient(fetch.RedirectModeFollow)
+
+	// Webhooks deliver through waitUntil, so a slow receiver holds up neither the
+	// upload response nor the queue batch; waitUntil work gets 30s after that
+	webhooks := runtime.NewWebhookPublisher(kvStore, client).
+		WithRetry(3, 250*time.Millisecond).
+		WithTimeout(5 * time.Second).
+		WithDispatch(cloudflare.WaitUntil)
+	publishers := runtime.MultiPublisher{webhooks}
+
+	// Publish processing events over HTTP when a NATS gateway is configured,
+	// through waitUntil like webhooks
+	if natsURL := cloudflare.Getenv("NATS_PUBLISH_URL"); natsURL != "" {
+		publishers = append(publishers, runtime.NewHTTPPublisher(natsURL, client).
+			WithToken(cloudflare.Getenv("NATS_PUBLISH_TOKEN")).
+			WithTimeout(5*time.Second).
+			WithDispatch(cloudflare.WaitUntil))
+	}
+
+	// Processing history goes to D1 when the database is bound
+	var catalogDB catalog.Catalog
+	if db, err := catalog.OpenD1("DECKFS_DB"); err == nil {
+		catalogDB = db
+	}
+
 	runtime.SetRuntime(&runtime.Runtime{
 		InputStorage:  inputStorage,
 		OutputStorage: outputStorage,
+		FontStorage:   fontStorage,
 		KV:            kvStore,
+		Publisher:     publishers,
+		Webhooks:      webhooks,
+		Catalog:       catalogDB,
 	})
 
-	// Initialize pipeline
-	pipeline := runtime.NewWASMPipeline()
-	runtime.SetPipeline(pipeline)
-}
+	// A library change queues one message per dependent deck on the queue the
+	// Worker consumes, so no single invocation renders them all
+	proc := processor.New()
+	if producer, err := queues.NewProducer("DECKFS_QUEUE"); err == nil {
+		proc.Queue = cloudflareQueue{producer}
+	}
+	handler.Processor = proc
 
-// consumeQueue handles R2 event notifications from the queue
-func consumeQueue(batch *queues.MessageBatch) error {
-	for _, msg := range batch.Messages {
-		body, err := msg.BytesBody()
-		if err != nil {
-			msg.Retry()
-			continue
-		}
+	// Width of the stored thumbnails /thumb serves; the Worker build leaves out
+	// the rasterizer, so they come from a native server sharing the bucket
+	if width, err := strconv.Atoi(cloudflare.Getenv("THUMBNAIL_WIDTH")); err == nil {
+		processor.ThumbnailWidth = width
+	}
 
-		var event struct {
-			Action string `json:"action"`
-			Object struct {
-				Key string `json:"key"`
-			} `json:"object"`
-		}
-		if err := json.Unmarshal(body, &event); err != nil {
-			msg.Retry()
-			continue
-		}
+	// Fonts are cached in R2 and fetched from Google Fonts on a miss
+	fontManager := fonts.NewManager(runtime.Fonts(), fonts.NewGoogleFonts(client))
+	handler.Fonts = fontManager
 
-		if !strings.HasSuffix(event.Object.Key, ".dsh") {
-			msg.Ack()
-			continue
+	// FONT_MAP overrides the SVG font stacks, as -fontmap does natively; an
+	// invalid map keeps the defaults
+	var fontMap fonts.FontMap
+	if m, err := fonts.ParseFontMap([]byte(cloudflare.Getenv("FONT_MAP"))); err == nil {
+		fontMap = m
+	}
+	fontManager.FontMap = fontMap
+
+	// Uploads and admin need an API key unless AUTH_ANONYMOUS_SCOPES says
+	// otherwise; an invalid list keeps the default. AUTH_ADMIN_TOKEN and
+	// AUTH_SIGNING_SECRET are secrets (wrangler secret put).
+	if scopes := cloudflare.Getenv("AUTH_ANONYMOUS_SCOPES"); scopes != "" {
+		if parsed, err := handler.ParseScopes(scopes); err == nil {
+			handler.AnonymousScopes = parsed
 		}
+	}
+	handler.AdminToken = cloudflare.Getenv("AUTH_ADMIN_TOKEN")
+	handler.SigningSecret = []byte(cloudflare.Getenv("AUTH_SIGNING_SECRET"))
+
+	// Request and render limits; unset or invalid values keep the defaults.
+	// Workers enforce their own CPU and memory limits, so there are no rlimits.
+	limits := runtime.DefaultLimits
+	maxBody := int(handler.MaxBodyBytes)
+	envInt("MAX_BODY_BYTES", &maxBody)
+	envInt("MAX_SOURCE_BYTES", &limits.MaxSourceBytes)
+	envInt("MAX_SLIDES", &limits.MaxSlides)
+	envInt("MAX_CONCURRENT_RENDERS", &limits.MaxConcurrent)
+	envInt("MAX_QUEUED_RENDERS", &limits.MaxQueued)
+	envDuration("RENDER_TIMEOUT", &limits.RenderTimeout)
+	envDuration("RENDER_QUEUE_TIMEOUT", &limits.QueueTimeout)
+	handler.MaxBodyBytes = int64(maxBody)
+
+	// Render limits share buckets across isolates through KV, approximately:
+	// KV is eventually consistent. Read limits stay in each isolate's memory
+	// rather than costing KV operations on every request. Cloudflare puts the
+	// client address in CF-Connecting-IP.
+	handler.RateLimiter = runtime.NewKVRateLimiter(kvStore)
+	handler.ReadRateLimiter = runtime.NewMemoryRateLimiter()
+	handler.ClientIPHeader = "CF-Connecting-IP"
+	envRate("RATE_LIMIT_RENDER", &handler.RenderRate)
+	envRate("RATE_LIMIT_READ", &handler.ReadRate)
 
-		key := event.Object.Key
+	// Initialize pipeline
+	pipeline := runtime.NewWASMPipeline().WithFontMap(fontMap)
+	runtime.SetPipeline(runtime.WithLimits(pipeline, limits))
+}
 
-		// Update status: processing
-		setStatus(key, "processing", "")
+// envInt sets *n from a non-negative integer variable, if it holds one
+func envInt(name string, n *int) {
+	if v, err := strconv.Atoi(cloudflare.Getenv(name)); err == nil && v >= 0 {
+		*n = v
+	}
+}
 
-		// Get source from R2
-		reader, err := runtime.Input().Get(nil, key)
-		if err != nil {
-			setStatus(key, "error", "failed to read source")
-			msg.Retry()
-			continue
-		}
-		source, _ := io.ReadAll(reader)
-		reader.Close()
-
-		// Check if source has imports and expand them
-		processSource := source
-		if pipeline.HasImports(source) {
-			// Create import resolver with R2 input storage
-			resolver := pipeline.NewImportResolver(
-				pipeline.StorageLoader(runtime.Input()),
-				"", // R2 keys are already absolute-like
-			)
-
-			// Expand imports
-			ctx := context.Background()
-			expanded, err := resolver.Expand(ctx, source, key)
-			if err != nil {
-				setStatus(key, "error", "import resolution failed: "+err.Error())
-				msg.Ack() // Don't retry import errors
-				continue
-			}
-			processSource = expanded
-		}
+// envDuration sets *d from a non-negative duration variable such as "30s", if it holds one
+func envDuration(name string, d *time.Duration) {
+	if v, err := time.ParseDuration(cloudflare.Getenv(name)); err == nil && v >= 0 {
+		*d = v
+	}
+}
 
-		// Process
-		p := pipeline.NewWASMPipeline()
-		result, err := p.Process(context.Background(), processSource, pipeline.FormatSVG)
-		if err != nil {
-			setStatus(key, "error", err.Error())
-			msg.Ack() // Don't retry bad source
-			continue
+// envRate sets *r from a rate variable such as "30/1m,10", if it holds one
+func envRate(name string, r *runtime.Rate) {
+	if v := cloudflare.Getenv(name); v != "" {
+		if rate, err := runtime.ParseRate(v); err == nil {
+			*r = rate
 		}
+	}
+}
 
-		// Store outputs
-		baseName := strings.TrimSuffix(key, ".dsh")
-		for i, slide := range result.Slides {
-			slideKey := baseName + "/slide-" + padInt(i+1, 4) + ".svg"
-			runtime.Output().Put(nil, slideKey, slide, "image/svg+xml")
-		}
+// consumeQueue handles R2 event notifications from the queue
+func consumeQueue(batch *queues.MessageBatch) error {
+	msgs := make([]processor.Message, len(batch.Messages))
+	for i, msg := range batch.Messages {
+		msgs[i] = queueMessage{msg}
+	}
 
-		// Store manifest
-		manifest := map[string]any{
-			"sourceKey":   key,
-			"processedAt": time.Now().UTC().Format(time.RFC3339),
-			"title":       result.Title,
-			"slideCount":  result.SlideCount,
-		}
-		manifestJSON, _ := json.Marshal(manifest)
-		runtime.Output().Put(nil, baseName+"/manifest.json", manifestJSON, "application/json")
+	consumer := processor.NewConsumer(handler.Processor)
+	consumer.ConsumeBatch(context.Background(), msgs)
+	return nil
+}
 
-		// Update status: complete
-		setStatus(key, "complete", "")
+// cloudflareQueue sends processor jobs to the Worker's own queue
+type cloudflareQueue struct {
+	producer *queues.Producer
+}
 
-		msg.Ack()
+func (q cloudflareQueue) Enqueue(ctx context.Context, job processor.Job) error {
+	body, err := processor.JobMessage(job)
+	if err != nil {
+		return err
 	}
-	return nil
+	return q.producer.SendText(string(body))
 }
 
-func padInt(n, width int) string {
-	s := ""
-	for i := 0; i < width; i++ {
-		s = string('0'+(n%10)) + s
-		n /= 10
-	}
-	return s
+// queueMessage adapts queues.Message to processor.Message
+type queueMessage struct {
+	msg *queues.Message
 }
 
-func setStatus(key, status, errMsg string) {
-	data := map[string]any{
-		"status":    status,
-		"updatedAt": time.Now().UTC().Format(time.RFC3339),
-	}
-	if errMsg != "" {
-		data["error"] = errMsg
+func (m queueMessage) ID() string {
+	return m.msg.ID
+}
+
+// Body returns the raw message bytes
+// R2 event notifications arrive as JSON objects rather than byte arrays, so
+// anything that isn't a Uint8Array or string is re-serialized to JSON.
+func (m queueMessage) Body() ([]byte, error) {
+	switch m.msg.Body.Type() {
+	case js.TypeString:
+		return []byte(m.msg.Body.String()), nil
+	case js.TypeObject:
+		if b, err := m.msg.BytesBody(); err == nil {
+			return b, nil
+		}
+		return []byte(js.Global().Get("JSON").Call("stringify", m.msg.Body).String()), nil
 	}
-	jsonData, _ := json.Marshal(data)
-	runtime.KV().Put(nil, "status:"+key, jsonData)
+	return nil, fmt.Errorf("unsupported message body type %s", m.msg.Body.Type())
+}
+
+func (m queueMessage) Attempts() int {
+	return m.msg.Attempts
+}
+
+func (m queueMessage) Ack() {
+	m.msg.Ack()
+}
+
+func (m queueMessage) Retry(delay time.Duration) {
+	m.msg.Retry(queues.WithRetryDelay(delay))
 }
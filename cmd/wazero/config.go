@@ -0,0 +1,506 @@
+//go:build !js
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/joeblew999/deckfs/handler"
+	"github.com/joeblew999/deckfs/pkg/fonts"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/processor"
+	"github.com/joeblew999/deckfs/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// minSecretLen is the shortest admin token or signing secret accepted
+const minSecretLen = 16
+
+// envPrefix starts every environment override, as in DECKFS_STORAGE_OUTPUT_TYPE
+const envPrefix = "DECKFS_"
+
+// Config is the native server's configuration
+// It is built from defaults, then the YAML file named by -config (or
+// DECKFS_CONFIG), then DECKFS_* environment variables, then flags given on the
+// command line, so one binary can run with different backends per environment.
+type Config struct {
+	Addr        string          `yaml:"addr"`
+	BinDir      string          `yaml:"binDir"`
+	DataDir     string          `yaml:"dataDir"`
+	Strict      bool            `yaml:"strict"`      // Exit when the startup readiness checks fail
+	CORSOrigins []string        `yaml:"corsOrigins"` // Empty allows any origin
+	Storage     StorageRoles    `yaml:"storage"`
+	KV          KVConfig        `yaml:"kv"`
+	Publisher   PublisherConfig `yaml:"publisher"`
+	Fonts       FontsConfig     `yaml:"fonts"`
+	Render      RenderConfig    `yaml:"render"`
+	Auth        AuthConfig      `yaml:"auth"`
+	Limits      LimitsConfig    `yaml:"limits"`
+	RateLimit   RateLimitConfig `yaml:"rateLimit"`
+}
+
+// StorageRoles selects a backend for each kind of stored file
+type StorageRoles struct {
+	Input  StorageConfig `yaml:"input"`  // Deck sources
+	Output StorageConfig `yaml:"output"` // Rendered slides, manifests and thumbnails; none disables uploads
+	Fonts  StorageConfig `yaml:"fonts"`  // Font cache
+}
+
+// StorageConfig selects one storage backend
+type StorageConfig struct {
+	Type string `yaml:"type"` // local, r2, memory or none
+	Dir  string `yaml:"dir"`  // local
+
+	// r2: the S3-compatible API, e.g. https://<account>.r2.cloudflarestorage.com
+	Endpoint    string `yaml:"endpoint"`
+	Bucket      string `yaml:"bucket"`
+	AccessKeyID string `yaml:"accessKeyId"`
+	SecretKey   string `yaml:"secretKey"`
+}
+
+// KVConfig selects the KV backend holding status, indexes and webhooks
+type KVConfig struct {
+	Type string `yaml:"type"` // file or memory
+	Path string `yaml:"path"` // file; defaults to <dataDir>/kv.jsonl
+}
+
+// PublisherConfig selects where processing events go
+type PublisherConfig struct {
+	Webhooks  bool   `yaml:"webhooks"`  // Deliver to subscriptions registered with /webhooks
+	NATS      string `yaml:"nats"`      // NATS server URL
+	HTTPURL   string `yaml:"httpUrl"`   // HTTP publish endpoint, as NATS_PUBLISH_URL on Workers
+	HTTPToken string `yaml:"httpToken"` // Bearer token for HTTPURL
+}
+
+// FontsConfig selects where PNG/PDF renders and thumbnails get their fonts
+type FontsConfig struct {
+	Dir     string `yaml:"dir"`     // Local TrueType files; defaults to $DECKFONTS or .src/deckfonts
+	Fetch   bool   `yaml:"fetch"`   // Download missing fonts from Google Fonts into the font cache
+	FontMap string `yaml:"fontMap"` // JSON file of SVG font-family stacks
+}
+
+// RenderConfig controls background rendering and stored thumbnails
+type RenderConfig struct {
+	ThumbWidth int           `yaml:"thumbWidth"` // 0 disables stored thumbnails
+	Watch      time.Duration `yaml:"watch"`      // Poll interval for changed decks; 0 disables
+	Workers    int           `yaml:"workers"`    // Concurrent background renders
+	QueueSize  int           `yaml:"queueSize"`  // Pending background renders before new ones wait
+}
+
+// AuthConfig controls who may call the API
+// API keys themselves live in KV and are managed through /auth/keys.
+type AuthConfig struct {
+	Anonymous     []string `yaml:"anonymous"`     // Scopes granted without credentials
+	AdminToken    string   `yaml:"adminToken"`    // Bearer token with every scope; empty disables it
+	SigningSecret string   `yaml:"signingSecret"` // HMAC key for signed upload URLs; empty disables them
+}
+
+// LimitsConfig bounds requests and renders; 0 leaves a limit off
+type LimitsConfig struct {
+	MaxBodyBytes   int                 `yaml:"maxBodyBytes"`   // Deck source in a request body
+	MaxSourceBytes int                 `yaml:"maxSourceBytes"` // Source after import expansion
+	MaxSlides      int                 `yaml:"maxSlides"`
+	RenderTimeout  time.Duration       `yaml:"renderTimeout"` // Wall-clock time of one render
+	MaxConcurrent  int                 `yaml:"maxConcurrent"` // Renders running at once
+	MaxQueued      int                 `yaml:"maxQueued"`     // Renders waiting before new ones get 429
+	QueueTimeout   time.Duration       `yaml:"queueTimeout"`  // Wait for a slot before 503
+	Process        ProcessLimitsConfig `yaml:"process"`
+}
+
+// ProcessLimitsConfig sets rlimits on decksh and the renderers (Linux only)
+type ProcessLimitsConfig struct {
+	CPUTime  time.Duration `yaml:"cpuTime"`
+	Memory   int           `yaml:"memory"`   // Address space, in bytes
+	FileSize int           `yaml:"fileSize"` // Largest file written, in bytes
+}
+
+// RateLimitConfig throttles each client address, and each API key
+type RateLimitConfig struct {
+	Render         RateConfig `yaml:"render"`         // Render and upload endpoints
+	Read           RateConfig `yaml:"read"`           // Everything else behind authentication
+	ClientIPHeader string     `yaml:"clientIpHeader"` // Set by a trusted proxy, e.g. X-Real-IP; empty uses the connection
+}
+
+// RateConfig is a token bucket: burst requests at once, refilled at limit per period
+type RateConfig struct {
+	Limit  int           `yaml:"limit"` // 0 disables the bucket
+	Period time.Duration `yaml:"period"`
+	Burst  int           `yaml:"burst"` // Defaults to limit
+}
+
+// defaultConfig is the configuration with no file, environment or flags
+func defaultConfig() *Config {
+	return &Config{
+		Addr:    ":8080",
+		BinDir:  ".bin/deck",
+		DataDir: ".data",
+		Storage: StorageRoles{
+			Input:  StorageConfig{Type: "local", Dir: ".src/deckviz"},
+			Output: StorageConfig{Type: "local"},
+			Fonts:  StorageConfig{Type: "local"},
+		},
+		KV:        KVConfig{Type: "file"},
+		Publisher: PublisherConfig{Webhooks: true},
+		Fonts:     FontsConfig{Fetch: true},
+		Render: RenderConfig{
+			ThumbWidth: processor.ThumbnailWidth,
+			Workers:    2,
+			QueueSize:  64,
+		},
+		Auth: AuthConfig{Anonymous: slices.Clone(handler.AnonymousScopes)},
+		Limits: LimitsConfig{
+			MaxBodyBytes:   int(handler.MaxBodyBytes),
+			MaxSourceBytes: runtime.DefaultLimits.MaxSourceBytes,
+			MaxSlides:      runtime.DefaultLimits.MaxSlides,
+			RenderTimeout:  runtime.DefaultLimits.RenderTimeout,
+			MaxConcurrent:  runtime.DefaultLimits.MaxConcurrent,
+			MaxQueued:      runtime.DefaultLimits.MaxQueued,
+			QueueTimeout:   runtime.DefaultLimits.QueueTimeout,
+		},
+		RateLimit: RateLimitConfig{
+			Render: RateConfig(handler.RenderRate),
+			Read:   RateConfig(handler.ReadRate),
+		},
+	}
+}
+
+// loadConfig reads the defaults, the YAML file at path (if any) and the environment
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), envPrefix, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides fields from environment variables named after their YAML
+// path: storage.output.secretKey is DECKFS_STORAGE_OUTPUT_SECRET_KEY
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		env := prefix + envName(name)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, env+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, ok := lookup(env)
+		if !ok {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+	}
+	return nil
+}
+
+// envName converts a YAML key to an environment variable suffix: accessKeyId is ACCESS_KEY_ID
+func envName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(rune(key[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func setField(field reflect.Value, raw string) error {
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case []string:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid setting, each named by its YAML path
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Addr == "" {
+		fail("addr", "required")
+	}
+	if c.BinDir == "" {
+		fail("binDir", "required")
+	}
+	if c.DataDir == "" {
+		fail("dataDir", "required")
+	}
+	for _, origin := range c.CORSOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || u.Path != "") {
+			fail("corsOrigins", "%q is not * or an origin such as https://example.com", origin)
+		}
+	}
+
+	for _, role := range []struct {
+		name    string
+		storage StorageConfig
+		none    bool
+	}{
+		{"storage.input", c.Storage.Input, false},
+		{"storage.output", c.Storage.Output, true},
+		{"storage.fonts", c.Storage.Fonts, true},
+	} {
+		s := role.storage
+		switch s.Type {
+		case "local":
+			// An empty dir is allowed only where a default under dataDir exists
+			if s.Dir == "" && role.name == "storage.input" {
+				fail(role.name+".dir", "required for local storage")
+			}
+		case "r2":
+			if u, err := url.Parse(s.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				fail(role.name+".endpoint", "required for r2 storage, e.g. https://<account>.r2.cloudflarestorage.com")
+			}
+			if s.Bucket == "" {
+				fail(role.name+".bucket", "required for r2 storage")
+			}
+			if s.AccessKeyID == "" || s.SecretKey == "" {
+				fail(role.name, "r2 storage needs accessKeyId and secretKey")
+			}
+		case "memory":
+		case "none":
+			if !role.none {
+				fail(role.name+".type", "none is not allowed here")
+			}
+		default:
+			fail(role.name+".type", "unknown backend %q (want local, r2, memory or none)", s.Type)
+		}
+	}
+
+	switch c.KV.Type {
+	case "file", "memory":
+	default:
+		fail("kv.type", "unknown backend %q (want file or memory)", c.KV.Type)
+	}
+
+	if c.Publisher.NATS != "" {
+		if u, err := url.Parse(c.Publisher.NATS); err != nil || u.Host == "" {
+			fail("publisher.nats", "%q is not a URL such as nats://localhost:4222", c.Publisher.NATS)
+		}
+	}
+	if c.Publisher.HTTPURL != "" {
+		if u, err := url.Parse(c.Publisher.HTTPURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("publisher.httpUrl", "%q is not an http(s) URL", c.Publisher.HTTPURL)
+		}
+	}
+
+	if c.Fonts.FontMap != "" {
+		if _, err := fonts.LoadFontMap(c.Fonts.FontMap); err != nil {
+			fail("fonts.fontMap", "%v", err)
+		}
+	}
+
+	if c.Render.ThumbWidth < 0 {
+		fail("render.thumbWidth", "must not be negative")
+	}
+	if c.Render.Watch < 0 {
+		fail("render.watch", "must not be negative")
+	}
+	if c.Render.Watch > 0 && c.Storage.Input.Type != "local" {
+		fail("render.watch", "needs local input storage to poll")
+	}
+	if c.Render.Workers < 1 {
+		fail("render.workers", "must be at least 1")
+	}
+	if c.Render.QueueSize < 1 {
+		fail("render.queueSize", "must be at least 1")
+	}
+
+	for _, scope := range c.Auth.Anonymous {
+		if _, err := handler.ParseScopes(scope); err != nil {
+			fail("auth.anonymous", "%v", err)
+		}
+	}
+	if c.Auth.AdminToken != "" && len(c.Auth.AdminToken) < minSecretLen {
+		fail("auth.adminToken", "must be at least %d characters", minSecretLen)
+	}
+	if c.Auth.SigningSecret != "" && len(c.Auth.SigningSecret) < minSecretLen {
+		fail("auth.signingSecret", "must be at least %d characters", minSecretLen)
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value int64
+	}{
+		{"limits.maxBodyBytes", int64(c.Limits.MaxBodyBytes)},
+		{"limits.maxSourceBytes", int64(c.Limits.MaxSourceBytes)},
+		{"limits.maxSlides", int64(c.Limits.MaxSlides)},
+		{"limits.renderTimeout", int64(c.Limits.RenderTimeout)},
+		{"limits.maxConcurrent", int64(c.Limits.MaxConcurrent)},
+		{"limits.maxQueued", int64(c.Limits.MaxQueued)},
+		{"limits.queueTimeout", int64(c.Limits.QueueTimeout)},
+		{"limits.process.cpuTime", int64(c.Limits.Process.CPUTime)},
+		{"limits.process.memory", int64(c.Limits.Process.Memory)},
+		{"limits.process.fileSize", int64(c.Limits.Process.FileSize)},
+	} {
+		if limit.value < 0 {
+			fail(limit.name, "must not be negative")
+		}
+	}
+
+	for _, rate := range []struct {
+		name string
+		RateConfig
+	}{
+		{"rateLimit.render", c.RateLimit.Render},
+		{"rateLimit.read", c.RateLimit.Read},
+	} {
+		if rate.Limit < 0 || rate.Burst < 0 {
+			fail(rate.name, "limit and burst must not be negative")
+		}
+		if rate.Limit > 0 && rate.Period <= 0 {
+			fail(rate.name+".period", "must be set when limit is")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// render returns the limits the render pipeline enforces
+func (l LimitsConfig) render() runtime.Limits {
+	return runtime.Limits{
+		MaxSourceBytes: l.MaxSourceBytes,
+		MaxSlides:      l.MaxSlides,
+		RenderTimeout:  l.RenderTimeout,
+		MaxConcurrent:  l.MaxConcurrent,
+		MaxQueued:      l.MaxQueued,
+		QueueTimeout:   l.QueueTimeout,
+	}
+}
+
+// native returns the limits the native pipeline applies to each render
+func (l LimitsConfig) native() pipeline.Limits {
+	return pipeline.Limits{
+		MaxSlides: l.MaxSlides,
+		CPUTime:   l.Process.CPUTime,
+		Memory:    int64(l.Process.Memory),
+		FileSize:  int64(l.Process.FileSize),
+	}
+}
+
+// fontDir returns the local font directory
+func (c *Config) fontDir() string {
+	if c.Fonts.Dir != "" {
+		return c.Fonts.Dir
+	}
+	return fonts.DefaultDir()
+}
+
+// open creates the storage backend; defaultDir is used for local storage without a dir
+// It returns nil for none.
+func (s StorageConfig) open(defaultDir string) (runtime.Storage, error) {
+	switch s.Type {
+	case "local":
+		dir := s.Dir
+		if dir == "" {
+			dir = defaultDir
+		}
+		return runtime.NewLocalFileStorage(dir)
+	case "r2":
+		return runtime.NewR2HTTPStorage(runtime.R2HTTPConfig{
+			Endpoint:    s.Endpoint,
+			BucketName:  s.Bucket,
+			AccessKeyID: s.AccessKeyID,
+			SecretKey:   s.SecretKey,
+		}), nil
+	case "memory":
+		return runtime.NewMemoryStorage(), nil
+	}
+	return nil, nil
+}
+
+// describe summarizes the backend for the startup log, without secrets
+func (s StorageConfig) describe(defaultDir string) string {
+	switch s.Type {
+	case "local":
+		if s.Dir == "" {
+			return "local " + defaultDir
+		}
+		return "local " + s.Dir
+	case "r2":
+		return "r2 " + s.Bucket + " at " + s.Endpoint
+	}
+	return s.Type
+}
+
+// openKV creates the KV backend
+func (c *Config) openKV() (runtime.KVStore, func() error, error) {
+	if c.KV.Type == "memory" {
+		return runtime.NewMemoryKV(), func() error { return nil }, nil
+	}
+	path := c.KV.Path
+	if path == "" {
+		path = filepath.Join(c.DataDir, "kv.jsonl")
+	}
+	kv, err := runtime.NewFileKV(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kv, kv.Close, nil
+}
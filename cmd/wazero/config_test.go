@@ -0,0 +1,102 @@
+//go:build !js
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_FileThenEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deckfs.yaml")
+	err := os.WriteFile(path, []byte(`
+addr: ":9090"
+storage:
+  output:
+    type: r2
+    endpoint: https://acct.r2.cloudflarestorage.com
+    bucket: decks
+    accessKeyId: id
+render:
+  watch: 2s
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DECKFS_STORAGE_OUTPUT_SECRET_KEY", "secret")
+	t.Setenv("DECKFS_RENDER_WORKERS", "4")
+	t.Setenv("DECKFS_CORS_ORIGINS", "https://a.example, https://b.example")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":9090" || cfg.Render.Watch != 2*time.Second || cfg.Storage.Input.Dir != ".src/deckviz" {
+		t.Errorf("file not merged over defaults: %+v", cfg)
+	}
+	if cfg.Storage.Output.SecretKey != "secret" || cfg.Render.Workers != 4 || len(cfg.CORSOrigins) != 2 {
+		t.Errorf("environment not applied: %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestLoadConfig_UnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deckfs.yaml")
+	if err := os.WriteFile(path, []byte("storage:\n  outptu:\n    type: memory\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "outptu") {
+		t.Errorf("err = %v, want the misspelled field named", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Storage.Input.Type = "none"
+	cfg.Storage.Output = StorageConfig{Type: "r2"}
+	cfg.KV.Type = "redis"
+	cfg.Render.Watch = time.Second
+	cfg.CORSOrigins = []string{"example.com"}
+	cfg.Auth.Anonymous = []string{"read", "write"}
+	cfg.Auth.AdminToken = "short"
+	cfg.Limits.RenderTimeout = -time.Second
+	cfg.RateLimit.Read.Period = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	for _, want := range []string{
+		"storage.input.type: none is not allowed here",
+		"storage.output.bucket: required for r2 storage",
+		`kv.type: unknown backend "redis"`,
+		"render.watch: needs local input storage",
+		`corsOrigins: "example.com"`,
+		`auth.anonymous: unknown scope "write"`,
+		"auth.adminToken: must be at least 16 characters",
+		"limits.renderTimeout: must not be negative",
+		"rateLimit.read.period: must be set when limit is",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for key, want := range map[string]string{
+		"addr":        "ADDR",
+		"binDir":      "BIN_DIR",
+		"accessKeyId": "ACCESS_KEY_ID",
+		"httpUrl":     "HTTP_URL",
+	} {
+		if got := envName(key); got != want {
+			t.Errorf("envName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
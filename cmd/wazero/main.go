@@ -5,54 +5,281 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/joeblew999/deckfs/catalog"
 	"github.com/joeblew999/deckfs/handler"
+	"github.com/joeblew999/deckfs/pkg/fonts"
+	"github.com/joeblew999/deckfs/processor"
 	"github.com/joeblew999/deckfs/runtime"
 )
 
 func main() {
+	defaults := defaultConfig()
 	var (
-		addr        = flag.String("addr", ":8080", "Listen address")
-		binDir      = flag.String("bin", ".bin/deck", "Directory containing deck binaries (decksh, svgdeck, etc.)")
-		examplesDir = flag.String("examples", ".src/deckviz", "Directory containing .dsh examples")
+		configPath  = flag.String("config", os.Getenv("DECKFS_CONFIG"), "YAML configuration file; DECKFS_* environment variables and these flags override it")
+		addr        = flag.String("addr", defaults.Addr, "Listen address")
+		binDir      = flag.String("bin", defaults.BinDir, "Directory containing deck binaries (decksh, svgdeck, etc.)")
+		examplesDir = flag.String("examples", defaults.Storage.Input.Dir, "Directory containing .dsh examples (local input storage)")
+		dataDir     = flag.String("data", defaults.DataDir, "Directory for persistent server state (KV status, caches)")
+		natsURL     = flag.String("nats", "", "NATS server URL for processing events (disabled if empty)")
+		watch       = flag.Duration("watch", 0, "Poll the examples directory at this interval and render changed decks (0 disables)")
+		thumbWidth  = flag.Int("thumb-width", defaults.Render.ThumbWidth, "Pixel width of the thumbnails stored with each render (0 disables)")
+		fontFetch   = flag.Bool("font-fetch", defaults.Fonts.Fetch, "Download fonts missing from $DECKFONTS from Google Fonts into <data>/fonts")
+		strict      = flag.Bool("strict", false, "Exit at startup when the readiness checks served on /health fail")
+		fontMapFile = flag.String("fontmap", "", "JSON file of sans/serif/mono font-family stacks for SVG slides (defaults match the Worker)")
 	)
 	flag.Parse()
 
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Flags given on the command line win over the file and environment
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = *addr
+		case "bin":
+			cfg.BinDir = *binDir
+		case "examples":
+			cfg.Storage.Input = StorageConfig{Type: "local", Dir: *examplesDir}
+		case "data":
+			cfg.DataDir = *dataDir
+		case "nats":
+			cfg.Publisher.NATS = *natsURL
+		case "watch":
+			cfg.Render.Watch = *watch
+		case "thumb-width":
+			cfg.Render.ThumbWidth = *thumbWidth
+		case "font-fetch":
+			cfg.Fonts.Fetch = *fontFetch
+		case "strict":
+			cfg.Strict = *strict
+		case "fontmap":
+			cfg.Fonts.FontMap = *fontMapFile
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	processor.ThumbnailWidth = cfg.Render.ThumbWidth
+	handler.CORSOrigins = cfg.CORSOrigins
+	handler.AnonymousScopes, _ = handler.ParseScopes(strings.Join(cfg.Auth.Anonymous, ","))
+	handler.AdminToken = cfg.Auth.AdminToken
+	handler.SigningSecret = []byte(cfg.Auth.SigningSecret)
+	handler.MaxBodyBytes = int64(cfg.Limits.MaxBodyBytes)
+	handler.RateLimiter = runtime.NewMemoryRateLimiter()
+	handler.RenderRate = runtime.Rate(cfg.RateLimit.Render)
+	handler.ReadRate = runtime.Rate(cfg.RateLimit.Read)
+	handler.ClientIPHeader = cfg.RateLimit.ClientIPHeader
+
 	// Initialize runtime pipeline
-	runtimePipe, err := runtime.NewNativePipeline(*binDir)
+	runtimePipe, err := runtime.NewNativePipeline(cfg.BinDir)
 	if err != nil {
 		log.Fatalf("Failed to create runtime pipeline: %v", err)
 	}
-	runtime.SetPipeline(runtimePipe)
+	if err := runtimePipe.SetLimits(cfg.Limits.native()); err != nil {
+		log.Fatalf("limits.process: %v", err)
+	}
+	runtime.SetPipeline(runtime.WithLimits(runtimePipe, cfg.Limits.render()))
 
-	// Initialize local file storage for examples
-	inputStorage, err := runtime.NewLocalFileStorage(*examplesDir)
+	// SVG slides use the same font stacks as the Worker unless a font map overrides them
+	var fontMap fonts.FontMap
+	if cfg.Fonts.FontMap != "" {
+		fontMap, err = fonts.LoadFontMap(cfg.Fonts.FontMap)
+		if err != nil {
+			log.Fatalf("Failed to load font map: %v", err)
+		}
+	}
+	runtimePipe.SetFontMap(fontMap)
+
+	// Fonts come from the font directory first, then Google Fonts, cached in font storage
+	fontsDefaultDir := filepath.Join(cfg.DataDir, "fonts")
+	fontStorage, err := cfg.Storage.Fonts.open(fontsDefaultDir)
+	if err != nil {
+		log.Fatalf("Failed to create font storage: %v", err)
+	}
+	var fontCache fonts.Storage
+	if fontStorage != nil {
+		fontCache = fontStorage
+	}
+	fontSources := []fonts.FontSource{fonts.Dir(cfg.fontDir())}
+	if cfg.Fonts.Fetch {
+		fontSources = append(fontSources, fonts.NewGoogleFonts(&http.Client{Timeout: 30 * time.Second}))
+	}
+	fontManager := fonts.NewManager(fontCache, fontSources...)
+	fontManager.FontMap = fontMap
+	runtimePipe.SetFontProvider(fontManager)
+	processor.ThumbnailFonts = fontManager.Loader(context.Background())
+
+	inputStorage, err := cfg.Storage.Input.open("")
 	if err != nil {
 		log.Fatalf("Failed to create input storage: %v", err)
 	}
+	outputStorage, err := cfg.Storage.Output.open(filepath.Join(cfg.DataDir, "output"))
+	if err != nil {
+		log.Fatalf("Failed to create output storage: %v", err)
+	}
+
+	// File-backed KV by default so status survives restarts
+	kvStore, closeKV, err := cfg.openKV()
+	if err != nil {
+		log.Fatalf("Failed to open KV store: %v", err)
+	}
+	defer closeKV()
+
+	// Record sources, runs and outputs in a local SQLite catalog
+	catalogDB, err := catalog.OpenSQLite(context.Background(), filepath.Join(cfg.DataDir, "catalog.db"))
+	if err != nil {
+		log.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalogDB.Close()
+
+	// Deliver events to registered webhooks in the background
+	var webhooks *runtime.WebhookPublisher
+	var publishers runtime.MultiPublisher
+	if cfg.Publisher.Webhooks {
+		webhooks = runtime.NewWebhookPublisher(kvStore, nil).WithAsync(true)
+		publishers = append(publishers, webhooks)
+	}
+
+	// Publish processing events to NATS if configured
+	if cfg.Publisher.NATS != "" {
+		natsPublisher, err := runtime.NewNATSPublisher(cfg.Publisher.NATS)
+		if err != nil {
+			log.Fatalf("Failed to connect to NATS: %v", err)
+		}
+		defer natsPublisher.Close()
+		publishers = append(publishers, natsPublisher)
+	}
+	if cfg.Publisher.HTTPURL != "" {
+		publishers = append(publishers, runtime.NewHTTPPublisher(cfg.Publisher.HTTPURL, nil).
+			WithToken(cfg.Publisher.HTTPToken).
+			WithAsync(true))
+	}
 
 	// Set runtime with both pipeline and storage
 	runtime.SetRuntime(&runtime.Runtime{
 		InputStorage:  inputStorage,
-		OutputStorage: nil, // wazero does not need output storage
-		KV:            nil, // wazero does not use KV
-		Publisher:     nil, // wazero does not use pub/sub
+		OutputStorage: outputStorage,
+		FontStorage:   fontStorage,
+		KV:            kvStore,
+		Publisher:     publishers,
+		Webhooks:      webhooks,
+		Catalog:       catalogDB,
 	})
 
+	// Render changed decks in the background, like the Cloudflare queue consumer
+	if cfg.Render.Watch > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		proc := processor.New()
+		proc.WorkerID, _ = os.Hostname()
+		queue := processor.NewMemoryQueue(proc.Handle, cfg.Render.QueueSize)
+		proc.Queue = queue // Library edits fan out to dependents through the queue
+		handler.Processor = proc
+		queue.Start(ctx, cfg.Render.Workers)
+		defer queue.Close()
+
+		watcher := processor.NewWatcher(cfg.Storage.Input.Dir, queue, cfg.Render.Watch)
+		go func() {
+			if err := watcher.Run(ctx); err != nil && err != context.Canceled {
+				log.Printf("Watcher stopped: %v", err)
+			}
+		}()
+	}
+
+	// List decks rendered before the deck index existed, without holding a request
+	handler.Processor.ScheduleDeckBackfill(context.Background())
+
+	// Report font availability against what PNG/PDF renders can load
+	handler.Fonts = fontManager
+
 	// Create HTTP server with shared handlers
 	mux := http.NewServeMux()
 	handler.RegisterHandlers(mux)
 
 	formats := runtimePipe.SupportedFormats()
-	log.Printf("Starting server on %s", *addr)
-	log.Printf("Binaries directory: %s", *binDir)
-	log.Printf("Examples directory: %s", *examplesDir)
+	if *configPath != "" {
+		log.Printf("Configuration: %s", *configPath)
+	}
+	log.Printf("Starting server on %s", cfg.Addr)
+	log.Printf("Binaries directory: %s", cfg.BinDir)
+	log.Printf("Data directory: %s", cfg.DataDir)
+	log.Printf("Input storage: %s", cfg.Storage.Input.describe(""))
+	log.Printf("Output storage: %s", cfg.Storage.Output.describe(filepath.Join(cfg.DataDir, "output")))
+	log.Printf("Font storage: %s", cfg.Storage.Fonts.describe(fontsDefaultDir))
+	log.Printf("KV: %s", cfg.KV.Type)
+	log.Printf("Anonymous scopes: %v", handler.AnonymousScopes)
+	log.Printf("Render limits: %d concurrent, %d queued, %s timeout, %d slides",
+		cfg.Limits.MaxConcurrent, cfg.Limits.MaxQueued, cfg.Limits.RenderTimeout, cfg.Limits.MaxSlides)
+	log.Printf("Rate limits: render %s, read %s", handler.RenderRate, handler.ReadRate)
+	if cfg.Publisher.NATS != "" {
+		log.Printf("Publishing events to NATS: %s", cfg.Publisher.NATS)
+	}
+	if cfg.Publisher.HTTPURL != "" {
+		log.Printf("Publishing events to: %s", cfg.Publisher.HTTPURL)
+	}
+	if cfg.Render.Watch > 0 {
+		log.Printf("Watching examples every %s", cfg.Render.Watch)
+	}
 	log.Printf("Supported formats: %v", formats)
 
-	if err := http.ListenAndServe(*addr, mux); err != nil {
+	checkStartup(fontManager, cfg.fontDir(), cfg.Strict)
+
+	if err := http.ListenAndServe(cfg.Addr, mux); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// checkStartup logs the readiness report /health?deep=true serves, after
+// fetching the alias fonts into the cache so a first render doesn't wait on
+// downloads; with strict, a failed check stops the server
+func checkStartup(fontManager *fonts.Manager, fontDir string, strict bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if !dirExists(fontDir) {
+		log.Printf("Font directory %s not found; set fonts.dir or DECKFONTS to the directory holding %s", fontDir, fonts.AliasFiles[fonts.Sans])
+	}
+	for _, alias := range []string{fonts.Sans, fonts.Serif, fonts.Mono} {
+		if _, err := fontManager.Font(ctx, alias, fonts.Regular); err != nil {
+			log.Printf("Font %s (%s): %v", alias, fontManager.Family(alias), err)
+		}
+	}
+
+	report := handler.Health(ctx, true)
+	if report.Pipeline != nil {
+		for _, b := range report.Pipeline.Binaries {
+			switch {
+			case !b.Found:
+				log.Printf("Binary %s: not found at %s", b.Name, b.Path)
+			case b.Version != "":
+				log.Printf("Binary %s: %s", b.Name, b.Version)
+			}
+		}
+	}
+	if report.Canary != nil && report.Canary.OK {
+		log.Printf("Canary %s render took %dms", report.Canary.Format, report.Canary.DurationMs)
+	}
+	for _, problem := range report.Problems {
+		log.Printf("Readiness check failed: %s", problem)
+	}
+	if strict && len(report.Problems) > 0 {
+		log.Fatalf("%d readiness checks failed", len(report.Problems))
+	}
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
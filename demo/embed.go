@@ -1,4 +1,3 @@
-
 // Package demo provides the embedded demo HTML for WASM environments
 package demo
 
@@ -6,3 +5,8 @@ import _ "embed"
 
 //go:embed index.html
 var HTML []byte
+
+// DeckPage is the html/template for shared deck links, with Open Graph preview tags
+//
+//go:embed deck.html
+var DeckPage string
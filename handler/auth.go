@@ -0,0 +1,439 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// Scopes granted to API keys
+// Admin implies every other scope and can't be limited to prefixes.
+const (
+	ScopeRead   = "read"   // Stored slides, manifests, status and listings
+	ScopeRender = "render" // Endpoints that run the pipeline on request
+	ScopeUpload = "upload" // Writing and deleting sources, tags and rollbacks
+	ScopeAdmin  = "admin"  // API keys, webhooks, dead letters and reindexing
+)
+
+// Scopes lists every scope in order of privilege
+var Scopes = []string{ScopeRead, ScopeRender, ScopeUpload, ScopeAdmin}
+
+// AnonymousScopes are granted to requests without credentials
+// The default keeps the demo page working while uploads and admin need a key.
+var AnonymousScopes = []string{ScopeRead, ScopeRender}
+
+// AdminToken is a bearer token with every scope, used to create the first API
+// keys; empty disables it
+var AdminToken string
+
+// SigningSecret is the HMAC key for signed upload URLs; empty disables them
+var SigningSecret []byte
+
+const (
+	apiKeyPrefix   = "apikey:" // KV prefix of API key records, by ID
+	apiTokenPrefix = "dfk_"    // Tokens are dfk_<id>_<secret>
+
+	signedURLTTL    = 15 * time.Minute
+	signedURLMaxTTL = 7 * 24 * time.Hour
+)
+
+// APIKey is an API key record
+// The token itself is never stored, only its SHA-256.
+type APIKey struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name,omitempty"`
+	Scopes    []string `json:"scopes"`
+	Prefixes  []string `json:"prefixes,omitempty"` // Source key prefixes the key is limited to; empty means all
+	CreatedAt string   `json:"createdAt"`
+	Hash      string   `json:"hash,omitempty"`
+}
+
+// ParseScopes parses a comma-separated scope list such as "read,render"
+// "none" parses to no scopes.
+func ParseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || scope == "none" {
+			continue
+		}
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q (want %s)", scope, strings.Join(Scopes, ", "))
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// principal is who a request acts as, once authenticated
+type principal struct {
+	id        string // Rate limit key; empty counts the client's address
+	anonymous bool
+	scopes    []string
+	prefixes  []string
+}
+
+// allows reports whether p may use scope on every one of resources
+// A prefix-limited principal needs at least one resource to check.
+func (p principal) allows(scope string, resources []string) bool {
+	if !slices.Contains(p.scopes, scope) && !slices.Contains(p.scopes, ScopeAdmin) {
+		return false
+	}
+	if len(p.prefixes) == 0 {
+		return true
+	}
+	if scope == ScopeAdmin || len(resources) == 0 {
+		return false
+	}
+	for _, resource := range resources {
+		if strings.Contains(resource, "..") || !slices.ContainsFunc(p.prefixes, func(prefix string) bool {
+			return strings.HasPrefix(resource, prefix)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// errUnauthenticated means credentials were given but aren't valid
+var errUnauthenticated = errors.New("invalid or expired credentials")
+
+// authorize wraps a handler so it needs read scope for GET and HEAD and write
+// scope for other methods
+// Requests present an API key as "Authorization: Bearer <token>" or X-API-Key,
+// or carry a signed upload URL. Each request is rate limited once: against its
+// API key, or against the client address when it has none or its credentials
+// fail, so guessing keys is throttled too.
+func authorize(read, write string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = read
+		}
+
+		p, err := authenticate(r)
+		client := p.id
+		if client == "" {
+			client = "ip:" + clientIP(r)
+		}
+		if !allowRate(w, r, client, scope) {
+			return
+		}
+		if err != nil {
+			if writeNotConfigured(w, err) {
+				return
+			}
+			if errors.Is(err, errUnauthenticated) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="deckfs"`)
+				writeError(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			writeError(w, fmt.Sprintf("Authentication failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		resources := requestResources(r)
+		if !p.allows(scope, resources) {
+			switch {
+			case p.anonymous:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="deckfs"`)
+				writeError(w, fmt.Sprintf("This endpoint needs an API key with %s scope", scope), http.StatusUnauthorized)
+			case len(p.prefixes) > 0 && slices.Contains(p.scopes, scope):
+				writeError(w, fmt.Sprintf("This key is limited to %s", strings.Join(p.prefixes, ", ")), http.StatusForbidden)
+			default:
+				writeError(w, fmt.Sprintf("This key lacks %s scope", scope), http.StatusForbidden)
+			}
+			return
+		}
+		h(w, r)
+	}
+}
+
+// authenticate resolves the request's credentials
+func authenticate(r *http.Request) (principal, error) {
+	if r.URL.Query().Has("sig") {
+		return verifySignedURL(r)
+	}
+
+	token := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); token == "" && auth != "" {
+		scheme, value, _ := strings.Cut(auth, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return principal{}, errUnauthenticated
+		}
+		token = strings.TrimSpace(value)
+	}
+	if token == "" {
+		return principal{anonymous: true, scopes: AnonymousScopes}, nil
+	}
+
+	if AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) == 1 {
+		return principal{id: "admin", scopes: []string{ScopeAdmin}}, nil
+	}
+
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, apiTokenPrefix), "_")
+	if !ok || !strings.HasPrefix(token, apiTokenPrefix) {
+		return principal{}, errUnauthenticated
+	}
+	key, err := loadAPIKey(r, id)
+	if err != nil {
+		return principal{}, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(key.Hash)) != 1 {
+		return principal{}, errUnauthenticated
+	}
+	return principal{id: "key:" + key.ID, scopes: key.Scopes, prefixes: key.Prefixes}, nil
+}
+
+// requestResources returns the storage keys a request touches, for prefix checks
+// They come from the path below the route (/upload/teamA/talk.dsh) and the
+// key, prefix, source, a and b query parameters.
+func requestResources(r *http.Request) []string {
+	var resources []string
+	if strings.HasSuffix(r.Pattern, "/") && r.Pattern != "/" {
+		if rest := strings.TrimPrefix(r.URL.Path, r.Pattern); rest != "" && rest != r.URL.Path {
+			resources = append(resources, rest)
+		}
+	}
+	query := r.URL.Query()
+	for _, name := range []string{"key", "prefix", "source", "a", "b"} {
+		if value := query.Get(name); value != "" {
+			resources = append(resources, value)
+		}
+	}
+	return resources
+}
+
+// SignUpload returns the signature for method on /upload/<key> until expires
+func SignUpload(secret []byte, method, key string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n/upload/%s\n%d", method, key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignedURL accepts an unexpired ?expires=&sig= pair for this method and path
+func verifySignedURL(r *http.Request) (principal, error) {
+	if len(SigningSecret) == 0 || !strings.HasPrefix(r.URL.Path, "/upload/") {
+		return principal{}, errUnauthenticated
+	}
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return principal{}, errUnauthenticated
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/upload/")
+	want := SignUpload(SigningSecret, r.Method, key, expires)
+	if !hmac.Equal([]byte(want), []byte(query.Get("sig"))) {
+		return principal{}, errUnauthenticated
+	}
+	return principal{scopes: []string{ScopeUpload}, prefixes: []string{key}}, nil
+}
+
+// handleSignUpload issues a signed upload URL
+//
+//	POST /auth/sign?key=teamA/talk.dsh             PUT, valid for 15 minutes
+//	POST /auth/sign?key=...&method=DELETE&ttl=1h
+//
+// The URL carries upload scope for that one key and method, so it can be
+// handed to a browser or CI job that holds no API key.
+func handleSignUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(SigningSecret) == 0 {
+		writeError(w, "Signed URLs are not configured on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	key := query.Get("key")
+	method := strings.ToUpper(query.Get("method"))
+	if method == "" {
+		method = http.MethodPut
+	}
+
+	v := NewValidator()
+	v.RequireNonEmpty("key", key)
+	v.RequireNoPathTraversal("key", key)
+	v.RequireNotReserved("key", key)
+	v.RequireOneOf("method", method, []string{http.MethodPut, http.MethodPost, http.MethodDelete})
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ttl := signedURLTTL
+	if s := query.Get("ttl"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > signedURLMaxTTL {
+			writeError(w, fmt.Sprintf("ttl must be a duration up to %s", signedURLMaxTTL), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	writeJSON(w, SignedURLResponse{
+		URL:     fmt.Sprintf("/upload/%s?expires=%d&sig=%s", key, expires, SignUpload(SigningSecret, method, key, expires)),
+		Method:  method,
+		Expires: time.Unix(expires, 0).UTC().Format(time.RFC3339),
+	})
+}
+
+// handleAPIKeys lists (GET) or creates (POST) API keys
+func handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	kv := runtime.KV()
+
+	switch r.Method {
+	case http.MethodGet:
+		ids, err := runtime.ListAllKV(ctx, kv, apiKeyPrefix)
+		if writeNotConfigured(w, err) {
+			return
+		}
+		if err != nil {
+			writeError(w, fmt.Sprintf("Failed to list API keys: %v", err), http.StatusInternalServerError)
+			return
+		}
+		keys := make([]APIKey, 0, len(ids))
+		for _, id := range ids {
+			key, err := loadAPIKey(r, strings.TrimPrefix(id, apiKeyPrefix))
+			if err != nil || key == nil {
+				continue
+			}
+			key.Hash = ""
+			keys = append(keys, *key)
+		}
+		writeJSON(w, APIKeysResponse{Keys: keys, Count: len(keys)})
+
+	case http.MethodPost:
+		var req APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		v := NewValidator()
+		v.RequireNonEmpty("scopes", strings.Join(req.Scopes, ""))
+		for _, scope := range req.Scopes {
+			v.RequireOneOf("scopes", scope, Scopes)
+		}
+		for _, prefix := range req.Prefixes {
+			v.RequireNonEmpty("prefixes", prefix)
+			v.RequireNoPathTraversal("prefixes", prefix)
+		}
+		if !v.IsValid() {
+			writeError(w, v.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Prefixes) > 0 && slices.Contains(req.Scopes, ScopeAdmin) {
+			writeError(w, "admin keys can't be limited to prefixes", http.StatusBadRequest)
+			return
+		}
+
+		id := randomHex(8)
+		token := apiTokenPrefix + id + "_" + randomHex(32)
+		key := APIKey{
+			ID:        id,
+			Name:      req.Name,
+			Scopes:    req.Scopes,
+			Prefixes:  req.Prefixes,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			Hash:      hashToken(token),
+		}
+		data, _ := json.Marshal(key)
+		err := kv.Put(ctx, apiKeyPrefix+id, data)
+		if writeNotConfigured(w, err) {
+			return
+		}
+		if err != nil {
+			writeError(w, fmt.Sprintf("Failed to store API key: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		key.Hash = ""
+		writeJSONStatus(w, APIKeyResponse{APIKey: key, Token: token}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAPIKey gets (GET) or revokes (DELETE) the API key /auth/keys/:id
+func handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/auth/keys/")
+
+	v := NewValidator()
+	v.RequireNonEmpty("id", id)
+	v.RequireNoPathTraversal("id", id)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := loadAPIKey(r, id)
+	if writeNotConfigured(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to load API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if key == nil {
+		writeError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		key.Hash = ""
+		writeJSON(w, key)
+
+	case http.MethodDelete:
+		if err := runtime.KV().Delete(r.Context(), apiKeyPrefix+id); err != nil {
+			writeError(w, fmt.Sprintf("Failed to revoke API key: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// loadAPIKey reads an API key record, or nil if there is none
+func loadAPIKey(r *http.Request, id string) (*APIKey, error) {
+	data, err := runtime.KV().Get(r.Context(), apiKeyPrefix+id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var key APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid API key record %s: %w", id, err)
+	}
+	return &key, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+func TestAuthorize(t *testing.T) {
+	runtime.SetRuntime(&runtime.Runtime{KV: runtime.NewMemoryKV()})
+	defer runtime.SetRuntime(nil)
+	AdminToken = "admin-token-for-tests"
+	SigningSecret = []byte("signing-secret-for-tests")
+	defer func() { AdminToken, SigningSecret = "", nil }()
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload/", authorize(ScopeUpload, ScopeUpload, ok))
+	mux.HandleFunc("/decks", authorize(ScopeRead, ScopeAdmin, ok))
+	mux.HandleFunc("/thumb/", authorizeThumb(ok))
+	mux.HandleFunc("/auth/keys", authorize(ScopeAdmin, ScopeAdmin, handleAPIKeys))
+
+	do := func(method, target, token string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, bytes.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("POST", "/auth/keys", AdminToken, []byte(`{"name":"team a","scopes":["read","upload"],"prefixes":["teamA/"]}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create key: %d %s", w.Code, w.Body)
+	}
+	var created APIKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Token == "" || created.Hash != "" {
+		t.Fatalf("create key response = %s", w.Body)
+	}
+	teamA := created.Token
+
+	expires := time.Now().Add(time.Minute).Unix()
+	signed := fmt.Sprintf("/upload/teamB/talk.dsh?expires=%d&sig=%s", expires, SignUpload(SigningSecret, "PUT", "teamB/talk.dsh", expires))
+	tampered := signed[:len(signed)-1] + "0"
+	if strings.HasSuffix(signed, "0") {
+		tampered = signed[:len(signed)-1] + "1"
+	}
+
+	for _, tc := range []struct {
+		method, target, token string
+		want                  int
+	}{
+		{"GET", "/decks", "", http.StatusNoContent},
+		{"POST", "/decks", "", http.StatusUnauthorized},
+		{"PUT", "/upload/teamA/talk.dsh", "", http.StatusUnauthorized},
+		{"PUT", "/upload/teamA/talk.dsh", "dfk_nope_nope", http.StatusUnauthorized},
+		{"PUT", "/upload/teamA/talk.dsh", teamA, http.StatusNoContent},
+		{"PUT", "/upload/teamB/talk.dsh", teamA, http.StatusForbidden},
+		{"GET", "/decks?prefix=teamA/", teamA, http.StatusNoContent},
+		{"GET", "/decks", teamA, http.StatusForbidden},
+		{"POST", "/decks", teamA, http.StatusForbidden},
+		{"GET", "/thumb/teamA/talk.dsh", teamA, http.StatusNoContent},
+		{"GET", "/thumb/teamA/talk.dsh?w=160", teamA, http.StatusForbidden},
+		{"GET", "/thumb/teamA/talk.dsh?w=160", AdminToken, http.StatusNoContent},
+		{"PUT", "/upload/teamA/talk.dsh", AdminToken, http.StatusNoContent},
+		{"PUT", signed, "", http.StatusNoContent},
+		{"DELETE", signed, "", http.StatusUnauthorized},
+		{"PUT", tampered, "", http.StatusUnauthorized},
+		{"PUT", "/upload/teamB/talk.dsh?expires=" + strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10) +
+			"&sig=" + SignUpload(SigningSecret, "PUT", "teamB/talk.dsh", time.Now().Add(-time.Minute).Unix()), "", http.StatusUnauthorized},
+	} {
+		if w := do(tc.method, tc.target, tc.token, nil); w.Code != tc.want {
+			t.Errorf("%s %s: got %d, want %d (%s)", tc.method, tc.target, w.Code, tc.want, w.Body)
+		}
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	if scopes, err := ParseScopes(" read, upload "); err != nil || len(scopes) != 2 {
+		t.Errorf("ParseScopes = %v, %v", scopes, err)
+	}
+	if scopes, err := ParseScopes("none"); err != nil || len(scopes) != 0 {
+		t.Errorf("ParseScopes(none) = %v, %v", scopes, err)
+	}
+	if _, err := ParseScopes("read,write"); err == nil {
+		t.Error("unknown scope accepted")
+	}
+}
+
+func TestAllowRate(t *testing.T) {
+	RateLimiter = runtime.NewMemoryRateLimiter()
+	defer func() { RateLimiter = nil }()
+	RenderRate.Burst = 1
+	defer func() { RenderRate.Burst = 10 }()
+
+	h := authorize(ScopeRender, ScopeRender, func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	do := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/process", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	if w := do("192.0.2.1:1234"); w.Code != http.StatusNoContent || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("first request: %d %v", w.Code, w.Header())
+	}
+	w := do("192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("second request: %d %v", w.Code, w.Header())
+	}
+	if w := do("192.0.2.2:1234"); w.Code != http.StatusNoContent {
+		t.Errorf("other client: %d", w.Code)
+	}
+
+	// Bad credentials are counted by address
+	guess := func() int {
+		r := httptest.NewRequest("POST", "/process", nil)
+		r.RemoteAddr = "192.0.2.3:1234"
+		r.Header.Set("Authorization", "Bearer nope")
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Code
+	}
+	if code := guess(); code != http.StatusUnauthorized {
+		t.Errorf("first guess: %d", code)
+	}
+	if code := guess(); code != http.StatusTooManyRequests {
+		t.Errorf("second guess: %d, want 429", code)
+	}
+
+	// Keyed requests count against the key only, not the address they come from
+	AdminToken = "admin-token-for-tests"
+	defer func() { AdminToken = "" }()
+	keyed := func() int {
+		r := httptest.NewRequest("POST", "/process", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("Authorization", "Bearer "+AdminToken)
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Code
+	}
+	if code := keyed(); code != http.StatusNoContent {
+		t.Errorf("key from a throttled address: %d", code)
+	}
+	if code := keyed(); code != http.StatusTooManyRequests {
+		t.Errorf("second keyed request: %d, want 429", code)
+	}
+}
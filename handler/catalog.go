@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// handleCatalogStats returns per-day processing stats
+// Supports ?days= (default 30)
+func handleCatalogStats(w http.ResponseWriter, r *http.Request) {
+	cat := runtime.Catalog()
+	if cat == nil {
+		writeError(w, "Catalog is not configured on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	days := 30
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, "days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	stats, err := cat.Stats(r.Context(), days)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to query stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, CatalogStatsResponse{
+		Stats: stats,
+		Count: len(stats),
+	})
+}
+
+// handleCatalogSource returns the latest status and recent runs of a source
+func handleCatalogSource(w http.ResponseWriter, r *http.Request) {
+	cat := runtime.Catalog()
+	if cat == nil {
+		writeError(w, "Catalog is not configured on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/catalog/sources/")
+
+	v := NewValidator()
+	v.RequireNonEmpty("key", key)
+	v.RequireNoPathTraversal("key", key)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, err := cat.Status(r.Context(), key)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to query source: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		writeError(w, "Source not found", http.StatusNotFound)
+		return
+	}
+
+	runs, err := cat.Runs(r.Context(), key, 20)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to query runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, CatalogSourceResponse{
+		SourceStatus: *status,
+		Runs:         runs,
+	})
+}
+
+// handleCatalogPending lists sources changed since their last successful run
+func handleCatalogPending(w http.ResponseWriter, r *http.Request) {
+	cat := runtime.Catalog()
+	if cat == nil {
+		writeError(w, "Catalog is not configured on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	keys, err := cat.NeedsProcessing(r.Context())
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to query pending sources: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, CatalogPendingResponse{
+		Keys:  keys,
+		Count: len(keys),
+	})
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/deckdiff"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/processor"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// diffSide is one of the two decks being compared
+type diffSide struct {
+	key    string
+	source []byte // Imports expanded
+	deck   *deck.Deck
+}
+
+// handleDiff compares two decks
+//
+//	GET /diff?a=talk.dsh&b=talk-v2.dsh         JSON report
+//	GET /diff?a=talk.dsh@3&b=talk.dsh          version 3 against the current source
+//	GET /diff?a=...&b=...&slide=N              side-by-side SVG of the Nth aligned pair
+func handleDiff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	refA, refB := query.Get("a"), query.Get("b")
+
+	v := NewValidator()
+	v.RequireNonEmpty("a", refA)
+	v.RequireNonEmpty("b", refB)
+	v.RequireNoPathTraversal("a", refA)
+	v.RequireNoPathTraversal("b", refB)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	a, status, err := loadDiffSide(ctx, refA)
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("a: %v", err), status)
+		return
+	}
+	b, status, err := loadDiffSide(ctx, refB)
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("b: %v", err), status)
+		return
+	}
+
+	report := deckdiff.Compare(a.deck, b.deck)
+
+	slideParam := query.Get("slide")
+	if slideParam == "" {
+		writeJSON(w, DiffResponse{A: refA, B: refB, Report: report})
+		return
+	}
+
+	n, err := strconv.Atoi(slideParam)
+	if err != nil || n < 1 || n > len(report.Slides) {
+		writeError(w, fmt.Sprintf("slide must be between 1 and %d", len(report.Slides)), http.StatusBadRequest)
+		return
+	}
+	diff := report.Slides[n-1]
+
+	before, err := renderDiffSlide(ctx, a, diff.Before)
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to render a: %v", err), http.StatusInternalServerError)
+		return
+	}
+	after, err := renderDiffSlide(ctx, b, diff.After)
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to render b: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	deckdiff.SideBySide(w, diff, before, after, float64(b.deck.Canvas.Width), float64(b.deck.Canvas.Height))
+}
+
+// loadDiffSide reads and parses a diff operand: an input key, or key@N for a retained version
+func loadDiffSide(ctx context.Context, ref string) (*diffSide, int, error) {
+	key, version := ref, 0
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		n, err := strconv.Atoi(ref[i+1:])
+		if err != nil || n < 1 {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid version in %q", ref)
+		}
+		key, version = ref[:i], n
+	}
+
+	var source []byte
+	if version > 0 {
+		var err error
+		source, err = Processor.VersionSource(ctx, key, version)
+		if errors.Is(err, processor.ErrVersionNotFound) {
+			return nil, http.StatusNotFound, fmt.Errorf("%s not found", ref)
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	} else {
+		reader, err := runtime.Input().Get(ctx, key)
+		if err != nil || reader == nil {
+			return nil, http.StatusNotFound, fmt.Errorf("%s not found", ref)
+		}
+		source, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	var err error
+
+	if !pipeline.IsRenderable(source) {
+		return nil, http.StatusBadRequest, fmt.Errorf("%s is not a renderable deck", ref)
+	}
+	source, err = expandImports(ctx, source, key)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("import resolution failed: %w", err)
+	}
+
+	d, err := runtime.Parse(ctx, source)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return &diffSide{key: key, source: source, deck: d}, http.StatusOK, nil
+}
+
+// renderDiffSlide renders slide number (1-based) of a side, or nil for 0
+func renderDiffSlide(ctx context.Context, side *diffSide, number int) ([]byte, error) {
+	if number == 0 {
+		return nil, nil
+	}
+	result, err := runtime.GetPipeline().ProcessWithWorkDir(ctx, side.source, runtime.FormatSVG, processor.WorkDir(runtime.Input(), side.key))
+	if err != nil {
+		return nil, err
+	}
+	if number > len(result.Slides) {
+		return nil, fmt.Errorf("slide %d not rendered", number)
+	}
+	return result.Slides[number-1], nil
+}
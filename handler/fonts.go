@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/joeblew999/deckfs/pkg/fonts"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// Fonts reports font availability and delivers fonts for ?fontMode=
+// Set it at startup; when nil, availability is left out of reports and SVG
+// slides keep their fallback stacks.
+var Fonts *fonts.Manager
+
+// fontModes are the accepted ?fontMode= values
+var fontModes = []string{string(fonts.ModeFallback), string(fonts.ModeCDN), string(fonts.ModeEmbed)}
+
+// handleDetectFonts reports the fonts a deck uses and where
+//
+//	POST /fonts/detect                   decksh source in the body
+//	POST /fonts/detect?source=talk.dsh   body resolves imports relative to the key,
+//	                                     or an empty body reads the stored deck
+func handleDetectFonts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	source, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	sourcePath := r.URL.Query().Get("source")
+	v := NewValidator()
+	v.RequireNoPathTraversal("source", sourcePath)
+	if len(source) == 0 {
+		v.RequireNonEmpty("source", sourcePath)
+	}
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if len(source) == 0 {
+		reader, err := runtime.Input().Get(ctx, sourcePath)
+		if writeNotConfigured(w, err) {
+			return
+		}
+		if err != nil {
+			writeError(w, "Deck not found", http.StatusNotFound)
+			return
+		}
+		source, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			writeError(w, "Failed to read deck", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	source, err := expandImports(ctx, source, sourcePath)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Import resolution failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	d, err := runtime.Parse(ctx, source)
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found := fonts.Detect(d)
+	if Fonts != nil {
+		fonts.Check(ctx, found, Fonts)
+	}
+	writeJSON(w, FontsResponse{
+		Source: sourcePath,
+		Fonts:  found,
+		Count:  len(found),
+		Store:  Fonts != nil,
+	})
+}
+
+// applyFontMode delivers the fonts of an SVG slide as ?fontMode= asks
+// The mode must already be validated against fontModes.
+func applyFontMode(r *http.Request, svg []byte) ([]byte, error) {
+	mode := fonts.Mode(r.URL.Query().Get("fontMode"))
+	if Fonts == nil || mode == "" || mode == fonts.ModeFallback {
+		return svg, nil
+	}
+	return Fonts.SVG(r.Context(), svg, mode)
+}
+
+// applyDeckFontMode delivers the fonts of a deck's SVG slides as ?fontMode= asks,
+// in one stylesheet for all of them (see fonts.Manager.Stylesheet)
+func applyDeckFontMode(r *http.Request, slides [][]byte) (string, [][]byte, error) {
+	mode := fonts.Mode(r.URL.Query().Get("fontMode"))
+	if Fonts == nil || mode == "" || mode == fonts.ModeFallback {
+		return "", slides, nil
+	}
+	return Fonts.Stylesheet(r.Context(), slides, mode)
+}
@@ -5,42 +5,94 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/joeblew999/deckfs/demo"
 	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/processor"
 	"github.com/joeblew999/deckfs/runtime"
 )
 
 const Version = "0.1.0"
 
 // RegisterHandlers registers all HTTP handlers
+// Each route names the scope it needs for reads (GET, HEAD) and for writes; /
+// and /health stay open so probes need no key.
 func RegisterHandlers(mux *http.ServeMux) {
 	mux.HandleFunc("/", cors(handleRoot))
 	mux.HandleFunc("/health", cors(handleHealth))
-	mux.HandleFunc("/process", cors(handleProcess))
-	mux.HandleFunc("/slides/", cors(handleGetSlide))
-	mux.HandleFunc("/manifest/", cors(handleGetManifest))
-	mux.HandleFunc("/decks", cors(handleListDecks))
-	mux.HandleFunc("/upload/", cors(handleUpload))
-	mux.HandleFunc("/status/", cors(handleStatus))
-	mux.HandleFunc("/examples", cors(handleListExamples))
-	mux.HandleFunc("/examples/", cors(handleGetExample))
-	mux.HandleFunc("/deck/", cors(handleDeckRoute))
+	mux.HandleFunc("/process", cors(authorize(ScopeRender, ScopeRender, handleProcess)))
+	mux.HandleFunc("/slides/", cors(authorize(ScopeRead, ScopeRead, handleGetSlide)))
+	mux.HandleFunc("/manifest/", cors(authorize(ScopeRead, ScopeRead, handleGetManifest)))
+	mux.HandleFunc("/decks", cors(authorize(ScopeRead, ScopeAdmin, handleListDecks)))
+	mux.HandleFunc("/upload/", cors(authorize(ScopeUpload, ScopeUpload, handleUpload)))
+	mux.HandleFunc("/status", cors(authorize(ScopeRead, ScopeRead, handleListStatus)))
+	mux.HandleFunc("/status/", cors(authorize(ScopeRead, ScopeRead, handleStatus)))
+	mux.HandleFunc("/deadletters", cors(authorize(ScopeAdmin, ScopeAdmin, handleListDeadLetters)))
+	mux.HandleFunc("/versions/", cors(authorize(ScopeRead, ScopeUpload, handleVersions)))
+	mux.HandleFunc("/diff", cors(authorize(ScopeRender, ScopeRender, handleDiff)))
+	mux.HandleFunc("/fonts/detect", cors(authorize(ScopeRender, ScopeRender, handleDetectFonts)))
+	mux.HandleFunc("/search", cors(authorize(ScopeRead, ScopeRead, handleSearch)))
+	mux.HandleFunc("/tags", cors(authorize(ScopeRead, ScopeRead, handleListTags)))
+	mux.HandleFunc("/tags/", cors(authorize(ScopeRead, ScopeUpload, handleDeckTags)))
+	mux.HandleFunc("/catalog/stats", cors(authorize(ScopeRead, ScopeRead, handleCatalogStats)))
+	mux.HandleFunc("/catalog/sources/", cors(authorize(ScopeRead, ScopeRead, handleCatalogSource)))
+	mux.HandleFunc("/catalog/pending", cors(authorize(ScopeRead, ScopeRead, handleCatalogPending)))
+	mux.HandleFunc("/examples", cors(authorize(ScopeRead, ScopeRead, handleListExamples)))
+	mux.HandleFunc("/examples/", cors(authorize(ScopeRead, ScopeRead, handleGetExample)))
+	mux.HandleFunc("/deck/", cors(authorize(ScopeRender, ScopeRender, handleDeckRoute)))
+	mux.HandleFunc("/thumb/", cors(authorizeThumb(handleThumb)))
+	mux.HandleFunc("/webhooks", cors(authorize(ScopeAdmin, ScopeAdmin, handleWebhooks)))
+	mux.HandleFunc("/webhooks/", cors(authorize(ScopeAdmin, ScopeAdmin, handleWebhook)))
+	mux.HandleFunc("/auth/keys", cors(authorize(ScopeAdmin, ScopeAdmin, handleAPIKeys)))
+	mux.HandleFunc("/auth/keys/", cors(authorize(ScopeAdmin, ScopeAdmin, handleAPIKey)))
+	mux.HandleFunc("/auth/sign", cors(authorize(ScopeUpload, ScopeUpload, handleSignUpload)))
 }
 
+// Processor renders uploads and serves deck state for every handler
+// Set it at startup to share a queue with the background consumers; the
+// default re-renders the dependents of a library inline.
+var Processor = processor.New()
+
 // cors wraps a handler with CORS headers
+// CORSOrigins are the origins allowed to call the API from a browser
+// Empty, or containing "*", allows any origin.
+var CORSOrigins []string
+
+// allowOrigin returns the Access-Control-Allow-Origin value for a request's
+// origin, or "" when it isn't allowed
+func allowOrigin(origin string) string {
+	if len(CORSOrigins) == 0 {
+		return "*"
+	}
+	for _, allowed := range CORSOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
 func cors(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if origin := allowOrigin(r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if len(CORSOrigins) > 0 {
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -75,43 +127,34 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 		Service:   "deckfs",
 		Version:   Version,
 		Runtime:   "wasm",
-		Endpoints: []string{"/health", "/process", "/slides/:key", "/manifest/:name", "/decks", "/upload/:key", "/status/:key", "/examples", "/examples/:path"},
+		Endpoints: []string{"/health", "/process", "/slides/:key", "/manifest/:name", "/decks", "/upload/:key", "/status", "/status/:key", "/deadletters", "/versions/:key", "/diff", "/fonts/detect", "/search", "/tags", "/tags/:key", "/catalog/stats", "/catalog/sources/:key", "/catalog/pending", "/examples", "/examples/:path", "/thumb/:key", "/webhooks", "/webhooks/:id", "/auth/keys", "/auth/keys/:id", "/auth/sign"},
 		Formats:   formatStrs,
 	})
 }
 
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, HealthResponse{
-		Status:  "ok",
-		Runtime: "wasm",
-	})
-}
-
 func handleProcess(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	source, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeError(w, "Failed to read body", http.StatusBadRequest)
+	source, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
 	// Validate sourcePath if provided
 	sourcePath := r.URL.Query().Get("source")
-	if sourcePath != "" {
-		v := NewValidator()
-		v.RequireNoPathTraversal("source", sourcePath)
-		if !v.IsValid() {
-			writeError(w, v.Error(), http.StatusBadRequest)
-			return
-		}
+	v := NewValidator()
+	v.RequireNoPathTraversal("source", sourcePath)
+	v.RequireOneOf("fontMode", r.URL.Query().Get("fontMode"), fontModes)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Expand imports if needed (WASM only)
-	source, err = expandImports(r.Context(), source, sourcePath)
+	source, err := expandImports(r.Context(), source, sourcePath)
 	if err != nil {
 		writeError(w, fmt.Sprintf("Import resolution failed: %v", err), http.StatusBadRequest)
 		return
@@ -139,17 +182,41 @@ func handleProcess(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result, err := runtime.GetPipeline().ProcessWithWorkDir(r.Context(), source, runtime.FormatSVG, workDir)
+	if writeLimitError(w, err) {
+		return
+	}
 	if err != nil {
 		writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	slides := make([]string, len(result.Slides))
+	rendered := make([][]byte, len(result.Slides))
 	for i, s := range result.Slides {
 		// Rewrite image and link paths if we have a source path
 		if sourcePath != "" {
 			s = rewriteSVGLinks(s, sourcePath)
 		}
+		rendered[i] = s
+	}
+
+	// Shared fonts go out once for the deck, for pages that inline every slide
+	fontCSS := ""
+	if r.URL.Query().Get("sharedFonts") == "true" {
+		fontCSS, rendered, err = applyDeckFontMode(r, rendered)
+	} else {
+		for i := range rendered {
+			if rendered[i], err = applyFontMode(r, rendered[i]); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Font delivery failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	slides := make([]string, len(rendered))
+	for i, s := range rendered {
 		slides[i] = string(s)
 	}
 
@@ -159,11 +226,12 @@ func handleProcess(w http.ResponseWriter, r *http.Request) {
 		SlideCount: result.SlideCount,
 		Slides:     slides,
 		Format:     "svg",
+		FontCSS:    fontCSS,
 	})
 }
 
 func handleUpload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost && r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -174,6 +242,7 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	v := NewValidator()
 	v.RequireNonEmpty("key", key)
 	v.RequireNoPathTraversal("key", key)
+	v.RequireNotReserved("key", key)
 	if !strings.HasSuffix(key, ".dsh") {
 		writeError(w, "Key must end with .dsh", http.StatusBadRequest)
 		return
@@ -183,73 +252,68 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	source, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeError(w, "Failed to read body", http.StatusBadRequest)
-		return
-	}
-
 	ctx := r.Context()
-	input := runtime.Input()
-	output := runtime.Output()
 
-	// Store source
-	if err := input.Put(ctx, key, source, "text/plain"); err != nil {
-		writeError(w, fmt.Sprintf("Failed to store source: %v", err), http.StatusInternalServerError)
+	// Refuse up front rather than storing a source whose output can't be kept
+	if !runtime.Configured(runtime.Output()) {
+		writeError(w, "Uploads need output storage, which is not configured on this server", http.StatusServiceUnavailable)
 		return
 	}
 
-	// Expand imports if needed (WASM only)
-	processSource, err := expandImports(ctx, source, key)
-	if err != nil {
-		writeError(w, fmt.Sprintf("Import resolution failed: %v", err), http.StatusBadRequest)
+	// Delete source and its rendered output
+	if r.Method == http.MethodDelete {
+		if err := runtime.Input().Delete(ctx, key); err != nil {
+			if writeNotConfigured(w, err) {
+				return
+			}
+			writeError(w, fmt.Sprintf("Failed to delete source: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := Processor.Delete(ctx, key); err != nil {
+			writeError(w, fmt.Sprintf("Failed to delete output: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	// Process using runtime pipeline
-	result, err := runtime.GetPipeline().Process(ctx, processSource, runtime.FormatSVG)
-	if err != nil {
-		writeError(w, fmt.Sprintf("Processing failed: %v", err), http.StatusBadRequest)
+	source, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
-	// Store slides
-	baseName := strings.TrimSuffix(key, ".dsh")
-	for i, slide := range result.Slides {
-		slideKey := fmt.Sprintf("%s/slide-%04d.svg", baseName, i+1)
-		if err := output.Put(ctx, slideKey, slide, "image/svg+xml"); err != nil {
-			writeError(w, fmt.Sprintf("Failed to store slide %d: %v", i+1, err), http.StatusInternalServerError)
+	// Store source
+	if err := runtime.Input().Put(ctx, key, source, "text/plain"); err != nil {
+		if writeNotConfigured(w, err) {
 			return
 		}
+		writeError(w, fmt.Sprintf("Failed to store source: %v", err), http.StatusInternalServerError)
+		return
 	}
+	runtime.PublishEvent(ctx, runtime.Event{Type: runtime.EventDeckUploaded, Key: key})
 
-	// Store manifest
-	manifest := map[string]any{
-		"sourceKey":   key,
-		"processedAt": time.Now().UTC().Format(time.RFC3339),
-		"title":       result.Title,
-		"slideCount":  result.SlideCount,
-		"slides":      makeSlideList(baseName, result.SlideCount),
-	}
-	manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
-	manifestKey := fmt.Sprintf("%s/manifest.json", baseName)
-
-	if err := output.Put(ctx, manifestKey, manifestJSON, "application/json"); err != nil {
-		writeError(w, fmt.Sprintf("Failed to store manifest: %v", err), http.StatusInternalServerError)
+	// Render and store slides + manifest (same path as the background consumers)
+	result, err := Processor.ProcessSource(ctx, key, source)
+	if writeNotConfigured(w, err) || writeLimitError(w, err) {
 		return
 	}
-
-	// Build slide URL list
-	slides := make([]string, result.SlideCount)
-	for i := 0; i < result.SlideCount; i++ {
-		slides[i] = fmt.Sprintf("%s/slide-%04d.svg", baseName, i+1)
+	if err != nil {
+		status := http.StatusBadRequest
+		var perr *processor.Error
+		if errors.As(err, &perr) && perr.Retryable() {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, fmt.Sprintf("Processing failed: %v", err), status)
+		return
 	}
 
 	writeJSON(w, UploadResponse{
 		Success:    true,
 		Key:        key,
 		SlideCount: result.SlideCount,
-		Slides:     slides,
+		Slides:     result.Slides,
+		Library:    result.Library,
+		Version:    result.Version,
 	})
 }
 
@@ -260,16 +324,41 @@ func handleGetSlide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fontMode := r.URL.Query().Get("fontMode")
+	v := NewValidator()
+	v.RequireOneOf("fontMode", fontMode, fontModes)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
 	reader, err := runtime.Output().Get(r.Context(), key)
 	if err != nil {
-		http.NotFound(w, r)
+		if !writeNotConfigured(w, err) {
+			http.NotFound(w, r)
+		}
 		return
 	}
 	defer reader.Close()
 
+	if fontMode == "" || !strings.HasSuffix(key, ".svg") {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		io.Copy(w, reader)
+		return
+	}
+
+	slide, err := io.ReadAll(reader)
+	if err == nil {
+		slide, err = applyFontMode(r, slide)
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Font delivery failed: %v", err), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "image/svg+xml")
 	w.Header().Set("Cache-Control", "public, max-age=3600")
-	io.Copy(w, reader)
+	w.Write(slide)
 }
 
 func handleGetManifest(w http.ResponseWriter, r *http.Request) {
@@ -283,7 +372,9 @@ func handleGetManifest(w http.ResponseWriter, r *http.Request) {
 	key := fmt.Sprintf("%s/manifest.json", name)
 	reader, err := runtime.Output().Get(r.Context(), key)
 	if err != nil {
-		http.NotFound(w, r)
+		if !writeNotConfigured(w, err) {
+			http.NotFound(w, r)
+		}
 		return
 	}
 	defer reader.Close()
@@ -304,7 +395,7 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := runtime.KV().Get(r.Context(), "status:"+key)
+	data, err := runtime.KV().Get(r.Context(), processor.StatusKey(key))
 	if err != nil || data == nil {
 		writeJSON(w, StatusResponse{
 			Status: "unknown",
@@ -321,33 +412,195 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, status)
 }
 
-func handleListDecks(w http.ResponseWriter, r *http.Request) {
-	result, err := runtime.Output().List(r.Context(), "", "/")
+// handleListStatus lists processing status records
+// Supports ?prefix= (source key prefix), ?status=processing,error and ?cursor= for paging
+func handleListStatus(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+
+	v := NewValidator()
+	v.RequireNoPathTraversal("prefix", prefix)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wanted := make(map[string]bool)
+	for _, s := range strings.Split(query.Get("status"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			wanted[s] = true
+		}
+	}
+
+	kv := runtime.KV()
+	page, err := kv.List(r.Context(), "status:"+prefix, query.Get("cursor"))
 	if err != nil {
 		writeError(w, fmt.Sprintf("List failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	decks := make([]DeckInfo, 0)
-	for _, prefix := range result.DelimitedPrefixes {
-		key := strings.TrimSuffix(prefix, "/")
-		decks = append(decks, DeckInfo{
-			Key: key,
-			// TODO: Optionally read manifest.json to populate SlideCount and ProcessedAt
+	statuses := make([]KeyStatus, 0, len(page.Keys))
+	for _, kvKey := range page.Keys {
+		data, err := kv.Get(r.Context(), kvKey)
+		if err != nil || data == nil {
+			continue // Expired or deleted between list and get
+		}
+
+		var status StatusResponse
+		if err := json.Unmarshal(data, &status); err != nil {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[status.Status] {
+			continue
+		}
+
+		statuses = append(statuses, KeyStatus{
+			Key:            strings.TrimPrefix(kvKey, "status:"),
+			StatusResponse: status,
 		})
 	}
 
-	writeJSON(w, DecksResponse{
-		Decks: decks,
-		Count: len(decks),
+	writeJSON(w, StatusListResponse{
+		Statuses: statuses,
+		Count:    len(statuses),
+		Cursor:   page.Cursor,
+	})
+}
+
+// handleListDeadLetters lists queue messages that exhausted their retry budget
+func handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := Processor.QueueDeadLetters(r.Context())
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to list dead letters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, QueueDeadLettersResponse{
+		DeadLetters: letters,
+		Count:       len(letters),
 	})
 }
 
+// handleListDecks lists rendered decks from the deck index
+// Supports ?prefix=, ?status= (comma separated), ?sort=, ?order=asc|desc, ?limit= and ?cursor=
+// POST rebuilds the index from stored manifests.
+func handleListDecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		handleReindexDecks(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	q := processor.DeckQuery{
+		Prefix: query.Get("prefix"),
+		Sort:   query.Get("sort"),
+		Desc:   query.Get("order") == "desc",
+	}
+
+	v := NewValidator()
+	v.RequireNoPathTraversal("prefix", q.Prefix)
+	v.RequireOneOf("sort", q.Sort, processor.DeckSorts)
+	v.RequireOneOf("order", query.Get("order"), []string{"asc", "desc"})
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, s := range strings.Split(query.Get("status"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			q.Status = append(q.Status, s)
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	if s := query.Get("cursor"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeError(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		q.Offset = n
+	}
+
+	page, err := Processor.Decks(r.Context(), q)
+	if writeNotConfigured(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("List failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	decks := make([]DeckInfo, len(page.Decks))
+	for i, e := range page.Decks {
+		decks[i] = DeckInfo{
+			Key:         e.BaseName,
+			Source:      e.Key,
+			Title:       e.Title,
+			SlideCount:  e.SlideCount,
+			ProcessedAt: e.ProcessedAt,
+			Status:      e.Status,
+			Error:       e.Error,
+			ETag:        e.ETag,
+			UpdatedAt:   e.UpdatedAt,
+		}
+		if e.Thumbnail != "" {
+			decks[i].ThumbnailURL = "/slides/" + e.Thumbnail
+		}
+	}
+
+	resp := DecksResponse{
+		Decks:    decks,
+		Count:    len(decks),
+		Total:    page.Total,
+		Indexing: page.Indexing,
+	}
+	if page.Next > 0 {
+		resp.Cursor = strconv.Itoa(page.Next)
+	}
+	writeJSON(w, resp)
+}
+
+// handleReindexDecks rebuilds the deck index from stored manifests
+func handleReindexDecks(w http.ResponseWriter, r *http.Request) {
+	n, err := Processor.ReindexDecks(r.Context())
+	if writeNotConfigured(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Reindex failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ReindexResponse{Indexed: n})
+}
+
 func writeJSON(w http.ResponseWriter, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
 
+func writeJSONStatus(w http.ResponseWriter, data any, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeNotConfigured answers 503, naming the backend, when err comes from
+// storage or KV the server doesn't have; it reports whether it did
+func writeNotConfigured(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, runtime.ErrNotConfigured) {
+		return false
+	}
+	writeError(w, err.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
 func writeError(w http.ResponseWriter, message string, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -357,17 +610,6 @@ func writeError(w http.ResponseWriter, message string, status int) {
 	})
 }
 
-func makeSlideList(baseName string, count int) []map[string]any {
-	slides := make([]map[string]any, count)
-	for i := 0; i < count; i++ {
-		slides[i] = map[string]any{
-			"number": i + 1,
-			"key":    fmt.Sprintf("%s/slide-%04d.svg", baseName, i+1),
-		}
-	}
-	return slides
-}
-
 // expandImports pre-expands import/include statements for WASM environments
 func expandImports(ctx context.Context, source []byte, sourcePath string) ([]byte, error) {
 	// Check if source has imports and expand them
@@ -392,11 +634,35 @@ func handleListExamples(w http.ResponseWriter, r *http.Request) {
 
 	// List all .dsh files from INPUT storage
 	listResult, err := runtime.Input().List(r.Context(), "", "")
+	if writeNotConfigured(w, err) {
+		return
+	}
 	if err != nil {
 		writeError(w, fmt.Sprintf("Failed to list examples: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// Classify only when filtering; classifications are cached per key and ETag,
+	// so repeat requests read just the files that changed
+	var classified map[string]*pipeline.Classification
+	if filterRenderable {
+		objects := listResult.Objects
+		if len(objects) != len(listResult.Keys) {
+			// Backend reported no metadata; classify without caching
+			objects = make([]runtime.ObjectInfo, len(listResult.Keys))
+			for i, key := range listResult.Keys {
+				objects[i] = runtime.ObjectInfo{Key: key}
+			}
+		}
+		var sources []runtime.ObjectInfo
+		for _, obj := range objects {
+			if strings.HasSuffix(obj.Key, ".dsh") {
+				sources = append(sources, obj)
+			}
+		}
+		classified = Processor.ClassifyObjects(r.Context(), sources)
+	}
+
 	var examples []Example
 
 	for _, key := range listResult.Keys {
@@ -407,38 +673,21 @@ func handleListExamples(w http.ResponseWriter, r *http.Request) {
 		// Extract name from path
 		name := strings.TrimSuffix(key, ".dsh")
 
-		// Check if file is renderable when filtering is requested
-		isRenderable := true
+		example := Example{
+			Name:       name,
+			Path:       key,
+			Renderable: true,
+		}
 		if filterRenderable {
-			// Read file to check if it's renderable
-			reader, err := runtime.Input().Get(r.Context(), key)
-			if err != nil {
-				continue // Skip files we can't read
-			}
-			content, err := io.ReadAll(reader)
-			reader.Close()
-			if err != nil {
-				continue // Skip files we can't read
-			}
-
-			// Check if file contains deck/edeck structure
-			contentStr := string(content)
-			isRenderable = strings.HasPrefix(contentStr, "deck\n") ||
-				strings.HasPrefix(contentStr, "deck ") ||
-				strings.Contains(contentStr, "\ndeck\n") ||
-				strings.Contains(contentStr, "\ndeck ")
-
-			// Skip non-renderable files if filter is enabled
-			if !isRenderable {
-				continue
+			c, ok := classified[key]
+			if !ok || c.Kind != pipeline.KindDeck {
+				continue // Skip unreadable and non-renderable files
 			}
+			example.Title = c.Title
+			example.SlideCount = c.SlideCount
 		}
 
-		examples = append(examples, Example{
-			Name:       name,
-			Path:       key,
-			Renderable: isRenderable,
-		})
+		examples = append(examples, example)
 	}
 
 	writeJSON(w, ExamplesResponse{
@@ -461,6 +710,9 @@ func handleGetExample(w http.ResponseWriter, r *http.Request) {
 	}
 
 	reader, err := runtime.Input().Get(r.Context(), examplePath)
+	if writeNotConfigured(w, err) {
+		return
+	}
 	if err != nil {
 		writeError(w, "Example not found", http.StatusNotFound)
 		return
@@ -497,9 +749,8 @@ func handleDeckRoute(w http.ResponseWriter, r *http.Request) {
 		routeType = "asset"
 		routeParam = parts[1]
 	} else {
-		// Just the deck path - redirect to slide 1
-		examplePath = path
-		http.Redirect(w, r, fmt.Sprintf("/deck/%s/slide/1.svg", examplePath), http.StatusFound)
+		// Just the deck path - a shareable page with link previews
+		handleDeckPage(w, r, path)
 		return
 	}
 
@@ -525,6 +776,7 @@ func handleDeckSlide(w http.ResponseWriter, r *http.Request, examplePath string,
 	v.RequireNonEmpty("examplePath", examplePath)
 	v.RequireNoPathTraversal("examplePath", examplePath)
 	v.RequireNonEmpty("slideParam", slideParam)
+	v.RequireOneOf("fontMode", r.URL.Query().Get("fontMode"), fontModes)
 	if !v.IsValid() {
 		writeError(w, v.Error(), http.StatusBadRequest)
 		return
@@ -540,6 +792,9 @@ func handleDeckSlide(w http.ResponseWriter, r *http.Request, examplePath string,
 
 	// Read deck source from storage
 	reader, err := runtime.Input().Get(r.Context(), examplePath)
+	if writeNotConfigured(w, err) {
+		return
+	}
 	if err != nil {
 		writeError(w, "Deck not found", http.StatusNotFound)
 		return
@@ -553,13 +808,7 @@ func handleDeckSlide(w http.ResponseWriter, r *http.Request, examplePath string,
 	}
 
 	// Check if file is renderable (contains deck declaration)
-	contentStr := string(source)
-	isRenderable := strings.HasPrefix(contentStr, "deck\n") ||
-		strings.HasPrefix(contentStr, "deck ") ||
-		strings.Contains(contentStr, "\ndeck\n") ||
-		strings.Contains(contentStr, "\ndeck ")
-
-	if !isRenderable {
+	if !pipeline.IsRenderable(source) {
 		writeError(w, "File is not a renderable deck (library file with only function definitions)", http.StatusBadRequest)
 		return
 	}
@@ -591,6 +840,9 @@ func handleDeckSlide(w http.ResponseWriter, r *http.Request, examplePath string,
 	}
 
 	result, err := runtime.GetPipeline().ProcessWithWorkDir(r.Context(), source, runtime.FormatSVG, workDir)
+	if writeLimitError(w, err) {
+		return
+	}
 	if err != nil {
 		writeError(w, fmt.Sprintf("Failed to render deck: %v", err), http.StatusInternalServerError)
 		return
@@ -607,6 +859,11 @@ func handleDeckSlide(w http.ResponseWriter, r *http.Request, examplePath string,
 
 	// Rewrite links in SVG
 	rewrittenSlide := rewriteSVGLinks(slide, examplePath)
+	rewrittenSlide, err = applyFontMode(r, rewrittenSlide)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Font delivery failed: %v", err), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "image/svg+xml")
 	w.Write(rewrittenSlide)
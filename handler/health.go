@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/joeblew999/deckfs/pkg/fonts"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// healthTimeout bounds each storage check; canaryTimeout bounds the deep render
+const (
+	healthTimeout = 5 * time.Second
+	canaryTimeout = 30 * time.Second
+)
+
+// healthKey is read from KV and the catalog to check they answer; it is never written
+const healthKey = "health:probe"
+
+// canarySource is rendered by /health?deep=true; it uses every required font
+const canarySource = `deck
+slide "white" "black"
+ctext "deckfs canary" 50 70 5
+ctext "serif" 50 45 4 "serif"
+ctext "mono" 50 20 4 "mono"
+eslide
+edeck
+`
+
+// handleHealth reports whether the server is ready to render
+//
+//	GET /health             pipeline, fonts and storage checks
+//	GET /health?deep=true   also renders a canary deck
+//
+// Any failed check answers 503, so load balancers and probes take the
+// instance out of rotation.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	report := Health(r.Context(), r.URL.Query().Get("deep") == "true")
+	status := http.StatusOK
+	if len(report.Problems) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSONStatus(w, report, status)
+}
+
+// Health builds the readiness report served by /health
+// deep adds a canary render in the richest format the pipeline supports.
+func Health(ctx context.Context, deep bool) HealthResponse {
+	report := HealthResponse{Status: "ok", Runtime: "wasm", Version: Version}
+
+	p := runtime.GetPipeline()
+	if p == nil {
+		report.Problems = append(report.Problems, "no pipeline configured")
+	} else {
+		if d, ok := p.(runtime.Describer); ok {
+			info := d.Describe()
+			report.Pipeline = &info
+			report.Runtime = info.Type
+			for _, b := range info.Binaries {
+				if b.Name == "decksh" && !b.Found {
+					report.Problems = append(report.Problems, "decksh binary not found at "+b.Path)
+				}
+			}
+		}
+		for _, f := range p.SupportedFormats() {
+			report.Formats = append(report.Formats, string(f))
+		}
+		if len(report.Formats) == 0 {
+			report.Problems = append(report.Problems, "pipeline supports no output formats")
+		}
+	}
+
+	report.Fonts = fontStatus(ctx, report.Pipeline, report.Formats)
+	for _, f := range report.Fonts {
+		if f.Required && !f.Available {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s font %s not found", f.Alias, f.File))
+		}
+	}
+
+	report.Storage = storageStatus(ctx)
+	for _, s := range report.Storage {
+		if s.Configured && !s.OK {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s storage: %s", s.Name, s.Error))
+		}
+	}
+
+	if deep && p != nil && len(report.Formats) > 0 {
+		report.Canary = canary(ctx, p, report.Formats)
+		if !report.Canary.OK {
+			report.Problems = append(report.Problems, "canary render: "+report.Canary.Error)
+		}
+	}
+
+	if len(report.Problems) > 0 {
+		report.Status = "unavailable"
+	}
+	return report
+}
+
+// fontStatus reports the alias fonts, which PNG and PDF renders need
+// Availability comes from the font manager, or the pipeline's font directory
+// without one; nil means neither can be checked.
+func fontStatus(ctx context.Context, info *runtime.PipelineInfo, formats []string) []FontStatus {
+	var store fonts.Store
+	family := func(alias string) string { return fonts.DefaultAliases[alias] }
+	switch {
+	case Fonts != nil:
+		store = Fonts
+		family = Fonts.Family
+	case info != nil && info.FontDir != "":
+		store = fonts.Dir(info.FontDir)
+	default:
+		return nil
+	}
+
+	rasters := false
+	for _, f := range formats {
+		if f == string(runtime.FormatPNG) || f == string(runtime.FormatPDF) {
+			rasters = true
+		}
+	}
+
+	var result []FontStatus
+	for _, alias := range []string{fonts.Sans, fonts.Serif, fonts.Mono, fonts.Symbol} {
+		result = append(result, FontStatus{
+			Alias:     alias,
+			Family:    family(alias),
+			File:      fonts.AliasFiles[alias],
+			Available: store.Has(ctx, alias),
+			Required:  rasters && alias != fonts.Symbol,
+		})
+	}
+	return result
+}
+
+// storageStatus makes one cheap request to each configured backend
+func storageStatus(ctx context.Context) []StorageStatus {
+	rt := runtime.Current
+	if rt == nil {
+		rt = &runtime.Runtime{}
+	}
+	list := func(s runtime.Storage) func(context.Context) error {
+		return func(ctx context.Context) error {
+			_, err := s.List(ctx, "", "/")
+			return err
+		}
+	}
+	checks := []struct {
+		name       string
+		configured bool
+		probe      func(context.Context) error
+	}{
+		{"input", rt.InputStorage != nil, list(rt.InputStorage)},
+		{"output", rt.OutputStorage != nil, list(rt.OutputStorage)},
+		{"fonts", rt.FontStorage != nil, list(rt.FontStorage)},
+		{"kv", rt.KV != nil, func(ctx context.Context) error {
+			_, err := rt.KV.Get(ctx, healthKey)
+			return err
+		}},
+		{"catalog", rt.Catalog != nil, func(ctx context.Context) error {
+			_, err := rt.Catalog.Status(ctx, healthKey)
+			return err
+		}},
+	}
+
+	result := make([]StorageStatus, 0, len(checks))
+	for _, c := range checks {
+		status := StorageStatus{Name: c.name, Configured: c.configured}
+		if c.configured {
+			checkCtx, cancel := context.WithTimeout(ctx, healthTimeout)
+			start := time.Now()
+			err := c.probe(checkCtx)
+			cancel()
+			status.LatencyMs = time.Since(start).Milliseconds()
+			status.OK = err == nil
+			if err != nil {
+				status.Error = err.Error()
+			}
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// canary renders canarySource, preferring PNG since it exercises the fonts
+func canary(ctx context.Context, p runtime.Pipeline, formats []string) *CanaryStatus {
+	format := runtime.Format(formats[0])
+	for _, f := range formats {
+		if f == string(runtime.FormatPNG) {
+			format = runtime.FormatPNG
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, canaryTimeout)
+	defer cancel()
+	start := time.Now()
+	result, err := p.Process(ctx, []byte(canarySource), format)
+	status := &CanaryStatus{Format: string(format), DurationMs: time.Since(start).Milliseconds()}
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+	case result.SlideCount != 1 || len(result.Slides) != 1 || len(result.Slides[0]) == 0:
+		status.Error = fmt.Sprintf("expected 1 slide, got %d", len(result.Slides))
+	default:
+		status.OK = true
+		status.Slides = result.SlideCount
+	}
+	return status
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+)
+
+// MaxBodyBytes bounds request bodies read as deck source; 0 means no limit
+var MaxBodyBytes int64 = 4 << 20
+
+// overloadRetryAfter is the Retry-After, in seconds, sent when renders are refused for capacity
+const overloadRetryAfter = 5
+
+// readBody reads a deck source body, answering 413 when it exceeds MaxBodyBytes
+// It returns false once it has written an error response.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body := r.Body
+	if MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeLimitError(w, &pipeline.LimitError{Limit: pipeline.LimitBody, Max: tooLarge.Limit, Unit: "bytes"})
+			return nil, false
+		}
+		writeError(w, "Failed to read body", http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
+
+// writeLimitError answers a *pipeline.LimitError anywhere in err's chain,
+// reporting whether it did
+//
+//	413  body, source or slide count too large
+//	429  too many renders already queued
+//	503  no render slot within the queue timeout
+//	504  render timed out
+func writeLimitError(w http.ResponseWriter, err error) bool {
+	var lerr *pipeline.LimitError
+	if !errors.As(err, &lerr) {
+		return false
+	}
+
+	status := http.StatusRequestEntityTooLarge
+	switch lerr.Limit {
+	case pipeline.LimitTimeout:
+		status = http.StatusGatewayTimeout
+	case pipeline.LimitQueue:
+		status = http.StatusTooManyRequests
+	case pipeline.LimitQueueTimeout:
+		status = http.StatusServiceUnavailable
+	}
+	if lerr.Overloaded() {
+		w.Header().Set("Retry-After", strconv.Itoa(overloadRetryAfter))
+	}
+	writeJSONStatus(w, LimitErrorResponse{
+		Error:  lerr.Error(),
+		Limit:  lerr.Limit,
+		Max:    lerr.Max,
+		Actual: lerr.Actual,
+		Unit:   lerr.Unit,
+	}, status)
+	return true
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// RateLimiter throttles requests per client; nil disables rate limiting
+var RateLimiter runtime.RateLimiter
+
+// ReadRateLimiter throttles the read class instead of RateLimiter when set, so
+// the Worker spends KV operations on renders only
+var ReadRateLimiter runtime.RateLimiter
+
+// RenderRate limits endpoints that render or write (render and upload scope);
+// ReadRate limits everything else behind authorize
+var (
+	RenderRate = runtime.Rate{Limit: 30, Period: time.Minute, Burst: 10}
+	ReadRate   = runtime.Rate{Limit: 600, Period: time.Minute, Burst: 120}
+)
+
+// ClientIPHeader names a header holding the client address, set by a trusted
+// proxy (CF-Connecting-IP on Workers); empty uses the connection's address
+var ClientIPHeader string
+
+// allowRate takes a token from client's bucket for scope, answering 429 when
+// it is empty
+// Every response carries X-RateLimit-Limit, -Remaining and -Reset (seconds
+// until the bucket is full). Requests the limiter can't decide on go through,
+// so a KV outage doesn't take the API down with it.
+func allowRate(w http.ResponseWriter, r *http.Request, client, scope string) bool {
+	limiter, class, rate := RateLimiter, "read", ReadRate
+	if scope == ScopeRender || scope == ScopeUpload {
+		class, rate = "render", RenderRate
+	} else if ReadRateLimiter != nil {
+		limiter = ReadRateLimiter
+	}
+	if limiter == nil {
+		return true
+	}
+
+	// A decision made before a failed write still counts; with none, let it through
+	d, _ := limiter.Take(r.Context(), class+":"+client, rate)
+	if d.Limit == 0 {
+		return true
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+	if d.Allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+	writeJSONStatus(w, LimitErrorResponse{
+		Error: "Rate limit exceeded for " + class + " requests; retry in " + strconv.Itoa(seconds(d.RetryAfter)) + "s",
+		Limit: class + "Rate",
+		Max:   int64(d.Limit),
+		Unit:  "requests",
+	}, http.StatusTooManyRequests)
+	return false
+}
+
+// clientIP returns the address requests from the caller are counted under
+func clientIP(r *http.Request) string {
+	if ClientIPHeader != "" {
+		if value := r.Header.Get(ClientIPHeader); value != "" {
+			first, _, _ := strings.Cut(value, ",") // X-Forwarded-For lists the client first
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds d up to whole seconds for HTTP headers
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
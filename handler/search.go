@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/deckfs/processor"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// handleSearch searches decks by title, slide text, path and tags
+// Supports ?q= (all terms must match, by prefix), ?tag= and ?limit= (default 50)
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	tag := strings.ToLower(strings.TrimSpace(query.Get("tag")))
+
+	if len(processor.Tokenize(q)) == 0 && tag == "" {
+		writeError(w, "q or tag is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	hits, err := Processor.Search(r.Context(), q, tag, limit)
+	if writeNotConfigured(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, SearchResponse{
+		Query:   q,
+		Tag:     tag,
+		Results: hits,
+		Count:   len(hits),
+	})
+}
+
+// handleListTags lists every tag in use with its deck count
+func handleListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := Processor.AllTags(r.Context())
+	if writeNotConfigured(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to list tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, TagsResponse{
+		Tags:  tags,
+		Count: len(tags),
+	})
+}
+
+// handleDeckTags gets (GET) or replaces (PUT) the tags of a source key
+func handleDeckTags(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/tags/")
+
+	v := NewValidator()
+	v.RequireNonEmpty("key", key)
+	v.RequireNoPathTraversal("key", key)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, DeckTagsResponse{Key: key, Tags: Processor.Tags(ctx, key)})
+
+	case http.MethodPut:
+		var req DeckTagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		reader, err := runtime.Input().Get(ctx, key)
+		if err != nil || reader == nil {
+			writeError(w, "Source not found", http.StatusNotFound)
+			return
+		}
+		reader.Close()
+
+		tags, err := Processor.SetTags(ctx, key, req.Tags)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, DeckTagsResponse{Key: key, Tags: tags})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/deckfs/demo"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/pkg/thumbnail"
+	"github.com/joeblew999/deckfs/processor"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+var deckPage = template.Must(template.New("deck").Parse(demo.DeckPage))
+
+// authorizeThumb needs read scope for stored thumbnails, and render scope and
+// the render rate for ?w=, which rasterizes the deck on request
+func authorizeThumb(h http.HandlerFunc) http.HandlerFunc {
+	stored := authorize(ScopeRead, ScopeRead, h)
+	onDemand := authorize(ScopeRender, ScopeRender, h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("w") {
+			onDemand(w, r)
+			return
+		}
+		stored(w, r)
+	}
+}
+
+// handleThumb serves a preview image of a deck's first slide
+// Supports ?format=png|webp (default png) and ?w= for a width other than the stored one.
+// Without ?w= only the stored preview is served. Decks without one, and ?w= in
+// builds without the rasterizer (the Worker), redirect to the first slide's SVG.
+func handleThumb(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/thumb/")
+	query := r.URL.Query()
+	format := thumbnail.Format(query.Get("format"))
+	if format == "" {
+		format = thumbnail.PNG
+	}
+
+	v := NewValidator()
+	v.RequireNonEmpty("key", key)
+	v.RequireNoPathTraversal("key", key)
+	v.RequireOneOf("format", string(format), []string{string(thumbnail.PNG), string(thumbnail.WebP)})
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	width := 0
+	if s := query.Get("w"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < thumbnail.MinWidth || n > thumbnail.MaxWidth {
+			writeError(w, fmt.Sprintf("w must be between %d and %d", thumbnail.MinWidth, thumbnail.MaxWidth), http.StatusBadRequest)
+			return
+		}
+		width = n
+	}
+
+	data, err := Processor.Thumbnail(r.Context(), key, width, format)
+	if err != nil {
+		var perr *processor.Error
+		switch {
+		case errors.Is(err, thumbnail.ErrUnsupported), errors.Is(err, processor.ErrNoThumbnail):
+			http.Redirect(w, r, "/slides/"+processor.SlideKey(processor.BaseName(key), 1), http.StatusFound)
+		case errors.Is(err, processor.ErrNotRenderable):
+			writeError(w, "File is not a renderable deck", http.StatusBadRequest)
+		case errors.Is(err, runtime.ErrNotConfigured):
+			writeNotConfigured(w, err)
+		case writeLimitError(w, err):
+		case errors.As(err, &perr) && perr.Stage == processor.StageRead:
+			writeError(w, "Deck not found", http.StatusNotFound)
+		default:
+			writeError(w, fmt.Sprintf("Thumbnail failed: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(data)
+}
+
+// deckPageData fills demo/deck.html
+type deckPageData struct {
+	Title       string
+	Description string
+	Path        string
+	URL         string
+	Image       string
+	SlideURL    string
+	Slide       int
+	SlideCount  int
+	Prev, Next  int
+}
+
+// handleDeckPage serves an HTML page for a shared deck link
+// Chat apps and social sites read its Open Graph tags to show the title and a thumbnail.
+func handleDeckPage(w http.ResponseWriter, r *http.Request, examplePath string) {
+	v := NewValidator()
+	v.RequireNonEmpty("examplePath", examplePath)
+	v.RequireNoPathTraversal("examplePath", examplePath)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader, err := runtime.Input().Get(r.Context(), examplePath)
+	if writeNotConfigured(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, "Deck not found", http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+	source, err := io.ReadAll(reader)
+	if err != nil {
+		writeError(w, "Failed to read deck", http.StatusInternalServerError)
+		return
+	}
+	c := pipeline.Classify(source)
+	if c.Kind != pipeline.KindDeck {
+		writeError(w, "File is not a renderable deck (library file with only function definitions)", http.StatusBadRequest)
+		return
+	}
+
+	// Rendered decks know their real title and slide count; otherwise use the source estimate
+	title, slideCount := c.Title, c.SlideCount
+	if e := Processor.DeckEntry(r.Context(), examplePath); e != nil && e.Status == processor.StatusComplete {
+		title, slideCount = e.Title, e.SlideCount
+	}
+	if title == "" {
+		title = strings.TrimSuffix(examplePath[strings.LastIndex(examplePath, "/")+1:], ".dsh")
+	}
+
+	slide := 1
+	if n, err := strconv.Atoi(r.URL.Query().Get("slide")); err == nil && n > 1 {
+		slide = n
+	}
+	if slideCount > 0 && slide > slideCount {
+		slide = slideCount
+	}
+
+	base := baseURL(r)
+	data := deckPageData{
+		Title:       title,
+		Description: examplePath,
+		Path:        examplePath,
+		URL:         base + "/deck/" + examplePath,
+		Image:       base + "/thumb/" + examplePath,
+		SlideURL:    fmt.Sprintf("/deck/%s/slide/%d.svg", examplePath, slide),
+		Slide:       slide,
+		SlideCount:  slideCount,
+	}
+	if slideCount > 0 {
+		data.Description = fmt.Sprintf("%s · %s", examplePath, plural(slideCount, "slide"))
+	}
+	if slide > 1 {
+		data.Prev = slide - 1
+	}
+	if slideCount == 0 || slide < slideCount {
+		data.Next = slide + 1
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := deckPage.Execute(w, data); err != nil {
+		writeError(w, fmt.Sprintf("Failed to render page: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// baseURL returns the scheme and host the client used to reach this server
+// Workers see absolute request URLs; behind a proxy X-Forwarded-Proto wins.
+func baseURL(r *http.Request) string {
+	scheme, host := r.URL.Scheme, r.URL.Host
+	if host == "" {
+		host = r.Host
+	}
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + host
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -1,6 +1,14 @@
 
 package handler
 
+import (
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/pkg/deckdiff"
+	"github.com/joeblew999/deckfs/pkg/fonts"
+	"github.com/joeblew999/deckfs/processor"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
 // Response types for consistent API contracts across all platforms
 
 // ExamplesResponse is returned by /examples endpoint
@@ -14,6 +22,8 @@ type Example struct {
 	Name       string `json:"name"`
 	Path       string `json:"path"`
 	Renderable bool   `json:"renderable"`
+	Title      string `json:"title,omitempty"`      // First text on the first slide; set with renderable=true
+	SlideCount int    `json:"slideCount,omitempty"` // Estimated from the source; set with renderable=true
 }
 
 // ProcessResponse is returned by /process endpoint
@@ -23,6 +33,7 @@ type ProcessResponse struct {
 	SlideCount int      `json:"slideCount"`
 	Slides     []string `json:"slides"`
 	Format     string   `json:"format,omitempty"`
+	FontCSS    string   `json:"fontCss,omitempty"` // With ?sharedFonts=true, the stylesheet delivering every slide's fonts
 }
 
 // UploadResponse is returned by /upload endpoint
@@ -31,6 +42,8 @@ type UploadResponse struct {
 	Key        string   `json:"key"`
 	SlideCount int      `json:"slideCount"`
 	Slides     []string `json:"slides,omitempty"`
+	Library    bool     `json:"library,omitempty"` // Library file: dependents were re-rendered instead
+	Version    int      `json:"version,omitempty"`
 }
 
 // StatusResponse is returned by /status endpoint
@@ -40,17 +53,45 @@ type StatusResponse struct {
 	Error     string `json:"error,omitempty"`
 }
 
+// StatusListResponse is returned by /status endpoint
+type StatusListResponse struct {
+	Statuses []KeyStatus `json:"statuses"`
+	Count    int         `json:"count"`
+	Cursor   string      `json:"cursor,omitempty"`
+}
+
+// KeyStatus is the processing status of a single source key
+type KeyStatus struct {
+	Key string `json:"key"`
+	StatusResponse
+}
+
 // DecksResponse is returned by /decks endpoint
 type DecksResponse struct {
-	Decks []DeckInfo `json:"decks"`
-	Count int        `json:"count"`
+	Decks    []DeckInfo `json:"decks"`
+	Count    int        `json:"count"`
+	Total    int        `json:"total"`              // Decks matching the filters across all pages
+	Cursor   string     `json:"cursor,omitempty"`   // Pass back as ?cursor= for the next page
+	Indexing bool       `json:"indexing,omitempty"` // The one-time index backfill is running; older decks may be missing
 }
 
 // DeckInfo represents metadata about a deck
 type DeckInfo struct {
-	Key        string `json:"key"`
-	SlideCount int    `json:"slideCount,omitempty"`
-	ProcessedAt string `json:"processedAt,omitempty"`
+	Key          string `json:"key"`    // Output name, as used by /manifest and /slides
+	Source       string `json:"source"` // Source key
+	Title        string `json:"title,omitempty"`
+	SlideCount   int    `json:"slideCount"`
+	ProcessedAt  string `json:"processedAt,omitempty"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+	ETag         string `json:"etag,omitempty"` // Source version of the last successful render
+	UpdatedAt    string `json:"updatedAt,omitempty"`
+}
+
+// ReindexResponse is returned by POST /decks
+type ReindexResponse struct {
+	Indexed int `json:"indexed"`
 }
 
 // ManifestResponse is returned by /manifest endpoint
@@ -61,16 +102,168 @@ type ManifestResponse struct {
 	SlideCount  int    `json:"slideCount"`
 }
 
+// WebhookRequest is the body accepted by POST /webhooks
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// WebhooksResponse is returned by GET /webhooks
+type WebhooksResponse struct {
+	Webhooks []runtime.WebhookSubscription `json:"webhooks"`
+	Count    int                           `json:"count"`
+}
+
+// WebhookTestResponse is returned by POST /webhooks/:id/test
+type WebhookTestResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DeadLettersResponse is returned by GET /webhooks/:id/deadletters
+type DeadLettersResponse struct {
+	DeadLetters []runtime.WebhookDeadLetter `json:"deadLetters"`
+	Count       int                         `json:"count"`
+}
+
+// QueueDeadLettersResponse is returned by GET /deadletters
+type QueueDeadLettersResponse struct {
+	DeadLetters []processor.QueueDeadLetter `json:"deadLetters"`
+	Count       int                         `json:"count"`
+}
+
+// CatalogStatsResponse is returned by /catalog/stats endpoint
+type CatalogStatsResponse struct {
+	Stats []catalog.DailyStats `json:"stats"`
+	Count int                  `json:"count"`
+}
+
+// CatalogSourceResponse is returned by /catalog/sources/:key endpoint
+type CatalogSourceResponse struct {
+	catalog.SourceStatus
+	Runs []catalog.Run `json:"runs"`
+}
+
+// CatalogPendingResponse is returned by /catalog/pending endpoint
+type CatalogPendingResponse struct {
+	Keys  []string `json:"keys"`
+	Count int      `json:"count"`
+}
+
+// VersionsResponse is returned by GET /versions/:key
+type VersionsResponse struct {
+	Key      string              `json:"key"`
+	Versions []processor.Version `json:"versions"`
+	Count    int                 `json:"count"`
+}
+
+// RollbackResponse is returned by POST /versions/:key?version=N
+type RollbackResponse struct {
+	Success      bool     `json:"success"`
+	Key          string   `json:"key"`
+	RestoredFrom int      `json:"restoredFrom"`
+	Version      int      `json:"version"`
+	SlideCount   int      `json:"slideCount"`
+	Slides       []string `json:"slides,omitempty"`
+}
+
+// DiffResponse is returned by /diff endpoint
+type DiffResponse struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	*deckdiff.Report
+}
+
+// SearchResponse is returned by /search endpoint
+type SearchResponse struct {
+	Query   string                `json:"query,omitempty"`
+	Tag     string                `json:"tag,omitempty"`
+	Results []processor.SearchHit `json:"results"`
+	Count   int                   `json:"count"`
+}
+
+// TagsResponse is returned by GET /tags
+type TagsResponse struct {
+	Tags  []processor.TagCount `json:"tags"`
+	Count int                  `json:"count"`
+}
+
+// DeckTagsRequest is the body accepted by PUT /tags/:key
+type DeckTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// DeckTagsResponse is returned by /tags/:key endpoint
+type DeckTagsResponse struct {
+	Key  string   `json:"key"`
+	Tags []string `json:"tags"`
+}
+
+// FontsResponse is returned by POST /fonts/detect
+type FontsResponse struct {
+	Source string       `json:"source,omitempty"`
+	Fonts  []fonts.Font `json:"fonts"`
+	Count  int          `json:"count"`
+	// Store is false when no font store is configured, so availability is unknown
+	Store bool `json:"store"`
+}
+
 // ErrorResponse is returned for all error cases
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Success bool   `json:"success"`
 }
 
+// LimitErrorResponse is returned when a request exceeds a configured limit
+type LimitErrorResponse struct {
+	Error   string `json:"error"`
+	Success bool   `json:"success"`
+	Limit   string `json:"limit"` // Setting that was exceeded, e.g. maxSlides
+	Max     int64  `json:"max"`
+	Actual  int64  `json:"actual,omitempty"`
+	Unit    string `json:"unit"` // bytes, slides, ms or renders
+}
+
 // HealthResponse is returned by /health endpoint
+// Status is "ok", or "unavailable" (with a 503) when any check in Problems failed.
 type HealthResponse struct {
-	Status  string `json:"status"`
-	Runtime string `json:"runtime,omitempty"`
+	Status   string                `json:"status"`
+	Runtime  string                `json:"runtime,omitempty"`
+	Version  string                `json:"version,omitempty"`
+	Pipeline *runtime.PipelineInfo `json:"pipeline,omitempty"`
+	Formats  []string              `json:"formats,omitempty"`
+	Fonts    []FontStatus          `json:"fonts,omitempty"`
+	Storage  []StorageStatus       `json:"storage,omitempty"`
+	Canary   *CanaryStatus         `json:"canary,omitempty"` // Only with ?deep=true
+	Problems []string              `json:"problems,omitempty"`
+}
+
+// FontStatus reports whether the font behind an alias is available to PNG and PDF renders
+type FontStatus struct {
+	Alias     string `json:"alias"`
+	Family    string `json:"family"`
+	File      string `json:"file"`
+	Available bool   `json:"available"`
+	Required  bool   `json:"required"`
+}
+
+// StorageStatus reports whether a storage backend answered a cheap request
+type StorageStatus struct {
+	Name       string `json:"name"`
+	Configured bool   `json:"configured"`
+	OK         bool   `json:"ok"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CanaryStatus reports the test render made by /health?deep=true
+type CanaryStatus struct {
+	Format     string `json:"format"`
+	OK         bool   `json:"ok"`
+	Slides     int    `json:"slides"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
 }
 
 // RootResponse is returned by / endpoint
@@ -81,3 +274,30 @@ type RootResponse struct {
 	Endpoints []string `json:"endpoints"`
 	Formats   []string `json:"formats,omitempty"`
 }
+
+// APIKeyRequest is the body accepted by POST /auth/keys
+type APIKeyRequest struct {
+	Name     string   `json:"name,omitempty"`
+	Scopes   []string `json:"scopes"`
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// APIKeyResponse is returned by POST /auth/keys
+// Token is only revealed here; store it, as it can't be recovered.
+type APIKeyResponse struct {
+	APIKey
+	Token string `json:"token"`
+}
+
+// APIKeysResponse is returned by GET /auth/keys
+type APIKeysResponse struct {
+	Keys  []APIKey `json:"keys"`
+	Count int      `json:"count"`
+}
+
+// SignedURLResponse is returned by POST /auth/sign
+type SignedURLResponse struct {
+	URL     string `json:"url"`
+	Method  string `json:"method"`
+	Expires string `json:"expires"`
+}
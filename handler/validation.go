@@ -4,6 +4,8 @@ package handler
 import (
 	"fmt"
 	"strings"
+
+	"github.com/joeblew999/deckfs/processor"
 )
 
 // Validator provides request validation utilities
@@ -32,6 +34,13 @@ func (v *Validator) RequireNoPathTraversal(field, value string) {
 	}
 }
 
+// RequireNotReserved validates that a source key stays out of the output prefix deckfs keeps for itself
+func (v *Validator) RequireNotReserved(field, value string) {
+	if processor.IsReserved(value) {
+		v.errors = append(v.errors, fmt.Sprintf("%s must not start with %s", field, processor.ReservedDir))
+	}
+}
+
 // RequireValidFormat validates that format is one of the allowed formats
 func (v *Validator) RequireValidFormat(format string, allowedFormats []string) {
 	if format == "" {
@@ -47,6 +56,21 @@ func (v *Validator) RequireValidFormat(format string, allowedFormats []string) {
 	v.errors = append(v.errors, fmt.Sprintf("format must be one of: %s", strings.Join(allowedFormats, ", ")))
 }
 
+// RequireOneOf validates that an optional field is one of the allowed values
+func (v *Validator) RequireOneOf(field, value string, allowed []string) {
+	if value == "" {
+		return // Empty is OK, will use default
+	}
+
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+
+	v.errors = append(v.errors, fmt.Sprintf("%s must be one of: %s", field, strings.Join(allowed, ", ")))
+}
+
 // IsValid returns true if there are no validation errors
 func (v *Validator) IsValid() bool {
 	return len(v.errors) == 0
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/deckfs/processor"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// handleVersions serves the version history of a source key
+//
+//	GET  /versions/:key                     list retained versions
+//	GET  /versions/:key?version=N           source of version N
+//	GET  /versions/:key?version=N&slide=M   slide M as first rendered from version N
+//	POST /versions/:key?version=N           roll back to version N and re-render
+func handleVersions(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/versions/")
+
+	v := NewValidator()
+	v.RequireNonEmpty("key", key)
+	v.RequireNoPathTraversal("key", key)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	number := 0
+	if s := query.Get("version"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		number = n
+	}
+
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		if number == 0 {
+			versions, err := Processor.Versions(ctx, key)
+			if err != nil {
+				writeError(w, fmt.Sprintf("Failed to list versions: %v", err), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, VersionsResponse{
+				Key:      key,
+				Versions: versions,
+				Count:    len(versions),
+			})
+			return
+		}
+
+		if s := query.Get("slide"); s != "" {
+			handleVersionSlide(w, r, key, number, s)
+			return
+		}
+
+		source, err := Processor.VersionSource(ctx, key, number)
+		if errors.Is(err, processor.ErrVersionNotFound) {
+			writeError(w, "Version not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeError(w, fmt.Sprintf("Failed to read version: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(source)
+
+	case http.MethodPost:
+		if number == 0 {
+			writeError(w, "version is required", http.StatusBadRequest)
+			return
+		}
+
+		result, restored, err := Processor.Rollback(ctx, key, number)
+		if errors.Is(err, processor.ErrVersionNotFound) {
+			writeError(w, "Version not found", http.StatusNotFound)
+			return
+		}
+		if writeLimitError(w, err) {
+			return
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			var perr *processor.Error
+			if !errors.As(err, &perr) || perr.Retryable() {
+				status = http.StatusInternalServerError
+			}
+			writeError(w, fmt.Sprintf("Rollback failed: %v", err), status)
+			return
+		}
+
+		resp := RollbackResponse{
+			Success:      true,
+			Key:          key,
+			RestoredFrom: number,
+			SlideCount:   result.SlideCount,
+			Slides:       result.Slides,
+		}
+		if restored != nil {
+			resp.Version = restored.Number
+		}
+		writeJSON(w, resp)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleVersionSlide streams a slide snapshotted when a version was first rendered
+func handleVersionSlide(w http.ResponseWriter, r *http.Request, key string, number int, slideParam string) {
+	slide, err := strconv.Atoi(slideParam)
+	if err != nil || slide < 1 {
+		writeError(w, "Invalid slide number", http.StatusBadRequest)
+		return
+	}
+
+	version, err := Processor.Version(r.Context(), key, number)
+	if err != nil {
+		writeError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if !version.Rendered || slide > version.SlideCount {
+		writeError(w, "Slide not found", http.StatusNotFound)
+		return
+	}
+
+	reader, err := runtime.Output().Get(r.Context(), processor.VersionSlideKey(key, number, slide))
+	if writeNotConfigured(w, err) {
+		return
+	}
+	if err != nil || reader == nil {
+		writeError(w, "Slide not found", http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+
+	// Versions are immutable once snapshotted
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, reader)
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// EventWebhookTest is the event type sent by POST /webhooks/:id/test
+const EventWebhookTest = "webhook.test"
+
+// handleWebhooks lists (GET) or registers (POST) webhook subscriptions
+func handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks := runtime.Webhooks()
+	if webhooks == nil {
+		writeError(w, "Webhooks are not configured on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		subs, err := webhooks.Subscriptions(r.Context())
+		if err != nil {
+			writeError(w, fmt.Sprintf("Failed to list webhooks: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for i := range subs {
+			subs[i].Secret = "" // Secrets are only revealed on registration
+		}
+		writeJSON(w, WebhooksResponse{
+			Webhooks: subs,
+			Count:    len(subs),
+		})
+
+	case http.MethodPost:
+		var req WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		v := NewValidator()
+		v.RequireNonEmpty("url", req.URL)
+		if !v.IsValid() {
+			writeError(w, v.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sub, err := webhooks.Register(r.Context(), runtime.WebhookSubscription{
+			URL:    req.URL,
+			Secret: req.Secret,
+			Events: req.Events,
+		})
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeJSONStatus(w, sub, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhook routes /webhooks/:id, /webhooks/:id/test and /webhooks/:id/deadletters
+func handleWebhook(w http.ResponseWriter, r *http.Request) {
+	webhooks := runtime.Webhooks()
+	if webhooks == nil {
+		writeError(w, "Webhooks are not configured on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/webhooks/")
+	id, action, _ := strings.Cut(path, "/")
+
+	v := NewValidator()
+	v.RequireNonEmpty("id", id)
+	v.RequireNoPathTraversal("id", id)
+	if !v.IsValid() {
+		writeError(w, v.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub, err := webhooks.Subscription(r.Context(), id)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to load webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if sub == nil {
+		writeError(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		sub.Secret = ""
+		writeJSON(w, sub)
+
+	case action == "" && r.Method == http.MethodDelete:
+		if err := webhooks.Unregister(r.Context(), id); err != nil {
+			writeError(w, fmt.Sprintf("Failed to delete webhook: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "test" && r.Method == http.MethodPost:
+		data, _ := json.Marshal(runtime.Event{
+			Version: runtime.EventSchemaVersion,
+			Type:    EventWebhookTest,
+			Time:    time.Now().UTC().Format(time.RFC3339),
+		})
+		err := webhooks.Deliver(r.Context(), sub, runtime.EventSubject(EventWebhookTest), data)
+		if err != nil {
+			writeJSON(w, WebhookTestResponse{Success: false, Error: err.Error()})
+			return
+		}
+		writeJSON(w, WebhookTestResponse{Success: true})
+
+	case action == "deadletters" && r.Method == http.MethodGet:
+		letters, err := webhooks.DeadLetters(r.Context(), id)
+		if err != nil {
+			writeError(w, fmt.Sprintf("Failed to list dead letters: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, DeadLettersResponse{
+			DeadLetters: letters,
+			Count:       len(letters),
+		})
+
+	case action == "" || action == "test" || action == "deadletters":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,405 @@
+// Package deckdiff compares two parsed decks slide by slide
+//
+// Slides are aligned by content similarity, so inserting or deleting a slide
+// doesn't report every later slide as changed. Within aligned slides, elements
+// are matched by kind and then by text or position, and each pair reports which
+// of its text, position, size, color or style changed.
+package deckdiff
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ajstarks/deck"
+)
+
+// Slide and element change types
+const (
+	Unchanged = "unchanged"
+	Modified  = "modified"
+	Added     = "added"
+	Removed   = "removed"
+)
+
+// Changed fields reported for modified elements and slides
+const (
+	FieldText       = "text"
+	FieldPosition   = "position"
+	FieldSize       = "size"
+	FieldColor      = "color"
+	FieldStyle      = "style"
+	FieldBackground = "background"
+	FieldNote       = "note"
+)
+
+// minSimilarity is the lowest score at which two slides are aligned rather than
+// reported as one removed and one added slide
+const minSimilarity = 0.35
+
+// positionTolerance is how far (in canvas percent) an element may drift and
+// still count as unmoved
+const positionTolerance = 0.5
+
+// Element is a flattened deck element; coordinates are canvas percentages with
+// Y measured from the bottom, as in deck markup
+type Element struct {
+	Kind    string  `json:"kind"` // text, list, image, rect, ellipse, line, curve, arc, polygon, polyline
+	Text    string  `json:"text,omitempty"`
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+	W       float64 `json:"w,omitempty"`
+	H       float64 `json:"h,omitempty"`
+	Size    float64 `json:"size,omitempty"`
+	Align   string  `json:"align,omitempty"`
+	Color   string  `json:"color,omitempty"`
+	Opacity float64 `json:"opacity,omitempty"`
+	Font    string  `json:"font,omitempty"`
+	Extra   string  `json:"extra,omitempty"` // Kind-specific attributes (arc angles, caption, ...)
+}
+
+// ElementChange is an added, removed or modified element
+type ElementChange struct {
+	Change string   `json:"change"`
+	Kind   string   `json:"kind"`
+	Fields []string `json:"fields,omitempty"`
+	Before *Element `json:"before,omitempty"`
+	After  *Element `json:"after,omitempty"`
+}
+
+// SlideDiff compares one slide of A with its aligned slide of B
+// Before and After are 1-based slide numbers; 0 means the slide doesn't exist on that side.
+type SlideDiff struct {
+	Change   string          `json:"change"`
+	Before   int             `json:"before,omitempty"`
+	After    int             `json:"after,omitempty"`
+	Fields   []string        `json:"fields,omitempty"`
+	Elements []ElementChange `json:"elements,omitempty"`
+}
+
+// Report is the result of comparing two decks
+type Report struct {
+	TitleBefore  string      `json:"titleBefore,omitempty"`
+	TitleAfter   string      `json:"titleAfter,omitempty"`
+	SlidesBefore int         `json:"slidesBefore"`
+	SlidesAfter  int         `json:"slidesAfter"`
+	Added        int         `json:"added"`
+	Removed      int         `json:"removed"`
+	Modified     int         `json:"modified"`
+	Unchanged    int         `json:"unchanged"`
+	Slides       []SlideDiff `json:"slides"`
+}
+
+// Identical reports whether the decks have no slide changes
+func (r *Report) Identical() bool {
+	return r.Added == 0 && r.Removed == 0 && r.Modified == 0
+}
+
+// Compare aligns the slides of a and b and diffs each aligned pair
+func Compare(a, b *deck.Deck) *Report {
+	report := &Report{
+		TitleBefore:  a.Title,
+		TitleAfter:   b.Title,
+		SlidesBefore: len(a.Slide),
+		SlidesAfter:  len(b.Slide),
+		Slides:       make([]SlideDiff, 0, max(len(a.Slide), len(b.Slide))),
+	}
+
+	before := make([][]Element, len(a.Slide))
+	for i := range a.Slide {
+		before[i] = Flatten(a.Slide[i])
+	}
+	after := make([][]Element, len(b.Slide))
+	for j := range b.Slide {
+		after[j] = Flatten(b.Slide[j])
+	}
+
+	for _, pair := range align(before, after) {
+		var diff SlideDiff
+		switch {
+		case pair.a < 0:
+			diff = SlideDiff{Change: Added, After: pair.b + 1}
+			report.Added++
+		case pair.b < 0:
+			diff = SlideDiff{Change: Removed, Before: pair.a + 1}
+			report.Removed++
+		default:
+			diff = compareSlides(a.Slide[pair.a], b.Slide[pair.b], before[pair.a], after[pair.b])
+			diff.Before, diff.After = pair.a+1, pair.b+1
+			if diff.Change == Modified {
+				report.Modified++
+			} else {
+				report.Unchanged++
+			}
+		}
+		report.Slides = append(report.Slides, diff)
+	}
+	return report
+}
+
+// Flatten lists the elements of a slide in a kind-independent form
+func Flatten(s deck.Slide) []Element {
+	var elems []Element
+	for _, t := range s.Text {
+		elems = append(elems, Element{Kind: "text", Text: strings.TrimSpace(t.Tdata), X: t.Xp, Y: t.Yp, W: t.Wp, Size: t.Sp,
+			Align: t.Align, Color: t.Color, Opacity: t.Opacity, Font: t.Font, Extra: joinNonEmpty(t.Type, t.File, t.Link)})
+	}
+	for _, l := range s.List {
+		items := make([]string, len(l.Li))
+		for i, li := range l.Li {
+			items[i] = strings.TrimSpace(li.ListText)
+		}
+		elems = append(elems, Element{Kind: "list", Text: strings.Join(items, "\n"), X: l.Xp, Y: l.Yp, W: l.Wp, Size: l.Sp,
+			Align: l.Align, Color: l.Color, Opacity: l.Opacity, Font: l.Font, Extra: l.Type})
+	}
+	for _, img := range s.Image {
+		elems = append(elems, Element{Kind: "image", Text: img.Name, X: img.Xp, Y: img.Yp,
+			W: float64(img.Width), H: float64(img.Height), Size: img.Scale, Opacity: img.Opacity,
+			Extra: joinNonEmpty(img.Caption, img.Autoscale, img.Link)})
+	}
+	for _, r := range s.Rect {
+		elems = append(elems, dimension("rect", r.Dimension))
+	}
+	for _, e := range s.Ellipse {
+		elems = append(elems, dimension("ellipse", e.Dimension))
+	}
+	for _, a := range s.Arc {
+		e := dimension("arc", a.Dimension)
+		e.Size = a.Sp
+		e.Opacity = a.Opacity
+		e.Extra = fmt.Sprintf("%g-%g", a.A1, a.A2)
+		elems = append(elems, e)
+	}
+	for _, l := range s.Line {
+		elems = append(elems, span("line", []float64{l.Xp1, l.Xp2}, []float64{l.Yp1, l.Yp2}, l.Sp, l.Color, l.Opacity))
+	}
+	for _, c := range s.Curve {
+		elems = append(elems, span("curve", []float64{c.Xp1, c.Xp2, c.Xp3}, []float64{c.Yp1, c.Yp2, c.Yp3}, c.Sp, c.Color, c.Opacity))
+	}
+	for _, p := range s.Polygon {
+		e := span("polygon", coords(p.XC), coords(p.YC), 0, p.Color, p.Opacity)
+		e.Extra = p.XC + "|" + p.YC
+		elems = append(elems, e)
+	}
+	for _, p := range s.Polyline {
+		e := span("polyline", coords(p.XC), coords(p.YC), p.Sp, p.Color, p.Opacity)
+		e.Extra = p.XC + "|" + p.YC
+		elems = append(elems, e)
+	}
+	return elems
+}
+
+func dimension(kind string, d deck.Dimension) Element {
+	return Element{Kind: kind, X: d.Xp, Y: d.Yp, W: d.Wp, H: d.Hp, Color: d.Color, Opacity: d.Opacity,
+		Extra: joinNonEmpty(fmt.Sprintf("hr=%g,hw=%g", d.Hr, d.Hw), d.Gradcolor1, d.Gradcolor2)}
+}
+
+// span describes a point-list element by the centre and extent of its bounding box
+func span(kind string, xs, ys []float64, size float64, color string, opacity float64) Element {
+	minX, maxX := bounds(xs)
+	minY, maxY := bounds(ys)
+	return Element{Kind: kind, X: (minX + maxX) / 2, Y: (minY + maxY) / 2, W: maxX - minX, H: maxY - minY,
+		Size: size, Color: color, Opacity: opacity}
+}
+
+func bounds(vs []float64) (lo, hi float64) {
+	if len(vs) == 0 {
+		return 0, 0
+	}
+	lo, hi = vs[0], vs[0]
+	for _, v := range vs[1:] {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	return lo, hi
+}
+
+func coords(s string) []float64 {
+	var vs []float64
+	for _, f := range strings.Fields(s) {
+		if v, err := strconv.ParseFloat(f, 64); err == nil {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// changedFields lists what differs between two elements of the same kind
+func changedFields(a, b Element) []string {
+	var fields []string
+	if a.Text != b.Text {
+		fields = append(fields, FieldText)
+	}
+	if math.Abs(a.X-b.X) > positionTolerance || math.Abs(a.Y-b.Y) > positionTolerance {
+		fields = append(fields, FieldPosition)
+	}
+	if a.W != b.W || a.H != b.H || a.Size != b.Size {
+		fields = append(fields, FieldSize)
+	}
+	if a.Color != b.Color {
+		fields = append(fields, FieldColor)
+	}
+	if a.Opacity != b.Opacity || a.Font != b.Font || a.Align != b.Align || a.Extra != b.Extra {
+		fields = append(fields, FieldStyle)
+	}
+	return fields
+}
+
+func samePosition(a, b Element) bool {
+	return math.Abs(a.X-b.X) <= positionTolerance && math.Abs(a.Y-b.Y) <= positionTolerance
+}
+
+// elementPair is a match between a[i] and b[j]
+type elementPair struct {
+	i, j  int
+	score float64
+}
+
+// matchElements pairs elements of the same kind, strongest evidence first:
+// identical, then same text (moved or restyled), then same position (edited),
+// then document order. Unpaired elements were added or removed.
+func matchElements(a, b []Element) []elementPair {
+	usedA := make([]bool, len(a))
+	usedB := make([]bool, len(b))
+	var pairs []elementPair
+
+	tiers := []struct {
+		score float64
+		match func(x, y Element) bool
+	}{
+		{1, func(x, y Element) bool { return len(changedFields(x, y)) == 0 }},
+		{0.75, func(x, y Element) bool { return x.Text != "" && x.Text == y.Text }},
+		{0.75, samePosition},
+		{0.25, func(x, y Element) bool { return true }},
+	}
+	for _, tier := range tiers {
+		for i := range a {
+			if usedA[i] {
+				continue
+			}
+			for j := range b {
+				if usedB[j] || a[i].Kind != b[j].Kind || !tier.match(a[i], b[j]) {
+					continue
+				}
+				usedA[i], usedB[j] = true, true
+				pairs = append(pairs, elementPair{i, j, tier.score})
+				break
+			}
+		}
+	}
+	return pairs
+}
+
+// similarity scores two flattened slides from 0 (unrelated) to 1 (identical)
+func similarity(a, b []Element) float64 {
+	n := max(len(a), len(b))
+	if n == 0 {
+		return 1
+	}
+	total := 0.0
+	for _, p := range matchElements(a, b) {
+		total += p.score
+	}
+	return total / float64(n)
+}
+
+// slidePair aligns slide a of A with slide b of B; -1 marks a gap
+type slidePair struct {
+	a, b int
+}
+
+// align finds the order-preserving slide alignment with the highest total
+// similarity (a weighted longest common subsequence)
+func align(a, b [][]Element) []slidePair {
+	sim := make([][]float64, len(a))
+	for i := range a {
+		sim[i] = make([]float64, len(b))
+		for j := range b {
+			sim[i][j] = similarity(a[i], b[j])
+		}
+	}
+
+	score := make([][]float64, len(a)+1)
+	for i := range score {
+		score[i] = make([]float64, len(b)+1)
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			best := math.Max(score[i-1][j], score[i][j-1])
+			if s := sim[i-1][j-1]; s >= minSimilarity {
+				best = math.Max(best, score[i-1][j-1]+s)
+			}
+			score[i][j] = best
+		}
+	}
+
+	var pairs []slidePair
+	i, j := len(a), len(b)
+	for i > 0 || j > 0 {
+		switch {
+		case i > 0 && j > 0 && sim[i-1][j-1] >= minSimilarity && score[i][j] == score[i-1][j-1]+sim[i-1][j-1]:
+			pairs = append(pairs, slidePair{i - 1, j - 1})
+			i, j = i-1, j-1
+		case j > 0 && (i == 0 || score[i][j] == score[i][j-1]):
+			pairs = append(pairs, slidePair{-1, j - 1})
+			j--
+		default:
+			pairs = append(pairs, slidePair{i - 1, -1})
+			i--
+		}
+	}
+
+	for l, r := 0, len(pairs)-1; l < r; l, r = l+1, r-1 {
+		pairs[l], pairs[r] = pairs[r], pairs[l]
+	}
+	return pairs
+}
+
+// compareSlides diffs two aligned slides
+func compareSlides(sa, sb deck.Slide, a, b []Element) SlideDiff {
+	diff := SlideDiff{Change: Unchanged}
+
+	if sa.Bg != sb.Bg || sa.Fg != sb.Fg || sa.Gradcolor1 != sb.Gradcolor1 || sa.Gradcolor2 != sb.Gradcolor2 || sa.GradPercent != sb.GradPercent {
+		diff.Fields = append(diff.Fields, FieldBackground)
+	}
+	if strings.TrimSpace(sa.Note) != strings.TrimSpace(sb.Note) {
+		diff.Fields = append(diff.Fields, FieldNote)
+	}
+
+	pairs := matchElements(a, b)
+	pairedA := make([]bool, len(a))
+	pairedB := make([]bool, len(b))
+	for _, p := range pairs {
+		pairedA[p.i], pairedB[p.j] = true, true
+		if fields := changedFields(a[p.i], b[p.j]); len(fields) > 0 {
+			diff.Elements = append(diff.Elements, ElementChange{
+				Change: Modified, Kind: a[p.i].Kind, Fields: fields, Before: &a[p.i], After: &b[p.j],
+			})
+		}
+	}
+	for i := range a {
+		if !pairedA[i] {
+			diff.Elements = append(diff.Elements, ElementChange{Change: Removed, Kind: a[i].Kind, Before: &a[i]})
+		}
+	}
+	for j := range b {
+		if !pairedB[j] {
+			diff.Elements = append(diff.Elements, ElementChange{Change: Added, Kind: b[j].Kind, After: &b[j]})
+		}
+	}
+
+	if len(diff.Fields) > 0 || len(diff.Elements) > 0 {
+		diff.Change = Modified
+	}
+	return diff
+}
@@ -0,0 +1,122 @@
+package deckdiff
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+)
+
+func parse(t *testing.T, source string) *deck.Deck {
+	t.Helper()
+	d, err := pipeline.Parse(context.Background(), []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+const base = `deck
+slide "white" "black"
+ctext "Intro" 50 50 5
+rect 20 20 10 10 "red"
+eslide
+slide "white" "black"
+ctext "Details" 50 80 4
+text "first point" 10 60 3
+eslide
+edeck
+`
+
+func TestCompare_Identical(t *testing.T) {
+	r := Compare(parse(t, base), parse(t, base))
+	if !r.Identical() || r.Unchanged != 2 {
+		t.Fatalf("report = %+v", r)
+	}
+}
+
+func TestCompare_ElementChanges(t *testing.T) {
+	changed := strings.NewReplacer(
+		`rect 20 20 10 10 "red"`, `rect 30 20 10 10 "blue"`,
+		`"first point"`, `"first point, revised"`,
+	).Replace(base)
+
+	r := Compare(parse(t, base), parse(t, changed))
+	if r.Modified != 2 || r.Added != 0 || r.Removed != 0 {
+		t.Fatalf("report = %+v", r)
+	}
+
+	rect := r.Slides[0].Elements
+	if len(rect) != 1 || rect[0].Kind != "rect" || !slices.Equal(rect[0].Fields, []string{FieldPosition, FieldColor}) {
+		t.Errorf("slide 1 changes = %+v", rect)
+	}
+	text := r.Slides[1].Elements
+	if len(text) != 1 || text[0].Kind != "text" || !slices.Equal(text[0].Fields, []string{FieldText}) {
+		t.Errorf("slide 2 changes = %+v", text)
+	}
+}
+
+func TestCompare_InsertedSlideKeepsAlignment(t *testing.T) {
+	inserted := strings.Replace(base, "edeck", `slide "white" "black"
+ctext "Summary" 50 50 5
+eslide
+edeck`, 1)
+	inserted = strings.Replace(inserted, `slide "white" "black"
+ctext "Details"`, `slide "black" "white"
+ctext "New section" 50 50 6
+eslide
+slide "white" "black"
+ctext "Details"`, 1)
+
+	r := Compare(parse(t, base), parse(t, inserted))
+	if r.Added != 2 || r.Unchanged != 2 || r.Modified != 0 || r.Removed != 0 {
+		t.Fatalf("report = %+v", r)
+	}
+	want := []SlideDiff{
+		{Change: Unchanged, Before: 1, After: 1},
+		{Change: Added, After: 2},
+		{Change: Unchanged, Before: 2, After: 3},
+		{Change: Added, After: 4},
+	}
+	for i, s := range r.Slides {
+		if s.Change != want[i].Change || s.Before != want[i].Before || s.After != want[i].After {
+			t.Errorf("slide %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+}
+
+func TestCompare_RemovedSlideAndBackground(t *testing.T) {
+	removed := `deck
+slide "gray" "black"
+ctext "Intro" 50 50 5
+rect 20 20 10 10 "red"
+eslide
+edeck
+`
+	r := Compare(parse(t, base), parse(t, removed))
+	if r.Removed != 1 || r.Modified != 1 {
+		t.Fatalf("report = %+v", r)
+	}
+	if !slices.Equal(r.Slides[0].Fields, []string{FieldBackground}) {
+		t.Errorf("slide 1 fields = %v", r.Slides[0].Fields)
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	changed := strings.Replace(base, `rect 20 20 10 10 "red"`, `rect 30 20 10 10 "red"`, 1)
+	r := Compare(parse(t, base), parse(t, changed))
+
+	var buf bytes.Buffer
+	SideBySide(&buf, r.Slides[0], []byte("<svg/>"), []byte("<svg/>"), 792, 612)
+	out := buf.String()
+	if !strings.Contains(out, "data:image/svg+xml;base64,") || !strings.Contains(out, highlightColors[Modified]) {
+		t.Errorf("svg = %s", out)
+	}
+	if strings.Count(out, "stroke-dasharray") != 2 {
+		t.Errorf("expected a highlight on each side: %s", out)
+	}
+}
@@ -0,0 +1,133 @@
+package deckdiff
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	svg "github.com/ajstarks/svgo/float"
+)
+
+// Side-by-side layout, in output pixels
+const (
+	panelWidth  = 800.0
+	panelMargin = 20.0
+	labelHeight = 30.0
+)
+
+// Highlight colors by change type
+var highlightColors = map[string]string{
+	Added:    "rgb(0,160,60)",
+	Removed:  "rgb(220,30,30)",
+	Modified: "rgb(240,140,0)",
+}
+
+// SideBySide writes an SVG with the before slide on the left and the after
+// slide on the right, outlining removed (red), added (green) and modified
+// (orange) elements. before or after is nil for an added or removed slide;
+// canvasWidth and canvasHeight give the deck's aspect ratio.
+func SideBySide(w io.Writer, diff SlideDiff, before, after []byte, canvasWidth, canvasHeight float64) {
+	pw := panelWidth
+	ph := pw * canvasHeight / canvasWidth
+	leftX := panelMargin
+	rightX := 2*panelMargin + pw
+	top := labelHeight + panelMargin
+
+	doc := svg.New(w)
+	doc.Start(2*pw+3*panelMargin, ph+top+panelMargin)
+	doc.Rect(0, 0, 2*pw+3*panelMargin, ph+top+panelMargin, "fill:white")
+
+	label := "font-family:sans-serif;font-size:16px;fill:rgb(60,60,60)"
+	doc.Text(leftX, labelHeight, slideLabel("A", diff.Before, diff.Change), label)
+	doc.Text(rightX, labelHeight, slideLabel("B", diff.After, diff.Change), label)
+
+	panel(doc, before, leftX, top, pw, ph)
+	panel(doc, after, rightX, top, pw, ph)
+
+	for _, ec := range diff.Elements {
+		style := fmt.Sprintf("fill:none;stroke:%s;stroke-width:3;stroke-dasharray:8,4", highlightColors[ec.Change])
+		if ec.Before != nil {
+			x, y, bw, bh := box(*ec.Before, leftX, top, pw, ph, canvasWidth)
+			doc.Rect(x, y, bw, bh, style)
+		}
+		if ec.After != nil {
+			x, y, bw, bh := box(*ec.After, rightX, top, pw, ph, canvasWidth)
+			doc.Rect(x, y, bw, bh, style)
+		}
+	}
+
+	doc.End()
+}
+
+func slideLabel(side string, number int, change string) string {
+	if number == 0 {
+		return side + ": (none)"
+	}
+	return fmt.Sprintf("%s: slide %d (%s)", side, number, change)
+}
+
+// panel embeds a rendered slide, or a placeholder when the slide doesn't exist
+func panel(doc *svg.SVG, slide []byte, x, y, w, h float64) {
+	if slide == nil {
+		doc.Rect(x, y, w, h, "fill:rgb(240,240,240);stroke:rgb(200,200,200)")
+		return
+	}
+	href := "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(slide)
+	doc.Image(x, y, int(w), int(h), href)
+	doc.Rect(x, y, w, h, "fill:none;stroke:rgb(200,200,200)")
+}
+
+// box approximates the on-panel bounding box of an element
+// Deck coordinates are percentages with Y from the bottom; text extents are
+// estimated from font size and character count.
+func box(e Element, px, py, pw, ph, canvasWidth float64) (x, y, w, h float64) {
+	cx := px + e.X/100*pw
+	cy := py + (1-e.Y/100)*ph
+
+	switch e.Kind {
+	case "text", "list":
+		fs := e.Size / 100 * pw
+		lines := strings.Split(e.Text, "\n")
+		longest := 0
+		for _, l := range lines {
+			longest = max(longest, len(l))
+		}
+		w = e.W / 100 * pw
+		if w == 0 {
+			w = 0.6 * fs * float64(longest)
+		}
+		h = fs * 1.4 * float64(len(lines))
+		x, y = cx, cy-fs
+		switch e.Align {
+		case "c", "center", "middle", "mid":
+			x -= w / 2
+		case "e", "end", "right":
+			x -= w
+		}
+	case "image":
+		scale := 1.0
+		if e.Size > 0 {
+			scale = e.Size / 100
+		}
+		w = e.W * scale / canvasWidth * pw
+		h = e.H * scale / canvasWidth * pw
+		x, y = cx-w/2, cy-h/2
+	default:
+		w = e.W / 100 * pw
+		h = e.H / 100 * ph
+		x, y = cx-w/2, cy-h/2
+	}
+
+	// Pad, and keep zero-area elements (points, horizontal lines) visible
+	const pad, minSize = 4.0, 12.0
+	x, y, w, h = x-pad, y-pad, w+2*pad, h+2*pad
+	if w < minSize {
+		x, w = x-(minSize-w)/2, minSize
+	}
+	if h < minSize {
+		y, h = y-(minSize-h)/2, minSize
+	}
+	return math.Round(x), math.Round(y), math.Round(w), math.Round(h)
+}
@@ -0,0 +1,121 @@
+package fonts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FontMap maps the sans, serif and mono aliases to the CSS font-family stacks
+// SVG slides are written with
+// Both pipelines draw every other family with the sans stack, as svgdeck does.
+type FontMap map[string]string
+
+// DefaultFontMap holds the stacks the WASM pipeline has always written
+var DefaultFontMap = FontMap{
+	Sans:  "Helvetica, Arial, sans-serif",
+	Serif: "Georgia, Times, serif",
+	Mono:  "Monaco, Consolas, monospace",
+}
+
+// svgdeckFamilies are the font names svgdeck writes for each alias by default
+var svgdeckFamilies = map[string]string{
+	"Helvetica":   Sans,
+	"Times-Roman": Serif,
+	"Courier":     Mono,
+}
+
+// Stack returns the stack a deck font name is drawn with
+func (m FontMap) Stack(name string) string {
+	if _, ok := DefaultFontMap[name]; !ok {
+		name = Sans
+	}
+	if stack, ok := m[name]; ok {
+		return stack
+	}
+	return DefaultFontMap[name]
+}
+
+// Alias returns the alias a font-family value stands for
+// It knows the map's stacks, the default stacks and svgdeck's font names.
+func (m FontMap) Alias(value string) (string, bool) {
+	for _, stacks := range []FontMap{m, DefaultFontMap} {
+		aliases := make([]string, 0, len(stacks))
+		for alias := range stacks {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			if stacks[alias] == value {
+				return alias, true
+			}
+		}
+	}
+	alias, ok := svgdeckFamilies[value]
+	return alias, ok
+}
+
+// RewriteSVG rewrites the font-family declarations of a native (svgdeck) slide
+// to the map's stacks, so it names the same fonts as the WASM pipeline's output
+func (m FontMap) RewriteSVG(svg []byte) []byte {
+	stacks := map[string]bool{}
+	for alias := range DefaultFontMap {
+		stacks[m.Stack(alias)] = true
+	}
+	return fontFamilyDecl.ReplaceAllFunc(svg, func(decl []byte) []byte {
+		value := strings.TrimSpace(string(fontFamilyDecl.FindSubmatch(decl)[1]))
+		if stacks[value] {
+			return decl
+		}
+		if alias, ok := svgdeckFamilies[value]; ok {
+			value = alias
+		}
+		return []byte("font-family:" + m.Stack(value))
+	})
+}
+
+// Validate reports an unknown alias or a stack that can't be written into a
+// style attribute
+func (m FontMap) Validate() error {
+	for alias, stack := range m {
+		if _, ok := DefaultFontMap[alias]; !ok {
+			return fmt.Errorf("font map: unknown alias %q (want sans, serif or mono)", alias)
+		}
+		if strings.TrimSpace(stack) == "" || strings.ContainsAny(stack, "\";<>&") {
+			return fmt.Errorf("font map: invalid stack %q for %s", stack, alias)
+		}
+	}
+	return nil
+}
+
+// LoadFontMap reads a JSON object of alias to stack, such as
+// {"sans": "'Fira Sans', Helvetica, sans-serif"}
+// Aliases the file leaves out keep their DefaultFontMap stack.
+func LoadFontMap(path string) (FontMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFontMap(data)
+}
+
+// ParseFontMap parses a JSON font map over the defaults
+func ParseFontMap(data []byte) (FontMap, error) {
+	var overrides FontMap
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("font map: %w", err)
+	}
+	if err := overrides.Validate(); err != nil {
+		return nil, err
+	}
+	m := FontMap{}
+	for alias, stack := range DefaultFontMap {
+		m[alias] = stack
+	}
+	for alias, stack := range overrides {
+		m[alias] = strings.TrimSpace(stack)
+	}
+	return m, nil
+}
@@ -0,0 +1,61 @@
+package fonts
+
+import (
+	"strings"
+	"testing"
+)
+
+// svgdeckSlide is shaped like svgdeck output: bare font names, "sans" for
+// unknown families and list item fonts written as given
+const svgdeckSlide = `<svg width="792" height="612">
+<text style="fill:black;font-size:12px;font-family:Helvetica;text-anchor:start">a</text>
+<g style="fill-opacity:1.00;fill:black;font-family:Times-Roman;font-size:9px"><text>b</text></g>
+<text style="font-size:12px;font-family:sans;text-anchor:start">c</text>
+<text style="fill-opacity:1.00;fill:red;font-family:Roboto">d</text>
+<text style="font-family:Courier">e</text>
+</svg>`
+
+func TestFontMap_RewriteSVG(t *testing.T) {
+	var m FontMap // nil: the WASM pipeline's defaults
+	svg := string(m.RewriteSVG([]byte(svgdeckSlide)))
+	for _, want := range []string{
+		"font-family:Helvetica, Arial, sans-serif;text-anchor:start\">a",
+		"font-family:Georgia, Times, serif;font-size:9px",
+		"font-family:Helvetica, Arial, sans-serif;text-anchor:start\">c",
+		"font-family:Helvetica, Arial, sans-serif\">d",
+		"font-family:Monaco, Consolas, monospace\">e",
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("missing %q:\n%s", want, svg)
+		}
+	}
+	if again := string(m.RewriteSVG([]byte(svg))); again != svg {
+		t.Errorf("rewrite is not idempotent:\n%s", again)
+	}
+
+	custom, err := ParseFontMap([]byte(`{"mono": "'Fira Mono', monospace"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg = string(custom.RewriteSVG([]byte(svgdeckSlide)))
+	if !strings.Contains(svg, "font-family:'Fira Mono', monospace\">e") || !strings.Contains(svg, "font-family:Georgia, Times, serif") {
+		t.Errorf("custom map not applied:\n%s", svg)
+	}
+	if alias, ok := custom.Alias("'Fira Mono', monospace"); !ok || alias != Mono {
+		t.Errorf("Alias = %q, %v", alias, ok)
+	}
+}
+
+func TestParseFontMap_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		`{"symbol": "Dingbats"}`,
+		`{"sans": ""}`,
+		`{"sans": "x\"><script>"}`,
+		`{"serif": "Georgia; fill:red"}`,
+		`[]`,
+	} {
+		if _, err := ParseFontMap([]byte(raw)); err == nil {
+			t.Errorf("ParseFontMap(%s) accepted", raw)
+		}
+	}
+}
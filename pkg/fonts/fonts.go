@@ -0,0 +1,127 @@
+// Package fonts reports which fonts a deck uses and whether they can be rendered
+package fonts
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ajstarks/deck"
+)
+
+// Generic aliases understood by every deck renderer
+const (
+	Sans   = "sans"
+	Serif  = "serif"
+	Mono   = "mono"
+	Symbol = "symbol"
+)
+
+// Element names reported in a Usage
+const (
+	ElementText     = "text"
+	ElementList     = "list"
+	ElementListItem = "list-item"
+	ElementImage    = "image" // caption text
+)
+
+// snippetLen caps the text quoted in a Usage
+const snippetLen = 40
+
+// Usage is one place a font is used
+type Usage struct {
+	Slide   int    `json:"slide"`   // 1-based
+	Element string `json:"element"` // text, list, list-item or image
+	Index   int    `json:"index"`   // 1-based position among the slide's elements of that kind
+	Text    string `json:"text,omitempty"`
+}
+
+// Font is a font family used by a deck
+type Font struct {
+	Family string `json:"family"`
+	Alias  bool   `json:"alias"`
+	// Fallback is what pngdeck and pdfdeck draw instead: they only resolve the
+	// aliases, so every other family is rendered as sans
+	Fallback  string  `json:"fallback,omitempty"`
+	Available *bool   `json:"available,omitempty"` // nil when no font store is configured
+	Usages    []Usage `json:"usages"`
+}
+
+// IsAlias reports whether name is a generic alias rather than a family name
+func IsAlias(name string) bool {
+	switch name {
+	case Sans, Serif, Mono, Symbol:
+		return true
+	}
+	return false
+}
+
+// Detect returns every font family used by d, sorted by name
+// d should be parsed after import expansion so library functions are included.
+// Elements without a font use sans, like the renderers; list items without one
+// inherit the list's font and are not reported separately.
+func Detect(d *deck.Deck) []Font {
+	byFamily := map[string]*Font{}
+	add := func(family string, u Usage) {
+		if family == "" {
+			family = Sans
+		}
+		f, ok := byFamily[family]
+		if !ok {
+			f = &Font{Family: family, Alias: IsAlias(family)}
+			if !f.Alias {
+				f.Fallback = Sans
+			}
+			byFamily[family] = f
+		}
+		f.Usages = append(f.Usages, u)
+	}
+
+	for i, slide := range d.Slide {
+		n := i + 1
+		for j, t := range slide.Text {
+			add(t.Font, Usage{Slide: n, Element: ElementText, Index: j + 1, Text: snippet(t.Tdata)})
+		}
+		for j, l := range slide.List {
+			add(l.Font, Usage{Slide: n, Element: ElementList, Index: j + 1})
+			for _, li := range l.Li {
+				if li.Font != "" && li.Font != l.Font {
+					add(li.Font, Usage{Slide: n, Element: ElementListItem, Index: j + 1, Text: snippet(li.ListText)})
+				}
+			}
+		}
+		for j, im := range slide.Image {
+			if im.Caption != "" {
+				add(im.Font, Usage{Slide: n, Element: ElementImage, Index: j + 1, Text: snippet(im.Caption)})
+			}
+		}
+	}
+
+	result := make([]Font, 0, len(byFamily))
+	for _, f := range byFamily {
+		result = append(result, *f)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Family < result[j].Family })
+	return result
+}
+
+// Check fills in Available for each font from store
+func Check(ctx context.Context, fonts []Font, store Store) {
+	if store == nil {
+		return
+	}
+	for i := range fonts {
+		ok := store.Has(ctx, fonts[i].Family)
+		fonts[i].Available = &ok
+	}
+}
+
+// snippet trims s to one short line for reports
+func snippet(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= snippetLen {
+		return s
+	}
+	return string([]rune(s)[:snippetLen-1]) + "…"
+}
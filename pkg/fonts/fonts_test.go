@@ -0,0 +1,74 @@
+package fonts_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joeblew999/deckfs/pkg/fonts"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+)
+
+const source = `deck
+slide
+ctext "Title" 50 80 4
+text "Hello" 50 50 5 "Roboto"
+blist 10 60 3 "serif"
+li "one"
+li "two"
+elist
+eslide
+slide
+text "Again" 50 50 5 "Roboto"
+eslide
+edeck
+`
+
+func TestDetect(t *testing.T) {
+	d, err := pipeline.Parse(context.Background(), []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fonts.Detect(d)
+	if len(got) != 3 {
+		t.Fatalf("fonts = %+v", got)
+	}
+
+	roboto, sans, serif := got[0], got[1], got[2]
+	if roboto.Family != "Roboto" || roboto.Alias || roboto.Fallback != fonts.Sans || len(roboto.Usages) != 2 {
+		t.Errorf("Roboto = %+v", roboto)
+	}
+	if u := roboto.Usages[1]; u.Slide != 2 || u.Element != fonts.ElementText || u.Index != 1 || u.Text != "Again" {
+		t.Errorf("Roboto usage = %+v", u)
+	}
+	// ctext without a font renders as sans
+	if sans.Family != fonts.Sans || !sans.Alias || sans.Fallback != "" || sans.Usages[0].Text != "Title" {
+		t.Errorf("sans = %+v", sans)
+	}
+	if serif.Family != fonts.Serif || len(serif.Usages) != 1 || serif.Usages[0].Element != fonts.ElementList {
+		t.Errorf("serif = %+v", serif)
+	}
+}
+
+func TestCheck_Dir(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{fonts.AliasFiles[fonts.Sans], "OpenSans-Regular.ttf"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("ttf"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found := []fonts.Font{{Family: fonts.Sans}, {Family: fonts.Serif}, {Family: "Open Sans"}, {Family: "Roboto"}}
+	fonts.Check(context.Background(), found, fonts.Dir(dir))
+	for i, want := range []bool{true, false, true, false} {
+		if found[i].Available == nil || *found[i].Available != want {
+			t.Errorf("%s available = %v, want %v", found[i].Family, found[i].Available, want)
+		}
+	}
+
+	fonts.Check(context.Background(), found[:1], nil)
+	if found[0].Available == nil {
+		t.Error("nil store should leave Available untouched")
+	}
+}
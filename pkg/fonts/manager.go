@@ -0,0 +1,179 @@
+package fonts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultAliases are the families behind each alias, matching pngdeck's default files
+var DefaultAliases = map[string]string{
+	Sans:   "Fira Sans",
+	Serif:  "Charter",
+	Mono:   "Fira Mono",
+	Symbol: "ZapfDingbats",
+}
+
+// missTTL is how long a font no source had is remembered before trying again
+const missTTL = time.Hour
+
+// Manager resolves fonts from a cache and an ordered list of sources
+// Fonts found in a source are written to the cache, so a remote source is only
+// asked once per variant across every server sharing the cache.
+type Manager struct {
+	Aliases map[string]string // Alias to family; DefaultAliases when nil
+	FontMap FontMap           // Stacks SVG slides are written with, to recognize aliases
+
+	cache   Storage
+	sources []FontSource
+
+	mu     sync.Mutex
+	misses map[string]time.Time
+}
+
+// NewManager creates a Manager caching in cache (which may be nil) and
+// consulting sources in order on a cache miss
+func NewManager(cache Storage, sources ...FontSource) *Manager {
+	return &Manager{cache: cache, sources: sources, misses: map[string]time.Time{}}
+}
+
+// Family resolves an alias to the family behind it; other names are returned as is
+func (m *Manager) Family(name string) string {
+	aliases := m.Aliases
+	if aliases == nil {
+		aliases = DefaultAliases
+	}
+	if family, ok := aliases[name]; ok {
+		return family
+	}
+	return name
+}
+
+// Font returns TrueType data for a family (or alias) variant
+// A missing bold or italic variant falls back to the next closest one, ending at
+// Regular; ErrNotFound is returned when no source has the family at all.
+func (m *Manager) Font(ctx context.Context, family string, v Variant) ([]byte, error) {
+	family = m.Family(family)
+	var firstErr error
+	for _, candidate := range fallbacks(v) {
+		data, err := m.fetch(ctx, family, candidate)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, ErrNotFound) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, fmt.Errorf("%s: %w", family, ErrNotFound)
+}
+
+// Load returns TrueType data for a deck font name such as "sans" or "Roboto-Bold"
+func (m *Manager) Load(ctx context.Context, name string) ([]byte, error) {
+	family, v := ParseName(name)
+	return m.Font(ctx, family, v)
+}
+
+// Loader adapts the Manager to thumbnail.FontLoader, returning nil for fonts it can't load
+func (m *Manager) Loader(ctx context.Context) func(name string) []byte {
+	return func(name string) []byte {
+		data, _ := m.Load(ctx, name)
+		return data
+	}
+}
+
+func fallbacks(v Variant) []Variant {
+	switch v {
+	case BoldItalic:
+		return []Variant{BoldItalic, Bold, Italic, Regular}
+	case Bold, Italic:
+		return []Variant{v, Regular}
+	}
+	return []Variant{Regular}
+}
+
+// fetch reads one exact variant from the cache, then the sources
+func (m *Manager) fetch(ctx context.Context, family string, v Variant) ([]byte, error) {
+	key := FileName(family, v)
+	if m.cache != nil {
+		if reader, err := m.cache.Get(ctx, key); err == nil {
+			data, err := io.ReadAll(reader)
+			reader.Close()
+			if err == nil && len(data) > 0 {
+				return data, nil
+			}
+		}
+	}
+
+	m.mu.Lock()
+	missed, ok := m.misses[key]
+	m.mu.Unlock()
+	if ok && time.Since(missed) < missTTL {
+		return nil, ErrNotFound
+	}
+
+	var firstErr error
+	for _, source := range m.sources {
+		data, err := source.Fetch(ctx, family, v)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if m.cache != nil {
+			// Caching is best effort; the font is still usable for this render
+			m.cache.Put(ctx, key, data, "font/ttf")
+		}
+		return data, nil
+	}
+	if firstErr != nil {
+		return nil, firstErr // Don't remember transient failures
+	}
+
+	m.mu.Lock()
+	m.misses[key] = time.Now()
+	m.mu.Unlock()
+	return nil, ErrNotFound
+}
+
+// Has reports whether family (or an alias) is cached or in a local source
+// Remote sources aren't asked, so checking availability never downloads.
+func (m *Manager) Has(ctx context.Context, family string) bool {
+	family = m.Family(family)
+	if m.cache != nil {
+		if reader, err := m.cache.Get(ctx, FileName(family, Regular)); err == nil {
+			reader.Close()
+			return true
+		}
+	}
+	for _, source := range m.sources {
+		if store, ok := source.(Store); ok && store.Has(ctx, family) {
+			return true
+		}
+	}
+	return false
+}
+
+// FontDir writes the alias files pngdeck and pdfdeck load into dir
+// Aliases no source has are skipped, so the renderers report those fonts
+// themselves; only write failures are returned.
+func (m *Manager) FontDir(ctx context.Context, dir string) error {
+	for alias, file := range AliasFiles {
+		data, err := m.Font(ctx, alias, Regular)
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package fonts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memStorage is an in-memory font cache
+type memStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *memStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[key] = data
+	return nil
+}
+
+// fakeGoogleFonts serves css2 stylesheets for the given family:variant pairs
+// and counts requests
+func fakeGoogleFonts(t *testing.T, available map[string]bool) (*httptest.Server, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/css2", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		family := r.URL.Query().Get("family")
+		if !available[family] {
+			http.Error(w, "not found", http.StatusBadRequest)
+			return
+		}
+		file := strings.NewReplacer(" ", "", ":", "-", "@", "-", ",", "-").Replace(family)
+		fmt.Fprintf(w, "@font-face {\n  font-family: 'x';\n  src: url(/s/%s.ttf) format('truetype');\n}\n", file)
+	})
+	mux.HandleFunc("/s/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ttf:"+strings.TrimPrefix(r.URL.Path, "/s/"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestManager_FetchAndCache(t *testing.T) {
+	server, requests := fakeGoogleFonts(t, map[string]bool{
+		"Roboto":          true,
+		"Roboto:wght@700": true,
+	})
+	cache := &memStorage{files: map[string][]byte{}}
+	m := NewManager(cache, &HTTPSource{BaseURL: server.URL, Client: server.Client()})
+	ctx := context.Background()
+
+	data, err := m.Font(ctx, "Roboto", Bold)
+	if err != nil || string(data) != "ttf:Roboto-wght-700.ttf" {
+		t.Fatalf("Font(Roboto, bold) = %q, %v", data, err)
+	}
+	if _, ok := cache.files["Roboto-Bold.ttf"]; !ok {
+		t.Errorf("bold not cached: %v", cache.files)
+	}
+
+	// Cached fonts don't touch the API again
+	before := *requests
+	if _, err := m.Font(ctx, "Roboto", Bold); err != nil || *requests != before {
+		t.Errorf("second fetch made %d requests, err %v", *requests-before, err)
+	}
+
+	// Italic isn't published, so it falls back to regular
+	data, err = m.Load(ctx, "Roboto-Italic")
+	if err != nil || string(data) != "ttf:Roboto.ttf" {
+		t.Errorf("Load(Roboto-Italic) = %q, %v", data, err)
+	}
+	if !m.Has(ctx, "Roboto") {
+		t.Error("Has(Roboto) = false after caching")
+	}
+}
+
+func TestManager_NotFound(t *testing.T) {
+	server, requests := fakeGoogleFonts(t, nil)
+	m := NewManager(nil, &HTTPSource{BaseURL: server.URL, Client: server.Client()})
+	ctx := context.Background()
+
+	if _, err := m.Font(ctx, "Nope", Regular); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	// Misses are remembered rather than asked for on every render
+	before := *requests
+	m.Font(ctx, "Nope", Regular)
+	if *requests != before {
+		t.Errorf("repeated miss made %d requests", *requests-before)
+	}
+	if m.Has(ctx, "Nope") {
+		t.Error("Has(Nope) = true")
+	}
+}
+
+func TestManager_FontDir(t *testing.T) {
+	local := t.TempDir()
+	if err := os.WriteFile(filepath.Join(local, "FiraMono-Regular.ttf"), []byte("mono"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server, _ := fakeGoogleFonts(t, map[string]bool{"Fira Sans": true})
+	m := NewManager(&memStorage{files: map[string][]byte{}},
+		Dir(local), &HTTPSource{BaseURL: server.URL, Client: server.Client()})
+
+	dir := t.TempDir()
+	if err := m.FontDir(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{
+		AliasFiles[Sans]: "ttf:FiraSans.ttf",
+		AliasFiles[Mono]: "mono",
+	} {
+		if data, err := os.ReadFile(filepath.Join(dir, file)); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v", file, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, AliasFiles[Serif])); !os.IsNotExist(err) {
+		t.Errorf("serif written without a source: %v", err)
+	}
+	if !m.Has(context.Background(), Mono) {
+		t.Error("Has(mono) = false with a local file")
+	}
+}
+
+func TestParseName(t *testing.T) {
+	for name, want := range map[string]struct {
+		family  string
+		variant Variant
+	}{
+		"Roboto":                  {"Roboto", Regular},
+		"Roboto-Bold":             {"Roboto", Bold},
+		"Open Sans Italic":        {"Open Sans", Italic},
+		"FiraSans-BoldItalic":     {"FiraSans", BoldItalic},
+		"Source Code Pro Regular": {"Source Code Pro", Regular},
+		"bold":                    {"bold", Regular},
+		"Kobold":                  {"Kobold", Regular},
+	} {
+		family, v := ParseName(name)
+		if family != want.family || v != want.variant {
+			t.Errorf("ParseName(%q) = %q, %q", name, family, v)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package fonts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrNotFound is returned by a FontSource that doesn't have a family variant
+var ErrNotFound = errors.New("font not found")
+
+// FontSource fetches TrueType data for a family variant
+// Sources return ErrNotFound (possibly wrapped) for fonts they don't have.
+type FontSource interface {
+	Fetch(ctx context.Context, family string, v Variant) ([]byte, error)
+}
+
+// Storage is the part of runtime.Storage fonts are read from and cached in
+// It is declared here because runtime depends on the pipeline, which uses fonts.
+type Storage interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+}
+
+// StorageSource reads fonts from a bucket laid out like a font directory
+type StorageSource struct {
+	Storage Storage
+	Prefix  string // Key prefix, such as "fonts/"
+}
+
+// Fetch implements FontSource
+func (s StorageSource) Fetch(ctx context.Context, family string, v Variant) ([]byte, error) {
+	for _, file := range Files(family, v) {
+		reader, err := s.Storage.Get(ctx, s.Prefix+file)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Has reports whether the bucket holds family's regular file
+func (s StorageSource) Has(ctx context.Context, family string) bool {
+	for _, file := range Files(family, Regular) {
+		if reader, err := s.Storage.Get(ctx, s.Prefix+file); err == nil {
+			reader.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// GoogleFontsURL is the Google Fonts CSS API
+const GoogleFontsURL = "https://fonts.googleapis.com"
+
+// fontURL matches the font file references in an @font-face stylesheet
+var fontURL = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+
+// HTTPSource fetches fonts through a CSS font API such as Google Fonts
+// It requests a css2 stylesheet for the family and downloads the first file it
+// references; clients the API doesn't recognise as browsers are served TrueType.
+type HTTPSource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewGoogleFonts creates an HTTPSource for Google Fonts
+// If client is nil, http.DefaultClient is used
+func NewGoogleFonts(client *http.Client) *HTTPSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSource{BaseURL: GoogleFontsURL, Client: client}
+}
+
+// Fetch implements FontSource
+func (s *HTTPSource) Fetch(ctx context.Context, family string, v Variant) ([]byte, error) {
+	axes := map[Variant]string{
+		Regular:    "",
+		Bold:       ":wght@700",
+		Italic:     ":ital@1",
+		BoldItalic: ":ital,wght@1,700",
+	}[v]
+	css, err := s.get(ctx, strings.TrimSuffix(s.BaseURL, "/")+"/css2?family="+url.QueryEscape(family)+axes)
+	if err != nil {
+		return nil, err
+	}
+
+	m := fontURL.FindSubmatch(css)
+	if m == nil {
+		return nil, fmt.Errorf("%s %s: %w", family, v, ErrNotFound)
+	}
+	base, err := url.Parse(s.BaseURL + "/")
+	if err != nil {
+		return nil, err
+	}
+	ref, err := base.Parse(string(m[1]))
+	if err != nil {
+		return nil, err
+	}
+	return s.get(ctx, ref.String())
+}
+
+func (s *HTTPSource) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound:
+		// Google Fonts answers 400 for unknown families and missing styles
+		return nil, fmt.Errorf("%s: %w", rawURL, ErrNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: %s", rawURL, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
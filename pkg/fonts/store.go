@@ -0,0 +1,81 @@
+package fonts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store reports whether a font family's files are available for PNG/PDF rendering
+type Store interface {
+	Has(ctx context.Context, family string) bool
+}
+
+// AliasFiles are the TrueType files pngdeck and pdfdeck load for each alias by default
+var AliasFiles = map[string]string{
+	Sans:   "FiraSans-Regular.ttf",
+	Serif:  "Charter-Regular.ttf",
+	Mono:   "FiraMono-Regular.ttf",
+	Symbol: "ZapfDingbats.ttf",
+}
+
+// FileName returns the canonical file name of a family variant, such as FiraSans-Bold.ttf
+func FileName(family string, v Variant) string {
+	return strings.ReplaceAll(family, " ", "") + "-" + v.suffix() + ".ttf"
+}
+
+// Files returns the file names that may hold a family variant, most specific first
+// Regular files may also be named after the bare family.
+func Files(family string, v Variant) []string {
+	if v == Regular {
+		if file, ok := AliasFiles[family]; ok {
+			return []string{file}
+		}
+	}
+	files := []string{FileName(family, v)}
+	if v == Regular {
+		compact := strings.ReplaceAll(family, " ", "")
+		files = append(files, family+".ttf")
+		if compact != family {
+			files = append(files, compact+".ttf")
+		}
+	}
+	return files
+}
+
+// DefaultDir returns the font directory the native pipeline renders with
+func DefaultDir() string {
+	if dir := os.Getenv("DECKFONTS"); dir != "" {
+		return dir
+	}
+	return ".src/deckfonts"
+}
+
+// Dir is a local directory of TrueType files, as passed to -fontdir
+type Dir string
+
+// Has reports whether the directory holds family's regular file
+func (d Dir) Has(ctx context.Context, family string) bool {
+	_, err := d.path(family, Regular)
+	return err == nil
+}
+
+// Fetch implements FontSource
+func (d Dir) Fetch(ctx context.Context, family string, v Variant) ([]byte, error) {
+	path, err := d.path(family, v)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (d Dir) path(family string, v Variant) (string, error) {
+	for _, file := range Files(family, v) {
+		path := filepath.Join(string(d), file)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", ErrNotFound
+}
@@ -0,0 +1,365 @@
+package fonts
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	sfnt "github.com/tdewolff/font"
+)
+
+// Mode selects how rendered SVG slides get their fonts
+type Mode string
+
+// SVG font modes, from ADR 0002
+// cdn and embed deliver the weight and style each text element is drawn in: bold
+// and italic come from the deck font name ("Roboto-Bold") or an inherited
+// font-weight/font-style. A family without the variant falls back to its closest
+// one, which viewers then slant or embolden themselves.
+const (
+	ModeFallback Mode = "fallback" // CSS fallback stacks only; viewers use their own fonts
+	ModeCDN      Mode = "cdn"      // Import each family and variant from the Google Fonts stylesheet API
+	ModeEmbed    Mode = "embed"    // Embed each family and variant, subset to the text drawn in it, as a data URL
+)
+
+// Modes lists every Mode
+var Modes = []Mode{ModeFallback, ModeCDN, ModeEmbed}
+
+// cssGenerics are CSS generic families, which are never fetched
+var cssGenerics = map[string]bool{
+	"serif": true, "sans-serif": true, "monospace": true, "cursive": true,
+	"fantasy": true, "system-ui": true, "emoji": true, "math": true,
+}
+
+// fontFamilyDecl matches a font-family declaration in a style attribute
+var fontFamilyDecl = regexp.MustCompile(`font-family:\s*([^;"]+)`)
+
+// svgOpen matches the root element's start tag
+var svgOpen = regexp.MustCompile(`<svg[\s>][^>]*>`)
+
+// SVG applies mode to one rendered slide
+// Each font-family the slide uses is resolved to a family and variant (alias
+// stacks through the Manager's FontMap and Aliases, others through ParseName) and
+// the family is put in front of the existing stack; for cdn and embed a stylesheet
+// delivering those families is added. Families no source has keep their fallback
+// stack.
+func (m *Manager) SVG(ctx context.Context, svg []byte, mode Mode) ([]byte, error) {
+	css, slides, err := m.Stylesheet(ctx, [][]byte{svg}, mode)
+	if err != nil || css == "" {
+		return svg, err
+	}
+	svg = slides[0]
+
+	loc := svgOpen.FindIndex(svg)
+	if loc == nil {
+		return nil, fmt.Errorf("no <svg> element")
+	}
+	style := "<defs><style type=\"text/css\"><![CDATA[" + css + "]]></style></defs>"
+	out := make([]byte, 0, len(svg)+len(style))
+	out = append(out, svg[:loc[1]]...)
+	out = append(out, style...)
+	return append(out, svg[loc[1]:]...), nil
+}
+
+// Stylesheet applies mode to the slides of one deck like SVG, but returns a
+// single stylesheet for all of them instead of adding one to each slide
+// Multi-slide exports then carry each family and variant once, embedded faces
+// subset to the text of the whole deck. The slides only show those fonts where
+// the stylesheet applies, e.g. inlined in the same HTML page. The stylesheet is
+// empty, and the slides unchanged, when there is nothing to deliver.
+func (m *Manager) Stylesheet(ctx context.Context, slides [][]byte, mode Mode) (string, [][]byte, error) {
+	if mode == "" || mode == ModeFallback {
+		return "", slides, nil
+	}
+	if mode != ModeCDN && mode != ModeEmbed {
+		return "", nil, fmt.Errorf("unknown font mode %q", mode)
+	}
+
+	// Resolve each declared stack to the family and variant to deliver
+	families := map[string]resolved{} // stack -> family
+	for _, svg := range slides {
+		for _, match := range fontFamilyDecl.FindAllSubmatch(svg, -1) {
+			stack := strings.TrimSpace(string(match[1]))
+			if _, seen := families[stack]; !seen {
+				families[stack] = m.resolveStack(stack)
+			}
+		}
+	}
+
+	// Collect the text each family draws in each variant
+	faces := map[face]*strings.Builder{}
+	for _, svg := range slides {
+		for _, run := range svgText(svg) {
+			r := families[run.stack] // Only style declarations are rewritten
+			if r.family == "" {
+				continue
+			}
+			key := face{r.family, variantOf(r.variant.Bold() || run.variant.Bold(), r.variant.Italic() || run.variant.Italic())}
+			if faces[key] == nil {
+				faces[key] = &strings.Builder{}
+			}
+			faces[key].WriteString(run.text)
+		}
+	}
+	// Declared families without any text still get their regular face
+	for _, r := range families {
+		if r.family != "" && !hasFamily(faces, r.family) {
+			faces[face{r.family, Regular}] = &strings.Builder{}
+		}
+	}
+
+	var css strings.Builder
+	delivered := map[string]bool{}
+	for _, f := range sortedFaces(faces) {
+		switch mode {
+		case ModeCDN:
+			// One import per face: the API rejects a request naming any family or style it doesn't have
+			fmt.Fprintf(&css, "@import url('%s/css2?family=%s&display=swap');", GoogleFontsURL, url.QueryEscape(f.family)+cssAxes(f.variant))
+		case ModeEmbed:
+			data, err := m.Font(ctx, f.family, f.variant)
+			if err != nil {
+				continue
+			}
+			rule, err := FontFace(f.family, f.variant, data, faces[f].String())
+			if err != nil {
+				return "", nil, fmt.Errorf("%s %s: %w", f.family, f.variant, err)
+			}
+			css.WriteString(rule)
+		}
+		delivered[f.family] = true
+	}
+	if css.Len() == 0 {
+		return "", slides, nil
+	}
+
+	out := make([][]byte, len(slides))
+	for i, svg := range slides {
+		out[i] = fontFamilyDecl.ReplaceAllFunc(svg, func(decl []byte) []byte {
+			stack := strings.TrimSpace(string(fontFamilyDecl.FindSubmatch(decl)[1]))
+			r := families[stack]
+			if !delivered[r.family] || firstFamily(stack) == r.family {
+				return decl
+			}
+			out := "font-family:'" + r.family + "', " + stack
+			// A style named in the font selects the matching face
+			if r.variant.Bold() {
+				out += ";font-weight:bold"
+			}
+			if r.variant.Italic() {
+				out += ";font-style:italic"
+			}
+			return []byte(out)
+		})
+	}
+	return css.String(), out, nil
+}
+
+// resolved is the family and variant a font-family stack is delivered as
+type resolved struct {
+	family  string
+	variant Variant
+}
+
+// resolveStack maps a font-family stack to a family the Manager knows, or ""
+func (m *Manager) resolveStack(stack string) resolved {
+	if alias, ok := m.FontMap.Alias(stack); ok {
+		return resolved{m.Family(alias), Regular}
+	}
+	first := firstFamily(stack)
+	if first == "" || cssGenerics[first] {
+		return resolved{}
+	}
+	family, variant := ParseName(first)
+	return resolved{m.Family(family), variant}
+}
+
+// firstFamily returns the first name in a font-family stack, unquoted
+func firstFamily(stack string) string {
+	first, _, _ := strings.Cut(stack, ",")
+	return strings.Trim(strings.TrimSpace(first), `'"`)
+}
+
+// face is one variant of a family
+type face struct {
+	family  string
+	variant Variant
+}
+
+// hasFamily reports whether any face of family is in faces
+func hasFamily(faces map[face]*strings.Builder, family string) bool {
+	for f := range faces {
+		if f.family == family {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedFaces returns the faces by family, then variant in Variants order
+func sortedFaces(faces map[face]*strings.Builder) []face {
+	rank := map[Variant]int{}
+	for i, v := range Variants {
+		rank[v] = i
+	}
+	result := make([]face, 0, len(faces))
+	for f := range faces {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].family != result[j].family {
+			return result[i].family < result[j].family
+		}
+		return rank[result[i].variant] < rank[result[j].variant]
+	})
+	return result
+}
+
+// cssAxes returns the css2 API axis suffix requesting v
+func cssAxes(v Variant) string {
+	switch v {
+	case Bold:
+		return ":wght@700"
+	case Italic:
+		return ":ital@1"
+	case BoldItalic:
+		return ":ital,wght@1,700"
+	}
+	return ""
+}
+
+// FontFace returns an @font-face rule embedding data (TrueType, OpenType, WOFF or
+// WOFF2) as variant v of family, subset to the characters in text
+func FontFace(family string, v Variant, data []byte, text string) (string, error) {
+	subset, mediaType, err := Subset(data, text)
+	if err != nil {
+		return "", err
+	}
+	format := "truetype"
+	if mediaType == "font/otf" {
+		format = "opentype"
+	}
+	weight, style := 400, "normal"
+	if v.Bold() {
+		weight = 700
+	}
+	if v.Italic() {
+		style = "italic"
+	}
+	return fmt.Sprintf("@font-face{font-family:'%s';font-weight:%d;font-style:%s;src:url(data:%s;base64,%s) format('%s');}",
+		family, weight, style, mediaType, base64.StdEncoding.EncodeToString(subset), format), nil
+}
+
+// Subset trims a font to the glyphs needed for text and returns it as an SFNT
+// file with its media type
+func Subset(data []byte, text string) ([]byte, string, error) {
+	font, err := sfnt.ParseFont(data, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	glyphs := []uint16{0} // .notdef comes first
+	seen := map[uint16]bool{0: true}
+	for _, r := range text {
+		if id := font.GlyphIndex(r); !seen[id] {
+			seen[id] = true
+			glyphs = append(glyphs, id)
+		}
+	}
+
+	subset, err := font.Subset(glyphs, sfnt.SubsetOptions{Tables: sfnt.KeepMinTables})
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType := "font/ttf"
+	if subset.IsCFF {
+		mediaType = "font/otf"
+	}
+	return subset.Write(), mediaType, nil
+}
+
+// textRun is text drawn with one font-family stack, weight and style
+type textRun struct {
+	stack   string
+	variant Variant
+	text    string
+}
+
+// textStyle is the font state inherited down the element tree
+type textStyle struct {
+	stack        string
+	bold, italic bool
+}
+
+// svgText returns the characters drawn by a slide's text elements, with the
+// font-family, font-weight and font-style each inherits
+func svgText(svg []byte) []textRun {
+	var runs []textRun
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	decoder.Strict = false
+	styles := []textStyle{{}}
+	depth := 0 // Nesting inside <text>
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			styles = append(styles, elementStyle(styles[len(styles)-1], t))
+			if t.Name.Local == "text" || depth > 0 {
+				depth++
+			}
+		case xml.EndElement:
+			if len(styles) > 1 {
+				styles = styles[:len(styles)-1]
+			}
+			if depth > 0 {
+				depth--
+			}
+		case xml.CharData:
+			if depth > 0 {
+				s := styles[len(styles)-1]
+				runs = append(runs, textRun{s.stack, variantOf(s.bold, s.italic), string(t)})
+			}
+		}
+	}
+	return runs
+}
+
+// elementStyle applies an element's presentation attributes, then its style
+// declarations, to the inherited font state
+func elementStyle(s textStyle, e xml.StartElement) textStyle {
+	var decls, styles [][2]string
+	for _, attr := range e.Attr {
+		if attr.Name.Local != "style" {
+			decls = append(decls, [2]string{attr.Name.Local, attr.Value})
+			continue
+		}
+		for _, decl := range strings.Split(attr.Value, ";") {
+			if name, value, ok := strings.Cut(decl, ":"); ok {
+				styles = append(styles, [2]string{strings.TrimSpace(name), value})
+			}
+		}
+	}
+	decls = append(decls, styles...)
+	for _, d := range decls {
+		value := strings.ToLower(strings.TrimSpace(d[1]))
+		switch d[0] {
+		case "font-family":
+			s.stack = strings.TrimSpace(d[1])
+		case "font-weight":
+			weight, err := strconv.Atoi(value)
+			s.bold = value == "bold" || value == "bolder" || (err == nil && weight >= 600)
+		case "font-style":
+			s.italic = value == "italic" || value == "oblique"
+		}
+	}
+	return s
+}
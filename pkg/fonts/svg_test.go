@@ -0,0 +1,186 @@
+package fonts
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+
+	sfnt "github.com/tdewolff/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const slide = `<?xml version="1.0"?>
+<svg width="792" height="612" xmlns="http://www.w3.org/2000/svg">
+<text x="10" y="10" style="fill:black;font-size:12px;font-family:Helvetica, Arial, sans-serif">Hi</text>
+<g style="font-family:Courier"><text x="10" y="30">ok</text></g>
+</svg>
+`
+
+func TestSVG_Embed(t *testing.T) {
+	cache := &memStorage{files: map[string][]byte{"FiraSans-Regular.ttf": goregular.TTF}}
+	m := NewManager(cache)
+
+	out, err := m.SVG(context.Background(), []byte(slide), ModeEmbed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(out)
+	if !strings.Contains(svg, "font-family:'Fira Sans', Helvetica, Arial, sans-serif") {
+		t.Errorf("sans stack not rewritten:\n%s", svg)
+	}
+	// No source has Fira Mono, so the mono stack is left alone
+	if !strings.Contains(svg, `style="font-family:Courier"`) || strings.Count(svg, "@font-face") != 1 {
+		t.Errorf("mono should keep its fallback:\n%s", svg)
+	}
+
+	m64 := regexp.MustCompile(`base64,([^)]+)\)`).FindStringSubmatch(svg)
+	if m64 == nil {
+		t.Fatalf("no embedded font:\n%s", svg)
+	}
+	data, err := base64.StdEncoding.DecodeString(m64[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(goregular.TTF)/4 {
+		t.Errorf("subset is %d bytes of %d", len(data), len(goregular.TTF))
+	}
+	font, err := sfnt.ParseFont(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the text drawn in this face is kept; Courier's "ok" isn't
+	for r, want := range map[rune]bool{'H': true, 'i': true, 'o': false, 'Z': false} {
+		if got := font.GlyphIndex(r) != 0; got != want {
+			t.Errorf("glyph %q present = %v", r, got)
+		}
+	}
+}
+
+func TestSVG_EmbedVariants(t *testing.T) {
+	cache := &memStorage{files: map[string][]byte{
+		"Roboto-Regular.ttf": goregular.TTF,
+		"Roboto-Bold.ttf":    gobold.TTF,
+	}}
+	m := NewManager(cache)
+	const slide = `<svg xmlns="http://www.w3.org/2000/svg">
+<text style="font-family:Roboto-Bold">Bold</text>
+<g style="font-family:Roboto"><text>plain</text><text font-weight="700">heavy</text></g>
+</svg>`
+
+	out, err := m.SVG(context.Background(), []byte(slide), ModeEmbed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(out)
+	if !strings.Contains(svg, "font-family:'Roboto', Roboto-Bold;font-weight:bold") {
+		t.Errorf("bold font name not rewritten:\n%s", svg)
+	}
+	faces := regexp.MustCompile(`@font-face\{font-family:'Roboto';font-weight:(\d+);font-style:normal;src:url\(data:[^;]+;base64,([^)]+)\)`).FindAllStringSubmatch(svg, -1)
+	if len(faces) != 2 || faces[0][1] != "400" || faces[1][1] != "700" {
+		t.Fatalf("want a regular and a bold face:\n%s", svg)
+	}
+	// Each face holds only the text drawn in it
+	for i, glyphs := range []map[rune]bool{
+		{'p': true, 'l': true, 'B': false, 'v': false},
+		{'B': true, 'v': true, 'p': false},
+	} {
+		data, err := base64.StdEncoding.DecodeString(faces[i][2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		font, err := sfnt.ParseFont(data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for r, want := range glyphs {
+			if got := font.GlyphIndex(r) != 0; got != want {
+				t.Errorf("face %s: glyph %q present = %v", faces[i][1], r, got)
+			}
+		}
+	}
+
+	cdn, err := m.SVG(context.Background(), []byte(slide), ModeCDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"family=Roboto&display", "family=Roboto:wght@700&display"} {
+		if !strings.Contains(string(cdn), want) {
+			t.Errorf("missing %q:\n%s", want, cdn)
+		}
+	}
+}
+
+func TestStylesheet_SharedAcrossSlides(t *testing.T) {
+	cache := &memStorage{files: map[string][]byte{"FiraSans-Regular.ttf": goregular.TTF}}
+	m := NewManager(cache)
+	second := strings.Replace(slide, ">Hi<", ">Zap<", 1)
+
+	css, slides, err := m.Stylesheet(context.Background(), [][]byte{[]byte(slide), []byte(second)}, ModeEmbed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(css, "@font-face") != 1 {
+		t.Fatalf("want one face for the deck:\n%s", css)
+	}
+	for i, s := range slides {
+		if strings.Contains(string(s), "@font-face") || !strings.Contains(string(s), "font-family:'Fira Sans', Helvetica") {
+			t.Errorf("slide %d:\n%s", i+1, s)
+		}
+	}
+
+	// The one subset covers the text of every slide
+	m64 := regexp.MustCompile(`base64,([^)]+)\)`).FindStringSubmatch(css)
+	data, err := base64.StdEncoding.DecodeString(m64[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := sfnt.ParseFont(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range "HiZap" {
+		if font.GlyphIndex(r) == 0 {
+			t.Errorf("glyph %q missing", r)
+		}
+	}
+}
+
+func TestSVG_CDN(t *testing.T) {
+	m := NewManager(nil)
+	out, err := m.SVG(context.Background(), []byte(slide), ModeCDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(out)
+	for _, want := range []string{
+		"@import url('https://fonts.googleapis.com/css2?family=Fira+Mono&display=swap');",
+		"@import url('https://fonts.googleapis.com/css2?family=Fira+Sans&display=swap');",
+		"font-family:'Fira Mono', Courier",
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("missing %q:\n%s", want, svg)
+		}
+	}
+
+	// Applying twice doesn't stack the family again
+	again, err := m.SVG(context.Background(), out, ModeCDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(again), "'Fira Sans', 'Fira Sans'") != 0 {
+		t.Errorf("family repeated:\n%s", again)
+	}
+}
+
+func TestSVG_Fallback(t *testing.T) {
+	m := NewManager(nil)
+	if out, err := m.SVG(context.Background(), []byte(slide), ModeFallback); err != nil || string(out) != slide {
+		t.Errorf("fallback changed the slide: %v", err)
+	}
+	if _, err := m.SVG(context.Background(), []byte(slide), "inline"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
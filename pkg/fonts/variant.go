@@ -0,0 +1,77 @@
+package fonts
+
+import "strings"
+
+// Variant is the style of a font file within a family
+type Variant string
+
+// Variants resolved by the Manager
+const (
+	Regular    Variant = "regular"
+	Bold       Variant = "bold"
+	Italic     Variant = "italic"
+	BoldItalic Variant = "bolditalic"
+)
+
+// Variants lists every Variant
+var Variants = []Variant{Regular, Bold, Italic, BoldItalic}
+
+func (v Variant) suffix() string {
+	switch v {
+	case Bold:
+		return "Bold"
+	case Italic:
+		return "Italic"
+	case BoldItalic:
+		return "BoldItalic"
+	}
+	return "Regular"
+}
+
+// ParseName splits a deck font name such as "Roboto-Bold" or "Open Sans Italic"
+// into a family and variant; names without a style suffix are Regular
+func ParseName(name string) (string, Variant) {
+	family := strings.TrimSpace(name)
+	lower := strings.ToLower(family)
+	if len(lower) != len(family) {
+		return family, Regular
+	}
+	for _, s := range []struct {
+		suffix  string
+		variant Variant
+	}{
+		{"bolditalic", BoldItalic},
+		{"bold italic", BoldItalic},
+		{"bold", Bold},
+		{"italic", Italic},
+		{"regular", Regular},
+	} {
+		if !strings.HasSuffix(lower, s.suffix) || len(lower) == len(s.suffix) {
+			continue
+		}
+		rest := family[:len(family)-len(s.suffix)]
+		if trimmed := strings.TrimRight(rest, " -_"); trimmed != rest && trimmed != "" {
+			return trimmed, s.variant
+		}
+	}
+	return family, Regular
+}
+
+// variantOf returns the Variant with the given weight and style
+func variantOf(bold, italic bool) Variant {
+	switch {
+	case bold && italic:
+		return BoldItalic
+	case bold:
+		return Bold
+	case italic:
+		return Italic
+	}
+	return Regular
+}
+
+// Bold reports whether v is a bold weight
+func (v Variant) Bold() bool { return v == Bold || v == BoldItalic }
+
+// Italic reports whether v is an italic style
+func (v Variant) Italic() bool { return v == Italic || v == BoldItalic }
@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// FileKind is what a decksh file is for
+type FileKind string
+
+const (
+	KindDeck    FileKind = "deck"    // Declares a deck; rendered on its own
+	KindLibrary FileKind = "library" // Only def/edef functions; pulled in with import
+	KindInclude FileKind = "include" // Statements without a deck (slides, data); pulled in with include
+)
+
+// Classification describes a decksh file without rendering it
+type Classification struct {
+	Kind       FileKind `json:"kind"`
+	Defs       []string `json:"defs,omitempty"`
+	Imports    []string `json:"imports,omitempty"`
+	Includes   []string `json:"includes,omitempty"`
+	Title      string   `json:"title,omitempty"`     // First text on the first slide
+	SlideCount int      `json:"slideCount"`          // Top-level slide statements
+	Estimated  bool     `json:"estimated,omitempty"` // Slides inside loops, conditionals or includes weren't counted exactly
+}
+
+// Text statements whose first string argument can serve as a title
+var titleKeywords = map[string]bool{
+	"text": true, "ctext": true, "btext": true, "etext": true, "rtext": true,
+	"textblock": true, "textbox": true,
+}
+
+// Classify tokenizes source the way decksh does (per line, Go-style tokens,
+// comments skipped, '#' lines ignored) and reports its kind, defs, imports,
+// includes, a title and a slide count. Keywords inside def, data, for and if
+// blocks never make a file a deck, so a def mentioning "deck" is still a library.
+func Classify(source []byte) *Classification {
+	c := &Classification{}
+	hasDeck := false
+	var block string // Closing keyword of the block being skipped
+	depth := 0       // Nesting depth of for/if blocks
+
+	lines := bufio.NewScanner(bytes.NewReader(source))
+	lines.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for lines.Scan() {
+		line := lines.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		tokens := tokenize(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		keyword := tokens[0]
+
+		// Skip def and data bodies entirely
+		if block != "" {
+			if keyword == block {
+				block = ""
+			}
+			continue
+		}
+
+		switch keyword {
+		case "def":
+			if len(tokens) > 1 {
+				c.Defs = append(c.Defs, tokens[1])
+			}
+			block = "edef"
+			continue
+		case "data":
+			block = "edata"
+			continue
+		case "for", "if":
+			depth++
+			continue
+		case "efor", "eif":
+			if depth > 0 {
+				depth--
+			}
+			continue
+		}
+
+		if depth > 0 {
+			if keyword == "slide" || keyword == "page" || keyword == "include" {
+				c.Estimated = true
+			}
+			continue
+		}
+
+		switch keyword {
+		case "deck", "doc":
+			hasDeck = true
+		case "slide", "page":
+			c.SlideCount++
+		case "import":
+			if len(tokens) > 1 {
+				c.Imports = append(c.Imports, tokens[1])
+			}
+		case "include":
+			if len(tokens) > 1 {
+				c.Includes = append(c.Includes, tokens[1])
+			}
+			c.Estimated = true
+		default:
+			if c.Title == "" && c.SlideCount == 1 && titleKeywords[keyword] && len(tokens) > 1 && isQuoted(line, tokens[1]) {
+				c.Title = tokens[1]
+			}
+		}
+	}
+
+	switch {
+	case hasDeck:
+		c.Kind = KindDeck
+	case len(c.Defs) > 0 && c.SlideCount == 0 && len(c.Includes) == 0:
+		c.Kind = KindLibrary
+	default:
+		c.Kind = KindInclude
+	}
+	return c
+}
+
+// tokenize splits one decksh line into tokens, unquoting strings
+func tokenize(line string) []string {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(line))
+	s.Error = func(*scanner.Scanner, string) {} // Unterminated strings etc. are decksh's problem
+
+	var tokens []string
+	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+		text := s.TokenText()
+		if tok == scanner.String || tok == scanner.RawString {
+			if unquoted, err := strconv.Unquote(text); err == nil {
+				text = unquoted
+			}
+		}
+		tokens = append(tokens, text)
+	}
+	return tokens
+}
+
+// isQuoted reports whether value appears as a quoted string on line
+func isQuoted(line, value string) bool {
+	return strings.Contains(line, strconv.Quote(value)) || strings.Contains(line, "`"+value+"`")
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   Classification
+	}{
+		{
+			name:   "deck with leading comments and tabs",
+			source: "// Election results\n/* draft */\n\t\tdeck\n\tslide \"white\"\n\t\tctext \"Election Map\" 50 90 5\n\teslide\n\tslide\n\teslide\nedeck\n",
+			want:   Classification{Kind: KindDeck, Title: "Election Map", SlideCount: 2},
+		},
+		{
+			name:   "hash comment mentioning deck",
+			source: "# deck\ndef box X Y\n\trect X Y 10 10\nedef\n",
+			want:   Classification{Kind: KindLibrary, Defs: []string{"box"}},
+		},
+		{
+			name:   "def body mentioning deck",
+			source: "def wrap T\n\tdeck\n\tslide\n\tctext T 50 50 5\n\teslide\nedef\ndef dot X\n\tcircle X 50 2\nedef\n",
+			want:   Classification{Kind: KindLibrary, Defs: []string{"wrap", "dot"}},
+		},
+		{
+			name:   "imports, includes and loops",
+			source: "import \"lib/common.dsh\"\ndeck\ninclude \"parts/intro.dsh\"\nfor i = 1 5 1\n\tslide\n\teslide\nefor\nedeck\n",
+			want: Classification{Kind: KindDeck, Imports: []string{"lib/common.dsh"},
+				Includes: []string{"parts/intro.dsh"}, Estimated: true},
+		},
+		{
+			name:   "data include fragment",
+			source: "data \"sales.d\"\nJan 10\nedata\ntext \"hi\" 50 50 2\n",
+			want:   Classification{Kind: KindInclude},
+		},
+		{
+			name:   "deckname variable is not a deck",
+			source: "deckname = \"x\"\ntext deckname 10 10 2\n",
+			want:   Classification{Kind: KindInclude},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify([]byte(tt.source))
+			if got.Kind != tt.want.Kind || got.Title != tt.want.Title || got.SlideCount != tt.want.SlideCount ||
+				got.Estimated != tt.want.Estimated || !slices.Equal(got.Defs, tt.want.Defs) ||
+				!slices.Equal(got.Imports, tt.want.Imports) || !slices.Equal(got.Includes, tt.want.Includes) {
+				t.Errorf("Classify() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
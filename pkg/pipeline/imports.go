@@ -18,6 +18,7 @@ import (
 	"io"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -31,6 +32,9 @@ type ImportResolver struct {
 
 	// funcDefs tracks loaded function definitions to prevent duplicates
 	funcDefs map[string]string // funcName -> def...edef block
+
+	// deps records every file loaded while expanding, in load order
+	deps []string
 }
 
 // NewImportResolver creates a new import resolver
@@ -70,7 +74,7 @@ func (r *ImportResolver) Expand(ctx context.Context, source []byte, sourcePath s
 			resolvedPath := r.resolvePath(importPath, fullPath)
 
 			// Load imported file
-			importedContent, err := r.Loader(ctx, resolvedPath)
+			importedContent, err := r.load(ctx, resolvedPath)
 			if err != nil {
 				return nil, fmt.Errorf("failed to load import %q: %w", importPath, err)
 			}
@@ -99,7 +103,7 @@ func (r *ImportResolver) Expand(ctx context.Context, source []byte, sourcePath s
 			resolvedPath := r.resolvePath(includePath, fullPath)
 
 			// Load included file
-			includedContent, err := r.Loader(ctx, resolvedPath)
+			includedContent, err := r.load(ctx, resolvedPath)
 			if err != nil {
 				return nil, fmt.Errorf("failed to load include %q: %w", includePath, err)
 			}
@@ -129,6 +133,20 @@ func (r *ImportResolver) Expand(ctx context.Context, source []byte, sourcePath s
 	return result.Bytes(), nil
 }
 
+// load loads a file through Loader and records it as a dependency
+func (r *ImportResolver) load(ctx context.Context, path string) ([]byte, error) {
+	key := strings.TrimPrefix(path, "/")
+	if !slices.Contains(r.deps, key) {
+		r.deps = append(r.deps, key)
+	}
+	return r.Loader(ctx, path)
+}
+
+// Dependencies returns the storage keys of every file imported or included so far
+func (r *ImportResolver) Dependencies() []string {
+	return append([]string(nil), r.deps...)
+}
+
 // resolvePath resolves a file path relative to the source file directory
 func (r *ImportResolver) resolvePath(filePath, sourcePath string) string {
 	if filepath.IsAbs(filePath) {
@@ -207,6 +225,12 @@ func HasImports(source []byte) bool {
 	return false
 }
 
+// IsRenderable reports whether source declares a deck
+// Library files (only def/edef) and include fragments are not renderable on their own.
+func IsRenderable(source []byte) bool {
+	return Classify(source).Kind == KindDeck
+}
+
 // StorageLoader creates a loader function that reads from a storage interface
 func StorageLoader(storage interface {
 	Get(ctx context.Context, key string) (io.ReadCloser, error)
@@ -227,3 +227,51 @@ type testError struct {
 func (e *testError) Error() string {
 	return e.msg
 }
+
+func TestImportResolver_Dependencies(t *testing.T) {
+	files := map[string]string{
+		"talks/main.dsh": `import "../lib/util.dsh"
+include "header.dsh"
+deck
+edeck`,
+		"lib/util.dsh": `def helper X Y
+	circle X Y 5 "blue"
+edef`,
+		"talks/header.dsh": `import "../lib/util.dsh"
+include "../lib/theme.dsh"`,
+		"lib/theme.dsh": `// colors`,
+	}
+
+	loader := func(ctx context.Context, path string) ([]byte, error) {
+		return []byte(files[path]), nil
+	}
+
+	resolver := NewImportResolver(loader, "")
+	if _, err := resolver.Expand(context.Background(), []byte(files["talks/main.dsh"]), "talks/main.dsh"); err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+
+	want := []string{"lib/util.dsh", "talks/header.dsh", "lib/theme.dsh"}
+	got := resolver.Dependencies()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Dependencies() = %v, want %v", got, want)
+	}
+}
+
+func TestIsRenderable(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"deck\n  slide\n  eslide\nedeck", true},
+		{"// title\ndeck\nedeck", true},
+		{"def helper X Y\n\tcircle X Y 5\nedef", false},
+		{"// only a fragment\ntext \"hi\" 50 50 2", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRenderable([]byte(tt.source)); got != tt.want {
+			t.Errorf("IsRenderable(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
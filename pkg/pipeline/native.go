@@ -6,13 +6,16 @@ package pipeline
 import (
 	"bytes"
 	"context"
+	"debug/buildinfo"
 	"encoding/xml"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/fonts"
 )
 
 // NativePipeline implements Pipeline for native environments (CLI, wazero host)
@@ -23,6 +26,25 @@ type NativePipeline struct {
 	svgdeckBin string
 	pngdeckBin string
 	pdfdeckBin string
+	fonts      FontProvider
+	fontMap    fonts.FontMap
+	limits     Limits
+}
+
+// Limits bounds a native render
+// Zero fields are unlimited. The rlimits apply to decksh and the renderers on
+// Linux and are ignored elsewhere.
+type Limits struct {
+	MaxSlides int           // Decks with more slides fail before any slide is rendered
+	CPUTime   time.Duration // RLIMIT_CPU of each child process
+	Memory    int64         // RLIMIT_AS of each child process, in bytes
+	FileSize  int64         // RLIMIT_FSIZE of each child process, in bytes
+}
+
+// FontProvider assembles the TrueType files a PNG or PDF render needs
+type FontProvider interface {
+	// FontDir writes the fonts into dir, which is passed to the renderer as -fontdir
+	FontDir(ctx context.Context, dir string) error
 }
 
 // NewNativePipeline creates a new native pipeline
@@ -54,6 +76,29 @@ func NewNativePipeline(binDir string) (*NativePipeline, error) {
 	return p, nil
 }
 
+// SetFontProvider makes PNG and PDF renders use a fresh font directory filled by f
+// instead of the DECKFONTS directory
+func (p *NativePipeline) SetFontProvider(f FontProvider) {
+	p.fonts = f
+}
+
+// SetFontMap sets the font-family stacks SVG slides are rewritten to
+// svgdeck writes bare names such as "Helvetica"; the stacks match the WASM
+// pipeline's, so both runtimes name the same fonts. Nil uses fonts.DefaultFontMap.
+func (p *NativePipeline) SetFontMap(m fonts.FontMap) {
+	p.fontMap = m
+}
+
+// SetLimits bounds the slides and child process resources of each render
+// It fails when the rlimits can't be applied, e.g. without prlimit on Linux.
+func (p *NativePipeline) SetLimits(l Limits) error {
+	if err := checkRlimits(l); err != nil {
+		return err
+	}
+	p.limits = l
+	return nil
+}
+
 // Process implements Pipeline.Process
 // For sources with imports, use ProcessFile or ProcessWithWorkDir instead
 func (p *NativePipeline) Process(ctx context.Context, source []byte, format OutputFormat) (*Result, error) {
@@ -89,6 +134,9 @@ func (p *NativePipeline) ProcessWithWorkDir(ctx context.Context, source []byte,
 	if err := xml.Unmarshal(xmlData, &d); err != nil {
 		return nil, fmt.Errorf("failed to parse deck XML: %w", err)
 	}
+	if p.limits.MaxSlides > 0 && len(d.Slide) > p.limits.MaxSlides {
+		return nil, &LimitError{Limit: LimitSlides, Max: int64(p.limits.MaxSlides), Actual: int64(len(d.Slide)), Unit: "slides"}
+	}
 
 	// Step 2: Pipe to appropriate renderer
 	var rendererBin string
@@ -124,6 +172,13 @@ func (p *NativePipeline) ProcessWithWorkDir(ctx context.Context, source []byte,
 		return nil, err
 	}
 
+	// Step 3: Give SVG slides the font stacks the WASM pipeline writes
+	if format == FormatSVG {
+		for i := range slides {
+			slides[i] = p.fontMap.RewriteSVG(slides[i])
+		}
+	}
+
 	return &Result{
 		Slides:     slides,
 		Format:     format,
@@ -132,6 +187,24 @@ func (p *NativePipeline) ProcessWithWorkDir(ctx context.Context, source []byte,
 	}, nil
 }
 
+// Parse implements Parser with the decksh binary, so a runaway deck is bounded
+// by ctx and the pipeline's rlimits like a render
+// Imports must already be expanded.
+func (p *NativePipeline) Parse(ctx context.Context, source []byte) (*deck.Deck, error) {
+	xmlData, err := p.runDeckshStdin(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	d, err := ParseXML(xmlData)
+	if err != nil {
+		return nil, err
+	}
+	if p.limits.MaxSlides > 0 && len(d.Slide) > p.limits.MaxSlides {
+		return nil, &LimitError{Limit: LimitSlides, Max: int64(p.limits.MaxSlides), Actual: int64(len(d.Slide)), Unit: "slides"}
+	}
+	return d, nil
+}
+
 // renderSlides renders all slides using the specified renderer
 // assetDir is the directory where image assets can be found (empty if none)
 func (p *NativePipeline) renderSlides(ctx context.Context, rendererBin string, xmlData []byte, slideCount int, format OutputFormat, assetDir string) ([][]byte, error) {
@@ -148,10 +221,16 @@ func (p *NativePipeline) renderSlides(ctx context.Context, rendererBin string, x
 		return nil, fmt.Errorf("failed to write XML file: %w", err)
 	}
 
-	// Get fontdir from environment or default to .src/deckfonts
-	fontDir := os.Getenv("DECKFONTS")
-	if fontDir == "" {
-		fontDir = ".src/deckfonts"
+	// Get fontdir from the font provider, else environment or default to .src/deckfonts
+	fontDir := fonts.DefaultDir()
+	if p.fonts != nil && format != FormatSVG {
+		fontDir = filepath.Join(tmpDir, "fonts")
+		if err := os.Mkdir(fontDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create font dir: %w", err)
+		}
+		if err := p.fonts.FontDir(ctx, fontDir); err != nil {
+			return nil, fmt.Errorf("failed to assemble fonts: %w", err)
+		}
 	}
 
 	// Convert to absolute path
@@ -170,7 +249,7 @@ func (p *NativePipeline) renderSlides(ctx context.Context, rendererBin string, x
 		var errBuf bytes.Buffer
 		cmd.Stderr = &errBuf
 
-		if err := cmd.Run(); err != nil {
+		if err := p.run(cmd); err != nil {
 			return nil, fmt.Errorf("pdf failed: %w\nstderr: %s", err, errBuf.String())
 		}
 
@@ -205,7 +284,7 @@ func (p *NativePipeline) renderSlides(ctx context.Context, rendererBin string, x
 		var errBuf bytes.Buffer
 		cmd.Stderr = &errBuf
 
-		if err := cmd.Run(); err != nil {
+		if err := p.run(cmd); err != nil {
 			return nil, fmt.Errorf("%s failed on slide %d: %w\nstderr: %s", format, pageNum, err, errBuf.String())
 		}
 
@@ -232,6 +311,65 @@ func (p *NativePipeline) renderSlides(ctx context.Context, rendererBin string, x
 	return slides, nil
 }
 
+// run runs a child process under the pipeline's rlimits
+// The limits are set before the binary is exec'd, so nothing it does escapes them.
+func (p *NativePipeline) run(cmd *exec.Cmd) error {
+	if err := limitCommand(cmd, p.limits); err != nil {
+		return fmt.Errorf("failed to limit %s: %w", filepath.Base(cmd.Path), err)
+	}
+	return cmd.Run()
+}
+
+// FontDir returns the absolute font directory PNG and PDF renders use when no
+// font provider is set
+func (p *NativePipeline) FontDir() string {
+	dir, err := filepath.Abs(fonts.DefaultDir())
+	if err != nil {
+		return fonts.DefaultDir()
+	}
+	return dir
+}
+
+// HasFontProvider reports whether renders get their fonts from a FontProvider
+func (p *NativePipeline) HasFontProvider() bool {
+	return p.fonts != nil
+}
+
+// Binaries reports each deck binary the pipeline runs and its version
+func (p *NativePipeline) Binaries() []Binary {
+	var result []Binary
+	for _, path := range []string{p.deckshBin, p.svgdeckBin, p.pngdeckBin, p.pdfdeckBin} {
+		b := Binary{Name: filepath.Base(path), Path: path}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			b.Found = true
+			b.Version = binaryVersion(path)
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+// binaryVersion reads the module version go install stamped into a binary,
+// or the VCS revision of a local build
+func binaryVersion(path string) string {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			if len(setting.Value) > 12 {
+				return setting.Value[:12]
+			}
+			return setting.Value
+		}
+	}
+	return info.Main.Version
+}
+
 // SupportedFormats implements Pipeline.SupportedFormats
 func (p *NativePipeline) SupportedFormats() []OutputFormat {
 	formats := []OutputFormat{}
@@ -268,7 +406,7 @@ func (p *NativePipeline) runDeckshStdin(ctx context.Context, source []byte) ([]b
 	var stderrBuf bytes.Buffer
 	deckshCmd.Stderr = &stderrBuf
 
-	if err := deckshCmd.Run(); err != nil {
+	if err := p.run(deckshCmd); err != nil {
 		return nil, fmt.Errorf("decksh failed: %w\nstderr: %s", err, stderrBuf.String())
 	}
 
@@ -301,7 +439,7 @@ func (p *NativePipeline) runDeckshFile(ctx context.Context, source []byte, workD
 	var stderrBuf bytes.Buffer
 	deckshCmd.Stderr = &stderrBuf
 
-	if err := deckshCmd.Run(); err != nil {
+	if err := p.run(deckshCmd); err != nil {
 		return nil, fmt.Errorf("decksh failed: %w\nstderr: %s", err, stderrBuf.String())
 	}
 
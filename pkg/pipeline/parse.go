@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/ajstarks/deck"
+	"github.com/ajstarks/decksh"
+)
+
+// Parser converts decksh source into the deck model without rendering
+// NativePipeline runs decksh as a child process under its limits; Parse runs it
+// in this process.
+type Parser interface {
+	Parse(ctx context.Context, source []byte) (*deck.Deck, error)
+}
+
+// parseSlot serializes in-process parses: decksh keeps canvas size and
+// variables in package globals
+var parseSlot = make(chan struct{}, 1)
+
+// Parse converts decksh source into the deck model in this process
+// Imports must already be expanded (see ImportResolver). decksh can't be
+// interrupted, so when ctx ends first Parse returns ctx.Err() while decksh
+// finishes in the background, still holding the parse slot.
+func Parse(ctx context.Context, source []byte) (*deck.Deck, error) {
+	select {
+	case parseSlot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	done := make(chan error, 1)
+	var deckXML bytes.Buffer
+	go func() {
+		defer func() { <-parseSlot }()
+		done <- decksh.Process(&deckXML, bytes.NewReader(source))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("decksh processing failed: %w", err)
+		}
+		return ParseXML(deckXML.Bytes())
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ParseXML reads decksh's XML output into the deck model
+// The canvas defaults to decksh's 792x612 when the source doesn't set one.
+func ParseXML(data []byte) (*deck.Deck, error) {
+	var d deck.Deck
+	if err := xml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("deck parsing failed: %w", err)
+	}
+	if d.Canvas.Width == 0 || d.Canvas.Height == 0 {
+		d.Canvas.Width, d.Canvas.Height = 792, 612
+	}
+	return &d, nil
+}
@@ -1,7 +1,11 @@
 // Package pipeline defines the interface for converting decksh to various formats
 package pipeline
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 // OutputFormat represents the target output format
 type OutputFormat string
@@ -35,3 +39,55 @@ type Result struct {
 	// SlideCount is the number of slides
 	SlideCount int
 }
+
+// Binary describes one of the deck binaries a native pipeline runs
+type Binary struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Found   bool   `json:"found"`
+	Version string `json:"version,omitempty"` // From the binary's Go build info, when present
+}
+
+// Limit names reported in LimitError, matching their configuration settings
+const (
+	LimitBody         = "maxBodyBytes"   // Request body
+	LimitSource       = "maxSourceBytes" // Source after import expansion
+	LimitSlides       = "maxSlides"
+	LimitTimeout      = "renderTimeout" // Wall-clock time of one render
+	LimitQueue        = "maxQueued"     // Renders waiting for a slot
+	LimitQueueTimeout = "queueTimeout"  // Time spent waiting for a slot
+)
+
+// LimitError reports a request or render that exceeded a configured limit
+type LimitError struct {
+	Limit  string // One of the Limit* names
+	Max    int64
+	Actual int64  // 0 when not known
+	Unit   string // bytes, slides, ms or renders
+}
+
+func (e *LimitError) Error() string {
+	if e.Actual > 0 {
+		return fmt.Sprintf("%s exceeded: %d %s, limit %d", e.Limit, e.Actual, e.Unit, e.Max)
+	}
+	return fmt.Sprintf("%s exceeded: limit %d %s", e.Limit, e.Max, e.Unit)
+}
+
+// Expired returns ctx's error, or context.DeadlineExceeded once its deadline
+// has passed but its timer hasn't fired: on js/wasm a synchronous render
+// never yields to let it fire, so renders check this between steps
+func Expired(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// Overloaded reports whether the render was refused for lack of capacity
+// rather than for its own size, so retrying later can succeed.
+func (e *LimitError) Overloaded() bool {
+	return e.Limit == LimitQueue || e.Limit == LimitQueueTimeout
+}
@@ -0,0 +1,27 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pastDeadline is a context whose deadline passed before its timer fired
+type pastDeadline struct{ context.Context }
+
+func (pastDeadline) Deadline() (time.Time, bool) { return time.Now().Add(-time.Second), true }
+
+func TestExpired(t *testing.T) {
+	if err := Expired(context.Background()); err != nil {
+		t.Errorf("no deadline: %v", err)
+	}
+	if err := Expired(pastDeadline{context.Background()}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("passed deadline: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Expired(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: %v", err)
+	}
+}
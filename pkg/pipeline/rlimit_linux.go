@@ -0,0 +1,58 @@
+//go:build linux && !tinygo
+
+package pipeline
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// prlimitPath finds util-linux prlimit, which sets a command's rlimits and then
+// execs it, so the limits are in place before the command runs
+var prlimitPath = sync.OnceValues(func() (string, error) {
+	return exec.LookPath("prlimit")
+})
+
+// checkRlimits reports whether the child process limits in l can be applied
+func checkRlimits(l Limits) error {
+	if len(rlimitArgs(l)) == 0 {
+		return nil
+	}
+	if _, err := prlimitPath(); err != nil {
+		return fmt.Errorf("process limits need prlimit (util-linux): %w", err)
+	}
+	return nil
+}
+
+// limitCommand rewrites cmd to start under prlimit with the limits in l
+func limitCommand(cmd *exec.Cmd, l Limits) error {
+	args := rlimitArgs(l)
+	if len(args) == 0 {
+		return nil
+	}
+	prlimit, err := prlimitPath()
+	if err != nil {
+		return fmt.Errorf("process limits need prlimit (util-linux): %w", err)
+	}
+	args = append(append([]string{prlimit}, args...), "--", cmd.Path)
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = prlimit
+	return nil
+}
+
+// rlimitArgs returns the prlimit options setting the limits in l
+func rlimitArgs(l Limits) []string {
+	var args []string
+	if l.CPUTime > 0 {
+		args = append(args, fmt.Sprintf("--cpu=%d", (l.CPUTime+time.Second-1)/time.Second))
+	}
+	if l.Memory > 0 {
+		args = append(args, fmt.Sprintf("--as=%d", l.Memory))
+	}
+	if l.FileSize > 0 {
+		args = append(args, fmt.Sprintf("--fsize=%d", l.FileSize))
+	}
+	return args
+}
@@ -0,0 +1,39 @@
+//go:build linux && !tinygo
+
+package pipeline
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitCommand_AppliesBeforeExec(t *testing.T) {
+	if _, err := prlimitPath(); err != nil {
+		t.Skip("prlimit not installed")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+
+	// The shell reads its own limits as soon as it starts
+	cmd := exec.Command(sh, "-c", "ulimit -t")
+	if err := limitCommand(cmd, Limits{CPUTime: 1500 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "2" {
+		t.Errorf("CPU limit seen by the command = %q, want 2", got)
+	}
+
+	// Without limits the command is left alone
+	cmd = exec.Command(sh, "-c", "true")
+	if err := limitCommand(cmd, Limits{MaxSlides: 10}); err != nil || cmd.Path != sh {
+		t.Errorf("unlimited command rewritten to %s: %v", cmd.Path, err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !js && !tinygo
+
+package pipeline
+
+import "os/exec"
+
+// checkRlimits accepts any limits: child process rlimits are only applied on Linux
+func checkRlimits(l Limits) error {
+	return nil
+}
+
+// limitCommand leaves cmd alone: child process rlimits are only applied on Linux
+func limitCommand(cmd *exec.Cmd, l Limits) error {
+	return nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ajstarks/deck"
 	"github.com/ajstarks/decksh"
 	svg "github.com/ajstarks/svgo/float"
+	"github.com/joeblew999/deckfs/pkg/fonts"
 )
 
 const (
@@ -44,9 +45,9 @@ func NewWASMPipeline() *WASMPipeline {
 	return &WASMPipeline{
 		width:     1920,
 		height:    1080,
-		sansFont:  "Helvetica, Arial, sans-serif",
-		serifFont: "Georgia, Times, serif",
-		monoFont:  "Monaco, Consolas, monospace",
+		sansFont:  fonts.DefaultFontMap.Stack(fonts.Sans),
+		serifFont: fonts.DefaultFontMap.Stack(fonts.Serif),
+		monoFont:  fonts.DefaultFontMap.Stack(fonts.Mono),
 		fontmap:   make(map[string]string),
 	}
 }
@@ -66,6 +67,11 @@ func (p *WASMPipeline) WithFonts(sans, serif, mono string) *WASMPipeline {
 	return p
 }
 
+// WithFontMap sets the font families from a font map shared with the native pipeline
+func (p *WASMPipeline) WithFontMap(m fonts.FontMap) *WASMPipeline {
+	return p.WithFonts(m.Stack(fonts.Sans), m.Stack(fonts.Serif), m.Stack(fonts.Mono))
+}
+
 // Process implements Pipeline.Process
 func (p *WASMPipeline) Process(ctx context.Context, source []byte, format OutputFormat) (*Result, error) {
 	if format != FormatSVG {
@@ -83,6 +89,10 @@ func (p *WASMPipeline) Process(ctx context.Context, source []byte, format Output
 		return nil, fmt.Errorf("decksh processing failed: %w", err)
 	}
 
+	if err := Expired(ctx); err != nil {
+		return nil, err
+	}
+
 	// Step 2: Parse deck XML
 	d, err := p.parseDeck(deckXML.Bytes())
 	if err != nil {
@@ -100,7 +110,11 @@ func (p *WASMPipeline) Process(ctx context.Context, source []byte, format Output
 	cw := float64(d.Canvas.Width)
 	ch := float64(d.Canvas.Height)
 
+	// decksh can't be interrupted, but a render past its deadline stops between slides
 	for i := range d.Slide {
+		if err := Expired(ctx); err != nil {
+			return nil, err
+		}
 		var svgBuf bytes.Buffer
 		doc := svg.New(&svgBuf)
 		p.svgslide(doc, d, i, cw, ch)
@@ -397,7 +411,7 @@ func (p *WASMPipeline) dolist(doc *svg.SVG, x, y, fs, rotation, lwidth, spacing
 			lifmt += "fill:" + tl.Color
 		}
 		if len(tl.Font) > 0 {
-			lifmt += ";font-family:" + tl.Font
+			lifmt += ";font-family:" + p.fontlookup(tl.Font)
 		}
 		if align == "center" || align == "c" {
 			lifmt += ";text-anchor:middle"
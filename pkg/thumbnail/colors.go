@@ -0,0 +1,85 @@
+//go:build !cloudflare
+
+package thumbnail
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/colornames"
+)
+
+// colorLookup returns the RGB of a named color, "rgb(r,g,b)", "#rrggbb" or
+// "hsv(h,s,v)" string, like pngdeck; anything else is black
+func colorLookup(s string) (int, int, int) {
+	if c, ok := colornames.Map[strings.ToLower(s)]; ok {
+		return int(c.R), int(c.G), int(c.B)
+	}
+	switch {
+	case strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")"):
+		if v := colorNumbers(s); len(v) >= 3 {
+			r, _ := strconv.Atoi(v[0])
+			g, _ := strconv.Atoi(v[1])
+			b, _ := strconv.Atoi(v[2])
+			return r, g, b
+		}
+	case strings.HasPrefix(s, "#") && len(s) == 7:
+		r, _ := strconv.ParseInt(s[1:3], 16, 32)
+		g, _ := strconv.ParseInt(s[3:5], 16, 32)
+		b, _ := strconv.ParseInt(s[5:7], 16, 32)
+		return int(r), int(g), int(b)
+	case strings.HasPrefix(s, "hsv(") && strings.HasSuffix(s, ")"):
+		if v := colorNumbers(s); len(v) == 3 {
+			h, _ := strconv.ParseFloat(v[0], 64)
+			sat, _ := strconv.ParseFloat(v[1], 64)
+			val, _ := strconv.ParseFloat(v[2], 64)
+			return hsvToRGB(h, sat, val)
+		}
+	}
+	return 0, 0, 0
+}
+
+// colorNumbers splits the arguments of xxx(n1, n2, n3)
+func colorNumbers(s string) []string {
+	return strings.Split(strings.NewReplacer(" ", "", "\t", "").Replace(s[4:len(s)-1]), ",")
+}
+
+// hsvToRGB converts hue (0-360), saturation and value (0-100) to RGB
+func hsvToRGB(h, s, v float64) (int, int, int) {
+	s /= 100
+	v /= 100
+	if s < 0 || s > 1 || v < 0 || v > 1 {
+		return 0, 0, 0
+	}
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	c := v * s
+	section := h / 60
+	x := c * (1 - math.Abs(math.Mod(section, 2)-1))
+
+	var r, g, b float64
+	switch {
+	case section < 1:
+		r, g = c, x
+	case section < 2:
+		r, g = x, c
+	case section < 3:
+		g, b = c, x
+	case section < 4:
+		g, b = x, c
+	case section < 5:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := v - c
+	return int((r + m) * 255), int((g + m) * 255), int((b + m) * 255)
+}
+
+func rgba(r, g, b int) color.RGBA {
+	return color.RGBA{uint8(r), uint8(g), uint8(b), 255}
+}
@@ -0,0 +1,90 @@
+//go:build !cloudflare
+
+package thumbnail
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Built-in Go fonts, parsed once
+var (
+	builtinOnce sync.Once
+	builtin     map[string]*truetype.Font
+)
+
+func builtinFonts() map[string]*truetype.Font {
+	builtinOnce.Do(func() {
+		builtin = map[string]*truetype.Font{}
+		for name, data := range map[string][]byte{
+			"sans":   goregular.TTF,
+			"bold":   gobold.TTF,
+			"italic": goitalic.TTF,
+			"mono":   gomono.TTF,
+		} {
+			builtin[name], _ = truetype.Parse(data)
+		}
+	})
+	return builtin
+}
+
+// builtinFor picks the closest built-in font for a deck font name
+// The Go fonts have no serif face, so serif fonts fall back to sans.
+func builtinFor(name string) *truetype.Font {
+	fonts := builtinFonts()
+	n := strings.ToLower(name)
+	switch {
+	case strings.Contains(n, "mono"), strings.Contains(n, "courier"), strings.Contains(n, "code"):
+		return fonts["mono"]
+	case strings.Contains(n, "bold"):
+		return fonts["bold"]
+	case strings.Contains(n, "italic"), strings.Contains(n, "oblique"):
+		return fonts["italic"]
+	}
+	return fonts["sans"]
+}
+
+// fontSet resolves deck font names for one Renderer
+type fontSet struct {
+	mu     sync.Mutex
+	loader FontLoader
+	parsed map[string]*truetype.Font
+}
+
+func (r *Renderer) fonts() *fontSet {
+	return &fontSet{loader: r.Fonts, parsed: map[string]*truetype.Font{}}
+}
+
+// face returns a face for name at size pixels
+func (s *fontSet) face(name string, size float64) font.Face {
+	if name == "" {
+		name = "sans"
+	}
+	return truetype.NewFace(s.font(name), &truetype.Options{Size: size, Hinting: font.HintingFull})
+}
+
+func (s *fontSet) font(name string) *truetype.Font {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.parsed[name]; ok {
+		return f
+	}
+
+	f := builtinFor(name)
+	if s.loader != nil {
+		if data := s.loader(name); data != nil {
+			if loaded, err := truetype.Parse(data); err == nil {
+				f = loaded
+			}
+		}
+	}
+	s.parsed[name] = f
+	return f
+}
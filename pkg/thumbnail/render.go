@@ -0,0 +1,401 @@
+//go:build !cloudflare
+
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/ajstarks/deck"
+	"github.com/fogleman/gg"
+)
+
+// Supported reports whether this build can rasterize thumbnails
+const Supported = true
+
+// Layout defaults from pngdeck
+const (
+	lineSpacing  = 1.4
+	listSpacing  = 2.0
+	listWrap     = 95.0
+	defaultColor = "rgb(127,127,127)"
+)
+
+var defaultRenderer = &Renderer{}
+
+// Render draws slide n (0-based) of d at width pixels using the built-in fonts
+func Render(d *deck.Deck, n, width int) (image.Image, error) {
+	return defaultRenderer.Render(d, n, width)
+}
+
+// Render draws slide n (0-based) of d at width pixels
+func (r *Renderer) Render(d *deck.Deck, n, width int) (image.Image, error) {
+	if n < 0 || n >= len(d.Slide) {
+		return nil, fmt.Errorf("slide %d out of range (deck has %d)", n+1, len(d.Slide))
+	}
+	if d.Canvas.Width <= 0 || d.Canvas.Height <= 0 {
+		return nil, fmt.Errorf("deck has no canvas size")
+	}
+	width = min(max(width, MinWidth), MaxWidth)
+	height := max(1, width*d.Canvas.Height/d.Canvas.Width)
+
+	c := &canvas{
+		dc:    gg.NewContext(width, height),
+		w:     float64(width),
+		h:     float64(height),
+		scale: float64(width) / float64(d.Canvas.Width),
+		fonts: r.fonts(),
+	}
+	c.slide(d.Slide[n])
+	return c.dc.Image(), nil
+}
+
+// Encode encodes img as f
+func Encode(img image.Image, f Format) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch f {
+	case PNG:
+		err = png.Encode(&buf, img)
+	case WebP:
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("unsupported thumbnail format %q", f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canvas draws one slide in pixel space; deck coordinates are percentages with y up
+type canvas struct {
+	dc    *gg.Context
+	w, h  float64
+	scale float64 // Pixels per deck canvas unit, for fixed-size defaults
+	fonts *fontSet
+}
+
+func pct(p, m float64) float64 {
+	return (p / 100.0) * m
+}
+
+// point converts percentage coordinates to pixels
+func (c *canvas) point(xp, yp float64) (float64, float64) {
+	return pct(xp, c.w), pct(100-yp, c.h)
+}
+
+// stroke returns the pixel width of a percentage stroke, defaulting like pngdeck
+func (c *canvas) stroke(sp float64) float64 {
+	if sp == 0 {
+		return 2.0 * c.scale
+	}
+	return pct(sp, c.w)
+}
+
+func (c *canvas) setColor(s string, opacity float64) {
+	r, g, b := colorLookup(s)
+	c.dc.SetRGBA255(r, g, b, alpha(opacity))
+}
+
+// alpha converts an opacity percentage, where 0 means opaque
+func alpha(opacity float64) int {
+	if opacity > 0 {
+		return int(255.0 * (opacity / 100.0))
+	}
+	return 255
+}
+
+func (c *canvas) slide(s deck.Slide) {
+	dc := c.dc
+	bg := s.Bg
+	if bg == "" {
+		bg = "white"
+	}
+	c.setColor(bg, 0)
+	dc.Clear()
+	if s.Gradcolor1 != "" && s.Gradcolor2 != "" {
+		c.gradient(0, 0, c.w, c.h, s.Gradcolor1, s.Gradcolor2)
+	}
+	fg := s.Fg
+	if fg == "" {
+		fg = "black"
+	}
+
+	// Same layer order as pngdeck's default
+	for _, im := range s.Image {
+		c.image(im, fg)
+	}
+	for _, r := range s.Rect {
+		x, y := c.point(r.Xp, r.Yp)
+		w, h := c.size(r.Dimension)
+		if r.Gradcolor1 != "" && r.Gradcolor2 != "" {
+			c.gradient(x-w/2, y-h/2, w, h, r.Gradcolor1, r.Gradcolor2)
+			continue
+		}
+		c.setColor(orDefault(r.Color), r.Opacity)
+		dc.DrawRectangle(x-w/2, y-h/2, w, h)
+		dc.Fill()
+	}
+	for _, e := range s.Ellipse {
+		x, y := c.point(e.Xp, e.Yp)
+		w, h := c.size(e.Dimension)
+		c.setColor(orDefault(e.Color), e.Opacity)
+		dc.DrawEllipse(x, y, w/2, h/2)
+		dc.Fill()
+	}
+	dc.SetLineCapButt()
+	for _, cv := range s.Curve {
+		x1, y1 := c.point(cv.Xp1, cv.Yp1)
+		x2, y2 := c.point(cv.Xp2, cv.Yp2)
+		x3, y3 := c.point(cv.Xp3, cv.Yp3)
+		c.setColor(orDefault(cv.Color), cv.Opacity)
+		dc.SetLineWidth(c.stroke(cv.Sp))
+		dc.MoveTo(x1, y1)
+		dc.QuadraticTo(x2, y2, x3, y3)
+		dc.Stroke()
+	}
+	for _, a := range s.Arc {
+		x, y := c.point(a.Xp, a.Yp)
+		w, h := pct(a.Wp, c.w), pct(a.Hp, c.w)
+		c.setColor(orDefault(a.Color), a.Opacity)
+		dc.SetLineWidth(c.stroke(a.Sp))
+		dc.DrawEllipticalArc(x, y, w/2, h/2, gg.Radians(360-a.A1), gg.Radians(360-a.A2))
+		dc.Stroke()
+	}
+	for _, l := range s.Line {
+		x1, y1 := c.point(l.Xp1, l.Yp1)
+		x2, y2 := c.point(l.Xp2, l.Yp2)
+		c.setColor(orDefault(l.Color), l.Opacity)
+		dc.SetLineWidth(c.stroke(l.Sp))
+		dc.DrawLine(x1, y1, x2, y2)
+		dc.Stroke()
+	}
+	for _, p := range s.Polygon {
+		c.polygon(p.XC, p.YC, orDefault(p.Color), p.Opacity)
+	}
+	for _, t := range s.Text {
+		c.text(t, fg)
+	}
+	for _, l := range s.List {
+		c.list(l, fg)
+	}
+}
+
+func orDefault(color string) string {
+	if color == "" {
+		return defaultColor
+	}
+	return color
+}
+
+// size returns the pixel size of a dimension; hr is a height relative to the width
+func (c *canvas) size(d deck.Dimension) (float64, float64) {
+	w := pct(d.Wp, c.w)
+	if d.Hr != 0 {
+		return w, pct(d.Hr, w)
+	}
+	return w, pct(d.Hp, c.h)
+}
+
+func (c *canvas) gradient(x, y, w, h float64, c1, c2 string) {
+	r1, g1, b1 := colorLookup(c1)
+	r2, g2, b2 := colorLookup(c2)
+	grad := gg.NewLinearGradient(x, y, x+w, y+h)
+	grad.AddColorStop(0, rgba(r1, g1, b1))
+	grad.AddColorStop(1, rgba(r2, g2, b2))
+	c.dc.SetFillStyle(grad)
+	c.dc.DrawRectangle(x, y, w, h)
+	c.dc.Fill()
+}
+
+func (c *canvas) polygon(xc, yc, color string, opacity float64) {
+	xs, ys := strings.Fields(xc), strings.Fields(yc)
+	if len(xs) != len(ys) || len(xs) < 3 {
+		return
+	}
+	c.dc.NewSubPath()
+	for i := range xs {
+		xp, _ := strconv.ParseFloat(xs[i], 64)
+		yp, _ := strconv.ParseFloat(ys[i], 64)
+		c.dc.LineTo(c.point(xp, yp))
+	}
+	c.dc.ClosePath()
+	c.setColor(color, opacity)
+	c.dc.Fill()
+}
+
+// image draws a placeholder box the size the image would take
+func (c *canvas) image(im deck.Image, fg string) {
+	x, y := c.point(im.Xp, im.Yp)
+	w, h := float64(im.Width)*c.scale, float64(im.Height)*c.scale
+	if im.Scale > 0 {
+		w, h = w*im.Scale/100, h*im.Scale/100
+	}
+	if im.Height == 0 && im.Width > 0 {
+		w = pct(float64(im.Width), c.w)
+		h = w * 3 / 4
+	}
+	if w <= 0 || h <= 0 {
+		return
+	}
+	c.setColor("rgb(200,200,200)", 60)
+	c.dc.DrawRectangle(x-w/2, y-h/2, w, h)
+	c.dc.Fill()
+	if im.Caption != "" {
+		size := pct(2, c.w)
+		if im.Sp > 0 {
+			size = pct(im.Sp, c.w)
+		}
+		color := im.Color
+		if color == "" {
+			color = fg
+		}
+		align := im.Align
+		if align == "" {
+			align = "center"
+		}
+		c.setColor(color, 0)
+		c.show(x, y+h/2+size*1.5, im.Caption, size, im.Font, align)
+	}
+}
+
+func (c *canvas) text(t deck.Text, fg string) {
+	dc := c.dc
+	x, y := c.point(t.Xp, t.Yp)
+	fs := pct(t.Sp, c.w)
+	color, font, spacing := t.Color, t.Font, t.Lp
+	if color == "" {
+		color = fg
+	}
+	if spacing == 0 {
+		spacing = lineSpacing
+	}
+
+	if t.Rotation > 0 {
+		dc.Push()
+		dc.RotateAbout(gg.Radians(360-t.Rotation), x, y)
+		defer dc.Pop()
+	}
+	lines := strings.Split(t.Tdata, "\n")
+	if t.Type == "code" {
+		font = "mono"
+		tw := deck.Pwidth(t.Wp, c.w, c.w-x-20*c.scale)
+		c.setColor("rgb(240,240,240)", 0)
+		dc.DrawRectangle(x-fs, y-fs, tw, float64(len(lines))*spacing*fs)
+		dc.Fill()
+	}
+	c.setColor(color, t.Opacity)
+	if t.Type == "block" {
+		c.wrap(x, y, deck.Pwidth(t.Wp, c.w, c.w/2), fs, fs*spacing, t.Tdata, font)
+		return
+	}
+	for _, line := range lines {
+		c.show(x, y, line, fs, font, t.Align)
+		y += spacing * fs
+	}
+}
+
+func (c *canvas) list(l deck.List, fg string) {
+	dc := c.dc
+	x, y := c.point(l.Xp, l.Yp)
+	fs := pct(l.Sp, c.w)
+	color, font, spacing, wrap := l.Color, l.Font, l.Lp, l.Wp
+	if color == "" {
+		color = fg
+	}
+	if spacing == 0 {
+		spacing = listSpacing
+	}
+	if wrap == 0 {
+		wrap = listWrap
+	}
+	if l.Type == "bullet" {
+		x += fs * 1.2
+	}
+	ls := spacing * fs
+	tw := deck.Pwidth(wrap, c.w, c.w/2)
+
+	if l.Rotation > 0 {
+		dc.Push()
+		dc.RotateAbout(gg.Radians(360-l.Rotation), x, y)
+		defer dc.Pop()
+	}
+	for i, item := range l.Li {
+		text := item.ListText
+		if l.Type == "number" {
+			text = fmt.Sprintf("%d. %s", i+1, text)
+		}
+		if l.Type == "bullet" {
+			c.setColor(color, 0)
+			dc.DrawCircle(x-fs, y-fs/4, fs/4)
+			dc.Fill()
+		}
+		itemColor, itemFont := color, font
+		if item.Color != "" {
+			itemColor = item.Color
+		}
+		if item.Font != "" {
+			itemFont = item.Font
+		}
+		c.setColor(itemColor, item.Opacity)
+		if l.Align == "center" || l.Align == "c" {
+			c.show(x, y, text, fs, itemFont, l.Align)
+			y += ls
+			continue
+		}
+		breaks := c.wrap(x, y, tw, fs, ls, text, itemFont)
+		y += ls * float64(1+breaks)
+	}
+}
+
+// show draws one line of text with its baseline at y
+func (c *canvas) show(x, y float64, s string, fs float64, font, align string) {
+	if fs <= 0 || s == "" {
+		return
+	}
+	c.dc.SetFontFace(c.fonts.face(font, fs))
+	tw, _ := c.dc.MeasureString(s)
+	switch align {
+	case "center", "middle", "mid", "c":
+		x -= tw / 2
+	case "right", "end", "e":
+		x -= tw
+	}
+	c.dc.DrawString(s, x, y)
+}
+
+// wrap draws words from x, breaking lines past width; returns the number of breaks
+func (c *canvas) wrap(x, y, width, fs, leading float64, s, font string) int {
+	if fs <= 0 {
+		return 0
+	}
+	factor := 0.3
+	if font == "mono" {
+		factor = 1.0
+	}
+	c.dc.SetFontFace(c.fonts.face(font, fs))
+	space, _ := c.dc.MeasureString("M")
+	breaks := 0
+	xp, yp := x, y
+	for _, word := range strings.Fields(s) {
+		if word == `\n` {
+			xp, yp = x, yp+leading
+			breaks++
+			continue
+		}
+		tw, _ := c.dc.MeasureString(word)
+		c.dc.DrawString(word, xp, yp)
+		xp += tw + space*factor
+		if xp > x+width {
+			xp, yp = x, yp+leading
+			breaks++
+		}
+	}
+	return breaks
+}
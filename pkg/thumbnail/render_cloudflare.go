@@ -0,0 +1,27 @@
+//go:build cloudflare
+
+package thumbnail
+
+import (
+	"image"
+
+	"github.com/ajstarks/deck"
+)
+
+// Supported reports whether this build can rasterize thumbnails
+const Supported = false
+
+// Render returns ErrUnsupported; see the package comment
+func Render(d *deck.Deck, n, width int) (image.Image, error) {
+	return nil, ErrUnsupported
+}
+
+// Render returns ErrUnsupported; see the package comment
+func (r *Renderer) Render(d *deck.Deck, n, width int) (image.Image, error) {
+	return nil, ErrUnsupported
+}
+
+// Encode returns ErrUnsupported; see the package comment
+func Encode(img image.Image, f Format) ([]byte, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,51 @@
+// Package thumbnail rasterizes deck slides into small preview images
+//
+// It draws the parsed deck model directly, following pngdeck's layout rules, so
+// previews can be made anywhere Go runs without the external renderers the
+// native pipeline uses. Images referenced by a slide are drawn as placeholders
+// since their files aren't available to the renderer.
+//
+// The rasterizer and its font and WebP dependencies more than double the size
+// of the Worker, so builds tagged cloudflare leave it out: there Render and
+// Encode return ErrUnsupported and previews come from output storage.
+package thumbnail
+
+import "errors"
+
+// Thumbnail widths in pixels; heights follow the deck's aspect ratio
+const (
+	DefaultWidth = 480
+	MinWidth     = 16
+	MaxWidth     = 1600
+)
+
+// Format is an encoded image format
+type Format string
+
+const (
+	PNG  Format = "png"
+	WebP Format = "webp"
+)
+
+// Formats lists every supported format
+var Formats = []Format{PNG, WebP}
+
+// ContentType returns the MIME type of f
+func (f Format) ContentType() string {
+	if f == WebP {
+		return "image/webp"
+	}
+	return "image/png"
+}
+
+// ErrUnsupported is returned by builds without the rasterizer
+var ErrUnsupported = errors.New("thumbnails are not rendered by this build")
+
+// FontLoader returns TrueType data for a deck font name (an alias such as "sans",
+// "serif" and "mono", or a family name), or nil if it has none
+type FontLoader func(name string) []byte
+
+// Renderer draws slides with a set of fonts
+type Renderer struct {
+	Fonts FontLoader // Optional; the built-in Go fonts are used for anything it doesn't return
+}
@@ -0,0 +1,108 @@
+//go:build !cloudflare
+
+package thumbnail
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/ajstarks/deck"
+)
+
+func testDeck() *deck.Deck {
+	d := &deck.Deck{Slide: []deck.Slide{{
+		Bg: "steelblue",
+		Fg: "white",
+		Text: []deck.Text{{
+			CommonAttr: deck.CommonAttr{Xp: 50, Yp: 50, Sp: 5, Align: "center"},
+			Tdata:      "Hello",
+		}},
+		Rect: []deck.Rect{{Dimension: deck.Dimension{CommonAttr: deck.CommonAttr{Xp: 90, Yp: 10, Color: "#ff0000"}, Wp: 10, Hp: 10}}},
+	}}}
+	d.Canvas.Width, d.Canvas.Height = 792, 612
+	return d
+}
+
+func TestRender_SizeAndContent(t *testing.T) {
+	img, err := Render(testDeck(), 0, 396)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 396 || b.Dy() != 306 {
+		t.Fatalf("size = %v, want 396x306", b)
+	}
+
+	// Background in a corner, the rect near the bottom right
+	if r, g, b, _ := img.At(2, 2).RGBA(); r>>8 != 70 || g>>8 != 130 || b>>8 != 180 {
+		t.Errorf("background = %d,%d,%d, want steelblue", r>>8, g>>8, b>>8)
+	}
+	if r, g, b, _ := img.At(356, 275).RGBA(); r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("rect pixel = %d,%d,%d, want red", r>>8, g>>8, b>>8)
+	}
+
+	// Some text pixels are drawn in the foreground color
+	white := 0
+	for x := 150; x < 250; x++ {
+		if r, g, b, _ := img.At(x, 150).RGBA(); r>>8 > 240 && g>>8 > 240 && b>>8 > 240 {
+			white++
+		}
+	}
+	if white == 0 {
+		t.Error("no text drawn")
+	}
+}
+
+func TestRender_ClampsWidthAndChecksSlide(t *testing.T) {
+	img, err := Render(testDeck(), 0, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != MaxWidth {
+		t.Errorf("width = %d, want %d", img.Bounds().Dx(), MaxWidth)
+	}
+	if _, err := Render(testDeck(), 1, 100); err == nil {
+		t.Error("expected an error for a missing slide")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	img, _ := Render(testDeck(), 0, 64)
+
+	data, err := Encode(img, PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("PNG doesn't decode: %v", err)
+	}
+
+	data, err = Encode(img, WebP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		t.Errorf("not a WebP file: % x", data[:min(len(data), 12)])
+	}
+
+	if _, err := Encode(img, "gif"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestColorLookup(t *testing.T) {
+	tests := map[string][3]int{
+		"red":              {255, 0, 0},
+		"SteelBlue":        {70, 130, 180},
+		"rgb(1, 2, 3)":     {1, 2, 3},
+		"#0a0b0c":          {10, 11, 12},
+		"hsv(120,100,100)": {0, 255, 0},
+		"nonsense":         {0, 0, 0},
+	}
+	for in, want := range tests {
+		r, g, b := colorLookup(in)
+		if [3]int{r, g, b} != want {
+			t.Errorf("colorLookup(%q) = %d,%d,%d, want %v", in, r, g, b, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"maps"
+	"sync"
+
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// classifyCacheKey holds every cached classification in one KV value, so a cold
+// Worker isolate warms its memory cache with a single read instead of one per file
+const classifyCacheKey = "classify:cache"
+
+type classifyEntry struct {
+	ETag           string                   `json:"etag"`
+	Classification *pipeline.Classification `json:"classification"`
+}
+
+// classifyCache holds a Processor's classifications, keyed by storage key and
+// invalidated by ETag, so it never needs explicit clearing
+type classifyCache struct {
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]classifyEntry
+}
+
+// ClassifyObjects classifies listed input objects, reading only those whose ETag
+// changed since they were last classified. Objects without an ETag are always read,
+// and unreadable ones are left out. objects should be a complete listing: cached
+// entries for keys not in it are dropped.
+func (p *Processor) ClassifyObjects(ctx context.Context, objects []runtime.ObjectInfo) map[string]*pipeline.Classification {
+	cache := &p.classify
+	result := make(map[string]*pipeline.Classification, len(objects))
+
+	cache.mu.Lock()
+	if !cache.loaded {
+		cache.loaded = true
+		cache.entries = map[string]classifyEntry{}
+		if data, err := p.kv().Get(ctx, classifyCacheKey); err == nil && data != nil {
+			if err := json.Unmarshal(data, &cache.entries); err != nil {
+				log.Printf("processor: ignoring unreadable classification cache: %v", err)
+				cache.entries = map[string]classifyEntry{}
+			}
+		}
+	}
+	var stale []runtime.ObjectInfo
+	for _, obj := range objects {
+		if entry, ok := cache.entries[obj.Key]; ok && obj.ETag != "" && entry.ETag == obj.ETag {
+			result[obj.Key] = entry.Classification
+			continue
+		}
+		stale = append(stale, obj)
+	}
+	cache.mu.Unlock()
+
+	// Sources are read without the lock so one slow listing doesn't stall the others
+	fresh := make(map[string]classifyEntry, len(stale))
+	for _, obj := range stale {
+		source, err := p.readSource(ctx, obj.Key)
+		if err != nil {
+			continue
+		}
+		c := pipeline.Classify(source)
+		result[obj.Key] = c
+		if obj.ETag != "" {
+			fresh[obj.Key] = classifyEntry{ETag: obj.ETag, Classification: c}
+		}
+	}
+
+	cache.mu.Lock()
+	changed := len(fresh) > 0
+	maps.Copy(cache.entries, fresh)
+	seen := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		seen[obj.Key] = true
+	}
+	for key := range cache.entries {
+		if !seen[key] {
+			delete(cache.entries, key)
+			changed = true
+		}
+	}
+	var data []byte
+	if changed {
+		data, _ = json.Marshal(cache.entries)
+	}
+	cache.mu.Unlock()
+
+	if data != nil {
+		if err := p.kv().Put(ctx, classifyCacheKey, data); err != nil {
+			log.Printf("processor: failed to store classification cache: %v", err)
+		}
+	}
+	return result
+}
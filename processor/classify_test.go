@@ -0,0 +1,76 @@
+//go:build !cloudflare
+
+package processor
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// countingStorage counts Gets
+type countingStorage struct {
+	runtime.Storage
+	gets atomic.Int32
+}
+
+func (s *countingStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.gets.Add(1)
+	return s.Storage.Get(ctx, key)
+}
+
+func TestProcessor_ClassifyObjectsCachesByETag(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	input := &countingStorage{Storage: p.Input}
+	p.Input = input
+
+	p.Input.Put(ctx, "talk.dsh", []byte("deck\nslide\ntext \"Hello\" 50 50 3\neslide\nedeck\n"), "text/plain")
+	p.Input.Put(ctx, "lib/shapes.dsh", []byte("def box x y\nrect x y 10 10\nedef\n"), "text/plain")
+
+	classify := func() map[string]*pipeline.Classification {
+		t.Helper()
+		list, err := p.Input.List(ctx, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.ClassifyObjects(ctx, list.Objects)
+	}
+
+	got := classify()
+	if got["talk.dsh"].Kind != pipeline.KindDeck || got["talk.dsh"].Title != "Hello" {
+		t.Errorf("talk.dsh = %+v", got["talk.dsh"])
+	}
+	if got["lib/shapes.dsh"].Kind != pipeline.KindLibrary {
+		t.Errorf("lib/shapes.dsh = %+v", got["lib/shapes.dsh"])
+	}
+	if n := input.gets.Load(); n != 2 {
+		t.Fatalf("first pass read %d files, want 2", n)
+	}
+
+	classify()
+	if n := input.gets.Load(); n != 2 {
+		t.Errorf("unchanged files were reread: %d reads", n)
+	}
+
+	// A changed file gets a new ETag and is reclassified
+	p.Input.Put(ctx, "lib/shapes.dsh", []byte("deck\nslide\neslide\nedeck\n"), "text/plain")
+	got = classify()
+	if n := input.gets.Load(); n != 3 {
+		t.Errorf("after one change read %d files in total, want 3", n)
+	}
+	if got["lib/shapes.dsh"].Kind != pipeline.KindDeck {
+		t.Errorf("changed file not reclassified: %+v", got["lib/shapes.dsh"])
+	}
+
+	// The cache survives a restart through KV
+	p = &Processor{Input: input, Output: p.Output, KV: p.KV, Pipeline: p.Pipeline}
+	classify()
+	if n := input.gets.Load(); n != 3 {
+		t.Errorf("cache not restored from KV: %d reads", n)
+	}
+}
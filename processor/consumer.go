@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// KV prefix for queue messages that exhausted their retry budget
+const queueDeadLetterPrefix = "deadletter:queue:"
+
+// Message is a queue message delivered to a Consumer
+// cmd/cloudflare adapts queues.Message; tests use an in-memory fake.
+type Message interface {
+	ID() string
+	Body() ([]byte, error)
+	Attempts() int // Delivery attempts so far, starting at 1
+	Ack()
+	Retry(delay time.Duration)
+}
+
+// ObjectEvent is an R2 event notification
+type ObjectEvent struct {
+	Action string `json:"action"`
+	Bucket string `json:"bucket"`
+	Object struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+		ETag string `json:"eTag"`
+	} `json:"object"`
+}
+
+// validate reports what is missing from a notification the consumer can't act on
+func (e *ObjectEvent) validate() error {
+	var missing []string
+	if e.Action == "" {
+		missing = append(missing, "action")
+	}
+	if e.Bucket == "" {
+		missing = append(missing, "bucket")
+	}
+	if e.Object.Key == "" {
+		missing = append(missing, "object key")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// queueBody is a queue message: an R2 event notification, or a job the
+// processor sent itself through a queue (see JobMessage)
+type queueBody struct {
+	ObjectEvent
+	Job *Job `json:"job,omitempty"`
+}
+
+// JobMessage returns the queue message body that carries job
+func JobMessage(job Job) ([]byte, error) {
+	return json.Marshal(struct {
+		Job Job `json:"job"`
+	}{job})
+}
+
+// parseQueueBody decodes a message, filling in the event fields of job
+// messages so dead letters name their key either way
+func parseQueueBody(data []byte) (queueBody, error) {
+	var body queueBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return body, err
+	}
+	if body.Job == nil {
+		return body, body.validate()
+	}
+	body.Action, body.Object.Key = body.Job.Action, body.Job.Key
+	if body.Job.Key == "" && body.Job.Action != ActionReindex {
+		return body, errors.New("missing job key")
+	}
+	return body, nil
+}
+
+// QueueDeadLetter records a queue message that could not be processed
+type QueueDeadLetter struct {
+	MessageID string `json:"messageId"`
+	Key       string `json:"key,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error"`
+	Body      string `json:"body"`
+	FailedAt  string `json:"failedAt"`
+}
+
+// Consumer turns R2 event notifications, and jobs queued by processors, into
+// processor jobs
+// Transient failures are retried with exponential backoff until MaxAttempts,
+// then the message is acked and a dead letter is written to KV so a deck can
+// never sit in "processing" indefinitely.
+type Consumer struct {
+	Processor   *Processor
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+// NewConsumer creates a consumer with a 5 attempt budget starting at 10s backoff
+func NewConsumer(p *Processor) *Consumer {
+	return &Consumer{
+		Processor:   p,
+		MaxAttempts: 5,
+		RetryDelay:  10 * time.Second,
+	}
+}
+
+// ConsumeBatch handles every message in a batch
+func (c *Consumer) ConsumeBatch(ctx context.Context, msgs []Message) {
+	for _, msg := range msgs {
+		c.Consume(ctx, msg)
+	}
+}
+
+// Consume handles one message, always finishing with Ack or Retry
+func (c *Consumer) Consume(ctx context.Context, msg Message) {
+	body, err := msg.Body()
+	if err != nil {
+		c.retryOrDeadLetter(ctx, msg, nil, fmt.Errorf("unreadable message body: %w", err))
+		return
+	}
+
+	parsed, err := parseQueueBody(body)
+	if err != nil {
+		// Malformed messages never get better; dead-letter immediately
+		c.deadLetter(ctx, msg, body, &parsed.ObjectEvent, fmt.Errorf("invalid event notification: %w", err))
+		msg.Ack()
+		return
+	}
+
+	job, ok := Job{}, true
+	if parsed.Job != nil {
+		job = *parsed.Job
+	} else if job, ok = JobForEvent(&parsed.ObjectEvent); !ok {
+		msg.Ack()
+		return
+	}
+
+	err = c.Processor.Handle(ctx, job)
+	var perr *Error
+	if errors.As(err, &perr) && perr.Retryable() {
+		c.retryOrDeadLetter(ctx, msg, body, err)
+		return
+	}
+
+	// Success, duplicate, or bad source (recorded in status): nothing to retry
+	msg.Ack()
+}
+
+// JobForEvent maps an R2 event notification to a job
+// It reports false for events that need no processing.
+func JobForEvent(event *ObjectEvent) (Job, bool) {
+	switch event.Action {
+	case "PutObject", "CopyObject", "CompleteMultipartUpload":
+		if !strings.HasSuffix(event.Object.Key, ".dsh") {
+			return Job{}, false
+		}
+		return Job{Key: event.Object.Key, Action: ActionRender, ETag: event.Object.ETag}, true
+	case "DeleteObject", "LifecycleDeletion":
+		// R2 has no rename event: a rename arrives as a delete plus a create
+		if !strings.HasSuffix(event.Object.Key, ".dsh") {
+			return Job{}, false
+		}
+		return Job{Key: event.Object.Key, Action: ActionDelete}, true
+	}
+	return Job{}, false
+}
+
+// retryOrDeadLetter retries msg with backoff, or dead-letters it once the budget is spent
+func (c *Consumer) retryOrDeadLetter(ctx context.Context, msg Message, body []byte, cause error) {
+	attempts := msg.Attempts()
+	if attempts < c.MaxAttempts {
+		msg.Retry(c.RetryDelay << (max(attempts, 1) - 1))
+		return
+	}
+
+	parsed, _ := parseQueueBody(body)
+	c.deadLetter(ctx, msg, body, &parsed.ObjectEvent, fmt.Errorf("gave up after %d attempts: %w", attempts, cause))
+	msg.Ack()
+}
+
+// deadLetter writes a dead-letter record and marks the source as failed
+func (c *Consumer) deadLetter(ctx context.Context, msg Message, body []byte, event *ObjectEvent, cause error) {
+	dl := QueueDeadLetter{
+		MessageID: msg.ID(),
+		Key:       event.Object.Key,
+		Action:    event.Action,
+		Attempts:  msg.Attempts(),
+		Error:     cause.Error(),
+		Body:      string(body),
+		FailedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	data, _ := json.Marshal(dl)
+	c.Processor.kv().PutWithTTL(ctx, queueDeadLetterPrefix+msg.ID(), data, runtime.DeadLetterTTL)
+
+	if dl.Key != "" {
+		c.Processor.SetStatus(ctx, dl.Key, StatusError, dl.Error)
+	}
+}
+
+// QueueDeadLetters returns recorded queue dead letters
+func (p *Processor) QueueDeadLetters(ctx context.Context) ([]QueueDeadLetter, error) {
+	keys, err := runtime.ListAllKV(ctx, p.kv(), queueDeadLetterPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]QueueDeadLetter, 0, len(keys))
+	for _, key := range keys {
+		data, err := p.kv().Get(ctx, key)
+		if err != nil || data == nil {
+			continue
+		}
+		var dl QueueDeadLetter
+		if err := json.Unmarshal(data, &dl); err == nil {
+			letters = append(letters, dl)
+		}
+	}
+	return letters, nil
+}
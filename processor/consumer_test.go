@@ -0,0 +1,209 @@
+//go:build !cloudflare
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// fakeMessage is an in-memory queue message recording how it was settled
+type fakeMessage struct {
+	id       string
+	body     []byte
+	attempts int
+	acked    bool
+	retried  bool
+	delay    time.Duration
+}
+
+func (m *fakeMessage) ID() string                { return m.id }
+func (m *fakeMessage) Body() ([]byte, error)     { return m.body, nil }
+func (m *fakeMessage) Attempts() int             { return m.attempts }
+func (m *fakeMessage) Ack()                      { m.acked = true }
+func (m *fakeMessage) Retry(delay time.Duration) { m.retried, m.delay = true, delay }
+
+// fakeBatch builds messages for R2 PutObject notifications
+func fakeBatch(attempts int, keys ...string) ([]Message, []*fakeMessage) {
+	msgs := make([]Message, len(keys))
+	fakes := make([]*fakeMessage, len(keys))
+	for i, key := range keys {
+		fakes[i] = &fakeMessage{
+			id:       fmt.Sprintf("msg-%d", i),
+			body:     []byte(fmt.Sprintf(`{"action":"PutObject","bucket":"decks","object":{"key":%q,"eTag":"etag-%s"}}`, key, key)),
+			attempts: attempts,
+		}
+		msgs[i] = fakes[i]
+	}
+	return msgs, fakes
+}
+
+// countingPipeline counts renders
+type countingPipeline struct {
+	fakePipeline
+	calls int
+}
+
+func (p *countingPipeline) ProcessWithWorkDir(ctx context.Context, source []byte, format runtime.Format, workDir string) (*runtime.ProcessResult, error) {
+	p.calls++
+	return p.fakePipeline.ProcessWithWorkDir(ctx, source, format, workDir)
+}
+
+// recordingPublisher collects published subjects
+type recordingPublisher struct {
+	subjects []string
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	p.subjects = append(p.subjects, subject)
+	return nil
+}
+
+// failingStorage fails every Put
+type failingStorage struct {
+	runtime.Storage
+}
+
+func (failingStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return errors.New("bucket unavailable")
+}
+
+func TestConsumer_RendersAndSkipsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	pipe := &countingPipeline{}
+	p.Pipeline = pipe
+	p.Input.Put(ctx, "a.dsh", []byte("deck\nslide"), "text/plain")
+	events := &recordingPublisher{}
+	runtime.SetRuntime(&runtime.Runtime{Publisher: events})
+	defer runtime.SetRuntime(nil)
+
+	c := NewConsumer(p)
+	msgs, fakes := fakeBatch(1, "a.dsh", "a.dsh", "image.png")
+	c.ConsumeBatch(ctx, msgs)
+
+	for i, m := range fakes {
+		if !m.acked || m.retried {
+			t.Errorf("message %d: acked=%v retried=%v", i, m.acked, m.retried)
+		}
+	}
+	if pipe.calls != 1 {
+		t.Errorf("renders = %d, want 1 (duplicate ETag should be skipped)", pipe.calls)
+	}
+	if len(events.subjects) == 0 || events.subjects[0] != runtime.EventSubject(runtime.EventDeckUploaded) ||
+		strings.Count(strings.Join(events.subjects, " "), runtime.EventDeckUploaded) != 1 {
+		t.Errorf("events = %v, want one deck.uploaded first", events.subjects)
+	}
+	if s := readStatus(t, p, "a.dsh"); s.Status != StatusComplete {
+		t.Errorf("status = %+v", s)
+	}
+}
+
+func TestConsumer_BadSourceIsAcked(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	p.Input.Put(ctx, "bad.dsh", []byte("deck\nfail"), "text/plain")
+
+	msgs, fakes := fakeBatch(1, "bad.dsh")
+	NewConsumer(p).ConsumeBatch(ctx, msgs)
+
+	if !fakes[0].acked || fakes[0].retried {
+		t.Errorf("bad source should be acked without retry: %+v", fakes[0])
+	}
+	if s := readStatus(t, p, "bad.dsh"); s.Status != StatusError {
+		t.Errorf("status = %+v", s)
+	}
+}
+
+func TestConsumer_RetriesThenDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	p.Output = failingStorage{p.Output}
+	p.Input.Put(ctx, "a.dsh", []byte("deck\nslide"), "text/plain")
+
+	c := NewConsumer(p)
+	c.MaxAttempts = 3
+
+	// Within budget: retried with exponential backoff, status not complete
+	msgs, fakes := fakeBatch(2, "a.dsh")
+	c.ConsumeBatch(ctx, msgs)
+	if !fakes[0].retried || fakes[0].acked || fakes[0].delay != 2*c.RetryDelay {
+		t.Fatalf("expected retry with backoff: %+v", fakes[0])
+	}
+	if s := readStatus(t, p, "a.dsh"); s.Status == StatusComplete {
+		t.Fatal("status must not be complete after failed slide writes")
+	}
+
+	// Budget exhausted: acked and dead-lettered
+	msgs, fakes = fakeBatch(3, "a.dsh")
+	c.ConsumeBatch(ctx, msgs)
+	if !fakes[0].acked || fakes[0].retried {
+		t.Fatalf("expected ack after final attempt: %+v", fakes[0])
+	}
+
+	letters, err := p.QueueDeadLetters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].Key != "a.dsh" || !strings.Contains(letters[0].Error, "bucket unavailable") {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+	if s := readStatus(t, p, "a.dsh"); s.Status != StatusError {
+		t.Errorf("status = %+v", s)
+	}
+}
+
+func TestConsumer_MalformedMessageDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+
+	m := &fakeMessage{id: "bad", body: []byte("not json"), attempts: 1}
+	incomplete := &fakeMessage{id: "incomplete", body: []byte(`{"action":"PutObject","object":{"key":"a.dsh"}}`), attempts: 1}
+	NewConsumer(p).ConsumeBatch(ctx, []Message{m, incomplete})
+
+	if !m.acked || m.retried || !incomplete.acked || incomplete.retried {
+		t.Errorf("malformed messages should be acked: %+v %+v", m, incomplete)
+	}
+	letters, _ := p.QueueDeadLetters(ctx)
+	if len(letters) != 2 || letters[0].Body != "not json" {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+	if want := "invalid event notification: missing bucket"; letters[1].Error != want {
+		t.Errorf("error = %q, want %q", letters[1].Error, want)
+	}
+}
+
+func TestProcessSource_MarksContentVersion(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	source := []byte("deck\nslide")
+	p.Input.Put(ctx, "a.dsh", source, "text/plain")
+
+	if _, err := p.ProcessSource(ctx, "a.dsh", source); err != nil {
+		t.Fatal(err)
+	}
+
+	// The notification for our own upload carries the MD5 ETag and is skipped
+	pipe := &countingPipeline{}
+	p.Pipeline = pipe
+	if err := p.Handle(ctx, Job{Key: "a.dsh", Action: ActionRender, ETag: ContentVersion(source)}); err != nil {
+		t.Fatal(err)
+	}
+	if pipe.calls != 0 {
+		t.Errorf("renders = %d, want 0", pipe.calls)
+	}
+
+	reader, _ := p.Output.Get(ctx, "a/slide-0001.svg")
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "<svg/>" {
+		t.Errorf("slide = %q", data)
+	}
+}
@@ -0,0 +1,410 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// deckPrefix holds one DeckEntry per deck, so listings never read manifests:
+//
+//	deck:<key> -> DeckEntry
+//
+// Entries are kept without a TTL and written whenever the deck's status changes.
+// With a catalog the entries live in its decks table instead, and a listing is
+// one query.
+const deckPrefix = "deck:"
+
+// deckBackfillKey marks that decks rendered before the index was built, or before
+// it moved to the catalog, have been indexed
+const deckBackfillKey = "deckindex:backfill"
+
+// Deck listing page sizes
+const (
+	DefaultDeckLimit = 50
+	MaxDeckLimit     = 500
+)
+
+// Sort orders accepted by Decks
+const (
+	SortKey         = "key"
+	SortTitle       = "title"
+	SortProcessedAt = "processedAt"
+	SortUpdatedAt   = "updatedAt"
+	SortSlideCount  = "slideCount"
+	SortStatus      = "status"
+)
+
+// DeckSorts lists the accepted sort orders
+var DeckSorts = []string{SortKey, SortTitle, SortProcessedAt, SortUpdatedAt, SortSlideCount, SortStatus}
+
+// DeckEntry is the indexed metadata of one deck
+type DeckEntry struct {
+	Key         string `json:"key"`      // Source key, e.g. team/q3/report.dsh
+	BaseName    string `json:"baseName"` // Output prefix, e.g. team/q3/report
+	Title       string `json:"title,omitempty"`
+	SlideCount  int    `json:"slideCount"`
+	ProcessedAt string `json:"processedAt,omitempty"` // Last successful render
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	ETag        string `json:"etag,omitempty"`      // Source version of the last successful render
+	Thumbnail   string `json:"thumbnail,omitempty"` // Output key of the preview image
+	UpdatedAt   string `json:"updatedAt"`
+}
+
+// DeckQuery selects a page of decks
+type DeckQuery struct {
+	Prefix string   // Source key prefix
+	Status []string // Any of these statuses; all when empty
+	Sort   string   // One of the Sort constants; SortKey when empty
+	Desc   bool
+	Offset int
+	Limit  int // DefaultDeckLimit when 0, capped at MaxDeckLimit
+}
+
+// DeckPage is one page of decks
+type DeckPage struct {
+	Decks    []DeckEntry
+	Total    int  // Decks matching the query across all pages
+	Next     int  // Offset of the next page, 0 when this is the last
+	Indexing bool // The backfill hasn't finished; older decks may be missing
+}
+
+// DeckKey returns the KV key holding a deck's index entry
+func DeckKey(key string) string {
+	return deckPrefix + key
+}
+
+// DeckEntry returns the index entry for key, or nil if the deck isn't indexed
+func (p *Processor) DeckEntry(ctx context.Context, key string) *DeckEntry {
+	if cat := p.catalog(); cat != nil {
+		d, err := cat.Deck(ctx, key)
+		if err != nil || d == nil {
+			return nil
+		}
+		e := deckEntry(*d)
+		return &e
+	}
+	return p.kvDeckEntry(ctx, key)
+}
+
+func (p *Processor) kvDeckEntry(ctx context.Context, key string) *DeckEntry {
+	data, err := p.kv().Get(ctx, DeckKey(key))
+	if err != nil || data == nil {
+		return nil
+	}
+	var e DeckEntry
+	if json.Unmarshal(data, &e) != nil {
+		return nil
+	}
+	return &e
+}
+
+// deckEntry converts a catalog listing row
+func deckEntry(d catalog.Deck) DeckEntry {
+	return DeckEntry{
+		Key:         d.Key,
+		BaseName:    BaseName(d.Key),
+		Title:       d.Title,
+		SlideCount:  d.SlideCount,
+		ProcessedAt: d.ProcessedAt,
+		Status:      d.Status,
+		Error:       d.Error,
+		ETag:        d.ETag,
+		Thumbnail:   d.Thumbnail,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
+
+// catalogDeck converts an entry to its catalog listing row
+func (e *DeckEntry) catalogDeck() catalog.Deck {
+	return catalog.Deck{
+		Key:         e.Key,
+		Status:      e.Status,
+		Error:       e.Error,
+		Title:       e.Title,
+		SlideCount:  e.SlideCount,
+		ETag:        e.ETag,
+		Thumbnail:   e.Thumbnail,
+		ProcessedAt: e.ProcessedAt,
+		UpdatedAt:   e.UpdatedAt,
+	}
+}
+
+// updateDeck applies a status change, and optionally render results, to a deck's index entry
+// Library files have no entry; a deck that became a library loses its entry.
+// The catalog applies the change in one statement; KV entries use updateKV.
+func (p *Processor) updateDeck(ctx context.Context, key, status, errMsg string, result *Result, version string) {
+	if status == StatusLibrary {
+		p.removeDeck(ctx, key)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	change := catalog.Deck{Key: key, Status: status, Error: errMsg, UpdatedAt: now}
+	if result != nil {
+		change.Title = result.Title
+		change.SlideCount = result.SlideCount
+		change.ProcessedAt = now
+		change.ETag = version
+		change.Thumbnail = result.Thumbnail
+		if change.Thumbnail == "" && len(result.Slides) > 0 {
+			change.Thumbnail = result.Slides[0]
+		}
+	}
+
+	if cat := p.catalog(); cat != nil {
+		if err := cat.UpdateDeck(ctx, change); err != nil {
+			log.Printf("catalog: failed to index deck %s: %v", key, err)
+		}
+		return
+	}
+
+	err := p.updateKV(ctx, DeckKey(key), func(old []byte) ([]byte, error) {
+		e := DeckEntry{Key: key, BaseName: BaseName(key)}
+		if old != nil {
+			json.Unmarshal(old, &e)
+		}
+		e.Status, e.Error, e.UpdatedAt = change.Status, change.Error, change.UpdatedAt
+		if result != nil {
+			e.Title, e.SlideCount, e.ProcessedAt = change.Title, change.SlideCount, change.ProcessedAt
+			e.ETag, e.Thumbnail = change.ETag, change.Thumbnail
+		}
+		return json.Marshal(e)
+	})
+	if err != nil {
+		log.Printf("processor: failed to index deck %s: %v", key, err)
+	}
+}
+
+// storeDeck writes a complete index entry
+func (p *Processor) storeDeck(ctx context.Context, e *DeckEntry) error {
+	if cat := p.catalog(); cat != nil {
+		return cat.UpdateDeck(ctx, e.catalogDeck())
+	}
+	data, _ := json.Marshal(e)
+	return p.kv().Put(ctx, DeckKey(e.Key), data)
+}
+
+// removeDeck drops a deck from the index
+func (p *Processor) removeDeck(ctx context.Context, key string) {
+	p.kv().Delete(ctx, DeckKey(key))
+	if cat := p.catalog(); cat != nil {
+		if err := cat.DeleteDeck(ctx, key); err != nil {
+			log.Printf("catalog: failed to unindex deck %s: %v", key, err)
+		}
+	}
+}
+
+// Decks returns a page of indexed decks
+// Until the one-time backfill has run, the page is marked Indexing and lacks
+// decks rendered before the index existed; the listing schedules the backfill
+// rather than running it.
+func (p *Processor) Decks(ctx context.Context, q DeckQuery) (*DeckPage, error) {
+	indexing := p.ScheduleDeckBackfill(ctx)
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultDeckLimit
+	}
+	limit = min(limit, MaxDeckLimit)
+	offset := max(q.Offset, 0)
+
+	if cat := p.catalog(); cat != nil {
+		rows, total, err := cat.Decks(ctx, catalog.DeckQuery{
+			Prefix: q.Prefix,
+			Status: q.Status,
+			Sort:   q.Sort,
+			Desc:   q.Desc,
+			Offset: offset,
+			Limit:  limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		page := &DeckPage{Decks: make([]DeckEntry, len(rows)), Total: total, Indexing: indexing}
+		for i, d := range rows {
+			page.Decks[i] = deckEntry(d)
+		}
+		if end := offset + len(rows); end < total {
+			page.Next = end
+		}
+		return page, nil
+	}
+
+	kv := p.kv()
+	keys, err := runtime.ListAllKV(ctx, kv, deckPrefix+q.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(q.Status))
+	for _, s := range q.Status {
+		wanted[s] = true
+	}
+
+	decks := make([]DeckEntry, 0, len(keys))
+	for _, kvKey := range keys {
+		e := p.kvDeckEntry(ctx, strings.TrimPrefix(kvKey, deckPrefix))
+		if e == nil {
+			continue // Deleted between list and get
+		}
+		if len(wanted) > 0 && !wanted[e.Status] {
+			continue
+		}
+		decks = append(decks, *e)
+	}
+
+	sortDecks(decks, q.Sort, q.Desc)
+
+	page := &DeckPage{Total: len(decks), Indexing: indexing}
+	start := min(offset, len(decks))
+	end := min(start+limit, len(decks))
+	page.Decks = decks[start:end]
+	if end < len(decks) {
+		page.Next = end
+	}
+	return page, nil
+}
+
+// ScheduleDeckBackfill queues the one-time ReindexDecks that lists decks
+// rendered before the index was built, or before it moved to the catalog, and
+// reports whether the backfill is still pending
+// Without a Queue the backfill runs in the background. Servers call this at
+// startup and Decks calls it on every listing; each Processor sends the job once
+// and jobs arriving after the backfill finished do nothing.
+func (p *Processor) ScheduleDeckBackfill(ctx context.Context) bool {
+	if done, err := p.kv().Get(ctx, deckBackfillKey); err != nil || done != nil {
+		return false
+	}
+	if !p.backfillQueued.CompareAndSwap(false, true) {
+		return true
+	}
+
+	job := Job{Action: ActionReindex}
+	if p.Queue == nil {
+		go func() {
+			if err := p.Handle(context.WithoutCancel(ctx), job); err != nil {
+				log.Printf("processor: %v", err)
+			}
+		}()
+		return true
+	}
+	if err := p.Queue.Enqueue(ctx, job); err != nil {
+		log.Printf("processor: queue deck index backfill: %v", err)
+		p.backfillQueued.Store(false)
+	}
+	return true
+}
+
+// backfillDecks runs ReindexDecks unless the backfill already ran
+// A failed backfill can be scheduled again.
+func (p *Processor) backfillDecks(ctx context.Context) error {
+	kv := p.kv()
+	if done, err := kv.Get(ctx, deckBackfillKey); err != nil || done != nil {
+		return err
+	}
+	if _, err := p.ReindexDecks(ctx); err != nil {
+		p.backfillQueued.Store(false)
+		return fmt.Errorf("deck index backfill: %w", err)
+	}
+	return kv.Put(ctx, deckBackfillKey, []byte("1"))
+}
+
+// sortDecks orders decks by field, breaking ties by key so pages are stable
+func sortDecks(decks []DeckEntry, field string, desc bool) {
+	compare := func(a, b *DeckEntry) int {
+		switch field {
+		case SortTitle:
+			return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		case SortProcessedAt:
+			return strings.Compare(a.ProcessedAt, b.ProcessedAt)
+		case SortUpdatedAt:
+			return strings.Compare(a.UpdatedAt, b.UpdatedAt)
+		case SortSlideCount:
+			return a.SlideCount - b.SlideCount
+		case SortStatus:
+			return strings.Compare(a.Status, b.Status)
+		}
+		return 0
+	}
+	sort.SliceStable(decks, func(i, j int) bool {
+		c := compare(&decks[i], &decks[j])
+		if c == 0 {
+			c = strings.Compare(decks[i].Key, decks[j].Key)
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// ReindexDecks rebuilds the deck index from the manifests in output storage
+// With a catalog, entries indexed in KV are copied over first, so decks that never
+// rendered keep their status. Renders keep the index current; ScheduleDeckBackfill runs this once.
+func (p *Processor) ReindexDecks(ctx context.Context) (int, error) {
+	kv := p.kv()
+	if p.catalog() != nil {
+		keys, err := runtime.ListAllKV(ctx, kv, deckPrefix)
+		if err != nil {
+			return 0, err
+		}
+		for _, kvKey := range keys {
+			if e := p.kvDeckEntry(ctx, strings.TrimPrefix(kvKey, deckPrefix)); e != nil {
+				if err := p.storeDeck(ctx, e); err != nil {
+					return 0, fmt.Errorf("index %s: %w", e.Key, err)
+				}
+			}
+		}
+	}
+
+	list, err := p.output().List(ctx, "", "")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, outKey := range list.Keys {
+		if !strings.HasSuffix(outKey, "/manifest.json") || IsReserved(outKey) {
+			continue
+		}
+		m, err := p.Manifest(ctx, strings.TrimSuffix(outKey, "/manifest.json"))
+		if err != nil || m == nil {
+			continue
+		}
+
+		e := DeckEntry{
+			Key:         m.SourceKey,
+			BaseName:    BaseName(m.SourceKey),
+			Title:       m.Title,
+			SlideCount:  m.SlideCount,
+			ProcessedAt: m.ProcessedAt,
+			Status:      StatusComplete,
+			ETag:        p.RenderedVersion(ctx, m.SourceKey),
+			UpdatedAt:   m.ProcessedAt,
+		}
+		if m.SlideCount > 0 {
+			e.Thumbnail = p.storedThumbnail(ctx, e.BaseName)
+		}
+		if data, err := kv.Get(ctx, StatusKey(m.SourceKey)); err == nil && data != nil {
+			var s Status
+			if json.Unmarshal(data, &s) == nil {
+				e.Status, e.Error, e.UpdatedAt = s.Status, s.Error, s.UpdatedAt
+			}
+		}
+
+		if err := p.storeDeck(ctx, &e); err != nil {
+			return count, fmt.Errorf("index %s: %w", m.SourceKey, err)
+		}
+		count++
+	}
+	return count, nil
+}
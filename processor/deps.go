@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// KV prefixes of the reverse dependency index
+// Each edge is its own key so updates never need a read-modify-write:
+//
+//	deps:<library>|<deck>  -> "1"                        (reverse edge, both parts escaped)
+//	imports:<deck>         -> ["lib/a.dsh","lib/b.dsh"]  (forward list, to drop stale edges)
+//	fanout:<library>       -> "1"                        (dependents not yet all queued)
+const (
+	depsPrefix    = "deps:"
+	importsPrefix = "imports:"
+	fanoutPrefix  = "fanout:"
+	depsSeparator = "|"
+)
+
+// depsEscaper keeps the separator out of the keys on either side of it
+var (
+	depsEscaper   = strings.NewReplacer("%", "%25", depsSeparator, "%7C")
+	depsUnescaper = strings.NewReplacer("%7C", depsSeparator, "%25", "%")
+)
+
+// depsKey returns the reverse edge recording that deck depends on lib
+func depsKey(lib, deck string) string {
+	return depsPrefix + depsEscaper.Replace(lib) + depsSeparator + depsEscaper.Replace(deck)
+}
+
+// Dependents returns the decks that import or include lib, directly or transitively
+func (p *Processor) Dependents(ctx context.Context, lib string) ([]string, error) {
+	prefix := depsPrefix + depsEscaper.Replace(lib) + depsSeparator
+	keys, err := runtime.ListAllKV(ctx, p.kv(), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make([]string, len(keys))
+	for i, k := range keys {
+		deps[i] = depsUnescaper.Replace(strings.TrimPrefix(k, prefix))
+	}
+	return deps, nil
+}
+
+// Dependencies returns the libraries key was expanded with on its last render
+func (p *Processor) Dependencies(ctx context.Context, key string) []string {
+	data, err := p.kv().Get(ctx, importsPrefix+key)
+	if err != nil || data == nil {
+		return nil
+	}
+	var libs []string
+	json.Unmarshal(data, &libs)
+	return libs
+}
+
+// recordDependencies replaces the dependency edges of key with libs
+func (p *Processor) recordDependencies(ctx context.Context, key string, libs []string) {
+	kv := p.kv()
+
+	current := make(map[string]bool, len(libs))
+	for _, lib := range libs {
+		current[lib] = true
+	}
+	for _, lib := range p.Dependencies(ctx, key) {
+		if !current[lib] {
+			kv.Delete(ctx, depsKey(lib, key))
+		}
+	}
+
+	if len(libs) == 0 {
+		kv.Delete(ctx, importsPrefix+key)
+		return
+	}
+	for _, lib := range libs {
+		kv.Put(ctx, depsKey(lib, key), []byte("1"))
+	}
+	data, _ := json.Marshal(libs)
+	kv.Put(ctx, importsPrefix+key, data)
+}
+
+// renderDependents re-renders every deck that depends on lib
+// Jobs go through the queue when there is one; otherwise they run inline, and
+// failures are recorded in each dependent's status rather than returned.
+// Until every job is queued, a fanout marker stays behind so that a retry of
+// lib, skipped as an already-rendered version, still redoes the fan-out.
+func (p *Processor) renderDependents(ctx context.Context, lib string) error {
+	deps, err := p.Dependents(ctx, lib)
+	if err == nil && len(deps) == 0 {
+		return nil
+	}
+	p.kv().PutWithTTL(ctx, fanoutPrefix+lib, []byte("1"), RenderedTTL)
+	if err != nil {
+		return &Error{Stage: StageDependents, Err: err}
+	}
+
+	for _, dep := range deps {
+		job := Job{Key: dep, Action: ActionRender, Force: true}
+		if p.Queue != nil {
+			if err := p.Queue.Enqueue(ctx, job); err != nil {
+				return &Error{Stage: StageDependents, Err: err}
+			}
+			continue
+		}
+		p.Handle(ctx, job)
+	}
+	p.kv().Delete(ctx, fanoutPrefix+lib)
+	return nil
+}
+
+// fanoutPending reports whether a fan-out from lib did not finish
+func (p *Processor) fanoutPending(ctx context.Context, lib string) bool {
+	data, err := p.kv().Get(ctx, fanoutPrefix+lib)
+	return err == nil && data != nil
+}
@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+func (p *Processor) catalog() catalog.Catalog {
+	if p.Catalog != nil {
+		return p.Catalog
+	}
+	return runtime.Catalog()
+}
+
+// recordSource upserts the source in the catalog
+// Catalog failures are logged, never fatal: KV status stays authoritative.
+func (p *Processor) recordSource(ctx context.Context, key string, source []byte, version string) bool {
+	cat := p.catalog()
+	if cat == nil {
+		return false
+	}
+
+	_, err := cat.RecordSource(ctx, catalog.Source{
+		Key:         key,
+		SizeBytes:   int64(len(source)),
+		ETag:        version,
+		ContentHash: contentHash(source),
+	})
+	if err != nil {
+		log.Printf("catalog: record source %s: %v", key, err)
+		return false
+	}
+	return true
+}
+
+// startRun records the source and opens a processing run, returning 0 without a catalog
+func (p *Processor) startRun(ctx context.Context, key string, source []byte, version string) int64 {
+	if !p.recordSource(ctx, key, source, version) {
+		return 0
+	}
+
+	runID, err := p.catalog().StartRun(ctx, key, p.WorkerID)
+	if err != nil {
+		log.Printf("catalog: start run %s: %v", key, err)
+		return 0
+	}
+	return runID
+}
+
+// finishRun records the outcome and outputs of a run opened by startRun
+func (p *Processor) finishRun(ctx context.Context, runID int64, result *Result, err error, started time.Time) {
+	if runID == 0 {
+		return
+	}
+	cat := p.catalog()
+
+	outcome := catalog.RunResult{
+		Status:   catalog.RunComplete,
+		Duration: time.Since(started),
+	}
+	if err != nil {
+		outcome.Status = catalog.RunError
+		outcome.Error = err.Error()
+	} else {
+		outcome.SlideCount = result.SlideCount
+		outcome.Title = result.Title
+	}
+
+	if err := cat.FinishRun(ctx, runID, outcome); err != nil {
+		log.Printf("catalog: finish run %d: %v", runID, err)
+	}
+	if result != nil && len(result.outputs) > 0 {
+		if err := cat.RecordOutputs(ctx, runID, result.outputs); err != nil {
+			log.Printf("catalog: record outputs %d: %v", runID, err)
+		}
+	}
+}
+
+// forgetSource soft-deletes a source in the catalog
+func (p *Processor) forgetSource(ctx context.Context, key string) {
+	if cat := p.catalog(); cat != nil {
+		if err := cat.DeleteSource(ctx, key); err != nil {
+			log.Printf("catalog: delete source %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+// Package processor implements the upload → render → store flow shared by all runtimes
+//
+// Both the HTTP upload handler and the background consumers (Cloudflare queue,
+// native filesystem watcher) call into a Processor so that source reading,
+// import expansion, rendering, output layout, status and events stay identical.
+package processor
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// StatusTTL is how long processing status records are kept in KV
+// Stale entries for deleted or long-idle decks expire on their own
+const StatusTTL = 30 * 24 * time.Hour
+
+// RenderedTTL is how long the last-rendered source version is remembered
+const RenderedTTL = StatusTTL
+
+// Processing status values stored under "status:<key>"
+const (
+	StatusProcessing = "processing"
+	StatusComplete   = "complete"
+	StatusError      = "error"
+	StatusLibrary    = "library" // Not a deck; rendered through its dependents
+)
+
+// Stages at which processing can fail
+const (
+	StageRead       = "read"
+	StageImports    = "imports"
+	StageRender     = "render"
+	StageStore      = "store"
+	StageDependents = "dependents" // Queueing re-renders of the decks that import a source
+)
+
+// Error is a processing failure tagged with the stage it happened in
+type Error struct {
+	Stage string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	switch e.Stage {
+	case StageRead:
+		return "failed to read source: " + e.Err.Error()
+	case StageImports:
+		return "import resolution failed: " + e.Err.Error()
+	case StageStore:
+		return "failed to store output: " + e.Err.Error()
+	case StageDependents:
+		return "failed to re-render dependents: " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the failure is transient (storage, or no render
+// capacity) rather than bad source
+func (e *Error) Retryable() bool {
+	var lerr *pipeline.LimitError
+	if errors.As(e.Err, &lerr) && lerr.Overloaded() {
+		return true
+	}
+	return e.Stage == StageRead || e.Stage == StageStore || e.Stage == StageDependents
+}
+
+// Status is the processing status record stored in KV
+type Status struct {
+	Status    string `json:"status"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Manifest describes a rendered deck, stored as <baseName>/manifest.json
+type Manifest struct {
+	SourceKey   string     `json:"sourceKey"`
+	ProcessedAt string     `json:"processedAt"`
+	Title       string     `json:"title"`
+	SlideCount  int        `json:"slideCount"`
+	Slides      []SlideRef `json:"slides"`
+}
+
+// SlideRef points at one rendered slide in output storage
+type SlideRef struct {
+	Number int    `json:"number"`
+	Key    string `json:"key"`
+}
+
+// Result describes a completed render
+type Result struct {
+	Key        string
+	Title      string
+	SlideCount int
+	Slides     []string // Output storage keys, in slide order
+	Duration   time.Duration
+	Library    bool   // Source is a library file; only its dependents were rendered
+	Version    int    // Retained source version number, 0 if versions are unavailable
+	Thumbnail  string // Output key of the stored PNG preview, if one was made
+
+	outputs []catalog.Output
+	slides  [][]byte // Rendered SVGs, for version snapshots
+}
+
+// Processor renders decksh sources from input storage into output storage
+// Nil dependencies fall back to the global runtime at call time.
+type Processor struct {
+	Input    runtime.Storage
+	Output   runtime.Storage
+	KV       runtime.KVStore
+	Pipeline runtime.Pipeline
+	Catalog  catalog.Catalog // Optional; falls back to runtime.Catalog()
+	Queue    Queue           // Optional; dependents are re-rendered inline when nil
+	WorkerID string          // Recorded on catalog runs
+
+	classify       classifyCache
+	backfillQueued atomic.Bool // The deck index backfill job was sent
+}
+
+// New creates a processor backed by the global runtime
+func New() *Processor {
+	return &Processor{}
+}
+
+func (p *Processor) input() runtime.Storage {
+	if p.Input != nil {
+		return p.Input
+	}
+	return runtime.Input()
+}
+
+func (p *Processor) output() runtime.Storage {
+	if p.Output != nil {
+		return p.Output
+	}
+	return runtime.Output()
+}
+
+func (p *Processor) kv() runtime.KVStore {
+	if p.KV != nil {
+		return p.KV
+	}
+	return runtime.KV()
+}
+
+// kvAttempts bounds compare-and-swap retries of a KV read-modify-write
+const kvAttempts = 5
+
+// errKVContended is returned when every compare-and-swap attempt lost
+var errKVContended = errors.New("kv update contended")
+
+// updateKV replaces the value at key with what update returns for the current one
+// update returns nil to leave the value unchanged. With an AtomicKV the write is
+// a compare-and-swap and update reruns on the fresh value when it loses; Cloudflare
+// KV has none, so there concurrent updates are last-write-wins.
+func (p *Processor) updateKV(ctx context.Context, key string, update func(old []byte) ([]byte, error)) error {
+	kv := p.kv()
+	atomic, isAtomic := kv.(runtime.AtomicKV)
+
+	for attempt := 1; ; attempt++ {
+		old, err := kv.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		value, err := update(old)
+		if err != nil || value == nil {
+			return err
+		}
+
+		if !isAtomic {
+			return kv.Put(ctx, key, value)
+		}
+		swapped, err := atomic.CompareAndSwap(ctx, key, old, value, 0)
+		if err != nil || swapped {
+			return err
+		}
+		if attempt == kvAttempts {
+			return errKVContended
+		}
+	}
+}
+
+func (p *Processor) pipeline() runtime.Pipeline {
+	if p.Pipeline != nil {
+		return p.Pipeline
+	}
+	return runtime.GetPipeline()
+}
+
+// Process reads the source at key from input storage and renders it
+func (p *Processor) Process(ctx context.Context, key string) (*Result, error) {
+	source, err := p.readSource(ctx, key)
+	if err != nil {
+		return nil, p.fail(ctx, key, &Error{Stage: StageRead, Err: err}, time.Now())
+	}
+
+	return p.ProcessSource(ctx, key, source)
+}
+
+// ProcessSource renders source that the caller has already stored at key
+// Decks that import or include key are re-rendered afterwards.
+func (p *Processor) ProcessSource(ctx context.Context, key string, source []byte) (*Result, error) {
+	return p.process(ctx, key, source, ContentVersion(source), true)
+}
+
+// processJob renders the source for a render job
+// Versions that were already rendered are skipped unless the job is forced.
+// A new version is announced as deck.uploaded first: sources written straight
+// to R2 or the input directory never pass through the upload handler, and an
+// upload the handler already rendered is skipped here as a duplicate.
+func (p *Processor) processJob(ctx context.Context, job Job) error {
+	source, err := p.readSource(ctx, job.Key)
+	if err != nil {
+		return p.fail(ctx, job.Key, &Error{Stage: StageRead, Err: err}, time.Now())
+	}
+
+	version := strings.Trim(job.ETag, `"`)
+	if version == "" {
+		version = ContentVersion(source)
+	}
+	if !job.Force && p.RenderedVersion(ctx, job.Key) == version {
+		// A retry after the fan-out to dependents failed
+		if p.fanoutPending(ctx, job.Key) {
+			return p.renderDependents(ctx, job.Key)
+		}
+		return nil
+	}
+	if !job.Force {
+		runtime.PublishEvent(ctx, runtime.Event{Type: runtime.EventDeckUploaded, Key: job.Key})
+	}
+
+	// Forced jobs come from a dependency change; their own dependents are already covered
+	_, err = p.process(ctx, job.Key, source, version, !job.Force)
+	return err
+}
+
+// process renders a deck, or records a library file, then optionally re-renders dependents
+func (p *Processor) process(ctx context.Context, key string, source []byte, version string, cascade bool) (*Result, error) {
+	var result *Result
+	var err error
+
+	if pipeline.IsRenderable(source) {
+		started := time.Now()
+		runID := p.startRun(ctx, key, source, version)
+		retained := p.recordVersion(ctx, key, source, version, 0)
+		p.catalogVersion(ctx, key, retained)
+		p.SetStatus(ctx, key, StatusProcessing, "")
+		runtime.PublishEvent(ctx, runtime.Event{Type: runtime.EventDeckProcessing, Key: key})
+		result, err = p.render(ctx, key, source, version, started)
+		p.finishRun(ctx, runID, result, err, started)
+		if err == nil {
+			p.snapshotVersion(ctx, key, retained, result)
+			if retained != nil {
+				result.Version = retained.Number
+			}
+		}
+	} else {
+		// Def-only libraries and include fragments have nothing to render on their own
+		p.recordSource(ctx, key, source, version)
+		retained := p.recordVersion(ctx, key, source, version, 0)
+		p.catalogVersion(ctx, key, retained)
+		p.kv().PutWithTTL(ctx, RenderedKey(key), []byte(version), RenderedTTL)
+		p.SetStatus(ctx, key, StatusLibrary, "")
+		result = &Result{Key: key, Library: true}
+		if retained != nil {
+			result.Version = retained.Number
+		}
+	}
+
+	if cascade {
+		if derr := p.renderDependents(ctx, key); derr != nil && err == nil {
+			err = derr
+		}
+	}
+	return result, err
+}
+
+// render expands imports, renders slides and stores slides + manifest
+// version identifies the source revision and is recorded once rendering succeeds.
+func (p *Processor) render(ctx context.Context, key string, source []byte, version string, started time.Time) (*Result, error) {
+	// Expand imports from input storage, recording what this deck depends on
+	var deps []string
+	if pipeline.HasImports(source) {
+		resolver := pipeline.NewImportResolver(pipeline.StorageLoader(p.input()), "")
+		expanded, err := resolver.Expand(ctx, source, key)
+		if err != nil {
+			// Includes the missing file, so uploading it re-renders this deck
+			p.recordDependencies(ctx, key, resolver.Dependencies())
+			return nil, p.fail(ctx, key, &Error{Stage: StageImports, Err: err}, started)
+		}
+		source = expanded
+		deps = resolver.Dependencies()
+	}
+	p.recordDependencies(ctx, key, deps)
+
+	rendered, err := p.pipeline().ProcessWithWorkDir(ctx, source, runtime.FormatSVG, WorkDir(p.input(), key))
+	if err != nil {
+		return nil, p.fail(ctx, key, &Error{Stage: StageRender, Err: err}, started)
+	}
+
+	// Remember what is stored now so slides beyond the new count can be pruned
+	output := p.output()
+	baseName := BaseName(key)
+	previous := p.storedSlides(ctx, baseName)
+
+	// Store slides
+	slideKeys := make([]string, len(rendered.Slides))
+	outputs := make([]catalog.Output, 0, len(rendered.Slides)+1)
+	for i, slide := range rendered.Slides {
+		slideKeys[i] = SlideKey(baseName, i+1)
+		if err := output.Put(ctx, slideKeys[i], slide, "image/svg+xml"); err != nil {
+			return nil, p.fail(ctx, key, &Error{Stage: StageStore, Err: fmt.Errorf("slide %d: %w", i+1, err)}, started)
+		}
+		outputs = append(outputs, catalog.Output{
+			Key:         slideKeys[i],
+			FileType:    catalog.FileSVG,
+			SlideNumber: i + 1,
+			SizeBytes:   int64(len(slide)),
+		})
+	}
+
+	// Store manifest
+	manifest := Manifest{
+		SourceKey:   key,
+		ProcessedAt: time.Now().UTC().Format(time.RFC3339),
+		Title:       rendered.Title,
+		SlideCount:  rendered.SlideCount,
+		Slides:      make([]SlideRef, len(slideKeys)),
+	}
+	for i, slideKey := range slideKeys {
+		manifest.Slides[i] = SlideRef{Number: i + 1, Key: slideKey}
+	}
+	manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := output.Put(ctx, ManifestKey(baseName), manifestJSON, "application/json"); err != nil {
+		return nil, p.fail(ctx, key, &Error{Stage: StageStore, Err: fmt.Errorf("manifest: %w", err)}, started)
+	}
+	outputs = append(outputs, catalog.Output{
+		Key:       ManifestKey(baseName),
+		FileType:  catalog.FileManifest,
+		SizeBytes: int64(len(manifestJSON)),
+	})
+
+	// Prune orphaned slides left over from a longer previous render
+	for _, slideKey := range slideKeys {
+		delete(previous, slideKey)
+	}
+	for slideKey := range previous {
+		output.Delete(ctx, slideKey)
+	}
+
+	// The deck model feeds the search index and thumbnails
+	parsed, err := runtime.Parse(ctx, source)
+	if err != nil {
+		log.Printf("processor: parse %s: %v", key, err)
+	}
+	thumbs := p.storeThumbnails(ctx, key, parsed)
+	outputs = append(outputs, thumbs...)
+
+	result := &Result{
+		Key:        key,
+		Title:      rendered.Title,
+		SlideCount: rendered.SlideCount,
+		Slides:     slideKeys,
+		Duration:   time.Since(started),
+		outputs:    outputs,
+		slides:     rendered.Slides,
+	}
+	if len(thumbs) > 0 {
+		result.Thumbnail = thumbs[0].Key
+	}
+
+	p.indexDeck(ctx, key, parsed, rendered.Title, rendered.SlideCount)
+	p.kv().PutWithTTL(ctx, RenderedKey(key), []byte(version), RenderedTTL)
+	p.setStatus(ctx, key, StatusComplete, "", result, version)
+	runtime.PublishEvent(ctx, runtime.Event{
+		Type:       runtime.EventDeckRendered,
+		Key:        key,
+		SlideCount: result.SlideCount,
+		DurationMs: result.Duration.Milliseconds(),
+	})
+
+	return result, nil
+}
+
+// Delete removes the rendered slides, manifest, status and version marker of a source key
+// Retained versions are kept so a deleted deck can still be inspected or rolled back.
+func (p *Processor) Delete(ctx context.Context, key string) error {
+	output := p.output()
+	baseName := BaseName(key)
+
+	var errs []error
+	for slideKey := range p.storedSlides(ctx, baseName) {
+		if err := output.Delete(ctx, slideKey); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := output.Delete(ctx, ManifestKey(baseName)); err != nil {
+		errs = append(errs, err)
+	}
+	p.deleteThumbnails(ctx, baseName)
+	if len(errs) > 0 {
+		return &Error{Stage: StageStore, Err: errors.Join(errs...)}
+	}
+
+	kv := p.kv()
+	kv.Delete(ctx, StatusKey(key))
+	kv.Delete(ctx, RenderedKey(key))
+	p.removeDeck(ctx, key)
+	p.recordDependencies(ctx, key, nil)
+	p.unindexDeck(ctx, key)
+	p.forgetSource(ctx, key)
+
+	runtime.PublishEvent(ctx, runtime.Event{Type: runtime.EventDeckDeleted, Key: key})
+
+	// Decks that used a deleted library now fail visibly instead of keeping stale output
+	return p.renderDependents(ctx, key)
+}
+
+// Manifest returns the stored manifest for a deck, or nil if it has none
+func (p *Processor) Manifest(ctx context.Context, baseName string) (*Manifest, error) {
+	reader, err := p.output().Get(ctx, ManifestKey(baseName))
+	if err != nil {
+		return nil, nil
+	}
+	defer reader.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(reader).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// storedSlides returns the slide keys currently in output storage for a deck
+// The manifest is authoritative; a listing catches slides from interrupted renders.
+func (p *Processor) storedSlides(ctx context.Context, baseName string) map[string]bool {
+	keys := make(map[string]bool)
+
+	if m, _ := p.Manifest(ctx, baseName); m != nil {
+		for _, s := range m.Slides {
+			keys[s.Key] = true
+		}
+		if len(m.Slides) == 0 {
+			// Manifests written before slides were recorded only have a count
+			for i := 1; i <= m.SlideCount; i++ {
+				keys[SlideKey(baseName, i)] = true
+			}
+		}
+	}
+
+	if list, err := p.output().List(ctx, baseName+"/", "/"); err == nil {
+		for _, k := range list.Keys {
+			if IsSlideKey(baseName, k) {
+				keys[k] = true
+			}
+		}
+	}
+	return keys
+}
+
+// fail records an error status, publishes deck.failed and returns err
+func (p *Processor) fail(ctx context.Context, key string, err *Error, started time.Time) error {
+	p.SetStatus(ctx, key, StatusError, err.Error())
+	runtime.PublishEvent(ctx, runtime.Event{
+		Type:       runtime.EventDeckFailed,
+		Key:        key,
+		Error:      err.Error(),
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+	return err
+}
+
+// SetStatus records the processing status of a source key in KV
+func (p *Processor) SetStatus(ctx context.Context, key, status, errMsg string) {
+	p.setStatus(ctx, key, status, errMsg, nil, "")
+}
+
+// setStatus records a status and updates the deck index, including render results when given
+func (p *Processor) setStatus(ctx context.Context, key, status, errMsg string, result *Result, version string) {
+	data, _ := json.Marshal(Status{
+		Status:    status,
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		Error:     errMsg,
+	})
+	p.kv().PutWithTTL(ctx, StatusKey(key), data, StatusTTL)
+	p.updateDeck(ctx, key, status, errMsg, result, version)
+}
+
+// RenderedVersion returns the source version last rendered for key, or "" if unknown
+func (p *Processor) RenderedVersion(ctx context.Context, key string) string {
+	data, err := p.kv().Get(ctx, RenderedKey(key))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (p *Processor) readSource(ctx context.Context, key string) ([]byte, error) {
+	reader, err := p.input().Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// WorkDir returns the filesystem directory containing key, if storage maps to a local filesystem
+// The native pipeline runs decksh there so data files (.d, .kml) and images resolve
+func WorkDir(storage runtime.Storage, key string) string {
+	fsStorage, ok := storage.(runtime.FilesystemStorage)
+	if !ok {
+		return ""
+	}
+
+	deckDir := ""
+	if idx := strings.LastIndex(key, "/"); idx >= 0 {
+		deckDir = key[:idx]
+	}
+
+	fullPath, err := fsStorage.FullPath(deckDir)
+	if err != nil {
+		return ""
+	}
+	return fullPath
+}
+
+// BaseName returns the output prefix for a source key ("talks/intro.dsh" -> "talks/intro")
+func BaseName(key string) string {
+	return strings.TrimSuffix(key, ".dsh")
+}
+
+// SlideKey returns the output key of a 1-based slide number
+func SlideKey(baseName string, number int) string {
+	return fmt.Sprintf("%s/slide-%04d.svg", baseName, number)
+}
+
+// ManifestKey returns the output key of a deck manifest
+func ManifestKey(baseName string) string {
+	return baseName + "/manifest.json"
+}
+
+// StatusKey returns the KV key holding a source's processing status
+func StatusKey(key string) string {
+	return "status:" + key
+}
+
+// RenderedKey returns the KV key holding the last rendered source version
+func RenderedKey(key string) string {
+	return "rendered:" + key
+}
+
+// ContentVersion identifies a source revision by content
+// It is the hex MD5 of the bytes, which matches the R2 ETag of single-part
+// uploads, so a notification for an object we just rendered is a duplicate.
+func ContentVersion(source []byte) string {
+	sum := md5.Sum(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// IsSlideKey reports whether key is a slide directly under baseName
+func IsSlideKey(baseName, key string) bool {
+	name, ok := strings.CutPrefix(key, baseName+"/")
+	return ok && !strings.Contains(name, "/") &&
+		strings.HasPrefix(name, "slide-") && strings.HasSuffix(name, ".svg")
+}
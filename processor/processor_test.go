@@ -0,0 +1,749 @@
+//go:build !cloudflare
+
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/pkg/thumbnail"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// fakePipeline renders one slide per "slide" line and fails on "fail"
+type fakePipeline struct{}
+
+func (fakePipeline) Process(ctx context.Context, source []byte, format runtime.Format) (*runtime.ProcessResult, error) {
+	return fakePipeline{}.ProcessWithWorkDir(ctx, source, format, "")
+}
+
+func (fakePipeline) ProcessWithWorkDir(ctx context.Context, source []byte, format runtime.Format, workDir string) (*runtime.ProcessResult, error) {
+	if strings.Contains(string(source), "fail") {
+		return nil, errors.New("bad source")
+	}
+	result := &runtime.ProcessResult{Title: "Test"}
+	for _, line := range strings.Split(string(source), "\n") {
+		if strings.TrimSpace(line) == "slide" {
+			result.Slides = append(result.Slides, []byte("<svg/>"))
+		}
+	}
+	result.SlideCount = len(result.Slides)
+	return result, nil
+}
+
+func (fakePipeline) SupportedFormats() []runtime.Format {
+	return []runtime.Format{runtime.FormatSVG}
+}
+
+func newTestProcessor(t *testing.T) *Processor {
+	t.Helper()
+	input, err := runtime.NewLocalFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := runtime.NewLocalFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Processor{
+		Input:    input,
+		Output:   output,
+		KV:       runtime.NewMemoryKV(),
+		Pipeline: fakePipeline{},
+	}
+}
+
+func readStatus(t *testing.T, p *Processor, key string) Status {
+	t.Helper()
+	data, err := p.KV.Get(context.Background(), StatusKey(key))
+	if err != nil || data == nil {
+		t.Fatalf("no status for %s: %v", key, err)
+	}
+	var s Status
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestProcess_StoresSlidesAndManifest(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	p.Input.Put(ctx, "talks/intro.dsh", []byte("deck\nslide\nslide\nedeck\n"), "text/plain")
+
+	result, err := p.Process(ctx, "talks/intro.dsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SlideCount != 2 || result.Slides[1] != "talks/intro/slide-0002.svg" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	reader, err := p.Output.Get(ctx, "talks/intro/manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.SourceKey != "talks/intro.dsh" || m.SlideCount != 2 || len(m.Slides) != 2 || m.Slides[0].Key != "talks/intro/slide-0001.svg" {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+
+	if s := readStatus(t, p, "talks/intro.dsh"); s.Status != StatusComplete {
+		t.Errorf("status = %+v", s)
+	}
+}
+
+func TestProcess_RenderErrorIsNotRetryable(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	p.Input.Put(ctx, "bad.dsh", []byte("deck\nfail"), "text/plain")
+
+	_, err := p.Process(ctx, "bad.dsh")
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Stage != StageRender || perr.Retryable() {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := readStatus(t, p, "bad.dsh"); s.Status != StatusError || s.Error != "bad source" {
+		t.Errorf("status = %+v", s)
+	}
+
+	_, err = p.Process(ctx, "missing.dsh")
+	if !errors.As(err, &perr) || perr.Stage != StageRead || !perr.Retryable() {
+		t.Fatalf("unexpected error for missing source: %v", err)
+	}
+}
+
+func TestError_OverloadIsRetryable(t *testing.T) {
+	overloaded := &Error{Stage: StageRender, Err: &pipeline.LimitError{Limit: pipeline.LimitQueue, Max: 8, Unit: "renders"}}
+	tooLarge := &Error{Stage: StageRender, Err: &pipeline.LimitError{Limit: pipeline.LimitSlides, Max: 8, Actual: 9, Unit: "slides"}}
+	if !overloaded.Retryable() || tooLarge.Retryable() {
+		t.Errorf("Retryable() = %v for overload, %v for too many slides", overloaded.Retryable(), tooLarge.Retryable())
+	}
+}
+
+func TestMemoryQueue_CoalescesPendingJobs(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var handled []Job
+	release := make(chan struct{})
+	q := NewMemoryQueue(func(ctx context.Context, job Job) error {
+		<-release
+		mu.Lock()
+		handled = append(handled, job)
+		mu.Unlock()
+		return nil
+	}, 8)
+
+	// Enqueue before starting so every job is still pending
+	for i := 0; i < 3; i++ {
+		q.Enqueue(ctx, Job{Key: "a.dsh", Action: ActionRender})
+	}
+	q.Enqueue(ctx, Job{Key: "b.dsh", Action: ActionRender})
+
+	q.Start(ctx, 1)
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(handled)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handled %d jobs, want 2", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	q.Close()
+
+	if err := q.Enqueue(ctx, Job{Key: "c.dsh"}); err != ErrQueueClosed {
+		t.Errorf("enqueue after close = %v", err)
+	}
+}
+
+// recordingQueue collects enqueued jobs
+type recordingQueue struct {
+	jobs []Job
+}
+
+func (q *recordingQueue) Enqueue(ctx context.Context, job Job) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestWatcher_EnqueuesChangedDecks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "talks"), 0755)
+	os.WriteFile(filepath.Join(dir, "talks", "old.dsh"), []byte("deck"), 0644)
+
+	q := &recordingQueue{}
+	w := NewWatcher(dir, q, time.Hour)
+	seen, err := w.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.seen = seen
+
+	os.WriteFile(filepath.Join(dir, "talks", "new.dsh"), []byte("deck"), 0644)
+	os.WriteFile(filepath.Join(dir, "talks", "notes.txt"), []byte("ignored"), 0644)
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.jobs) != 1 || q.jobs[0].Key != "talks/new.dsh" {
+		t.Fatalf("jobs = %+v", q.jobs)
+	}
+
+	// Unchanged tree enqueues nothing
+	q.jobs = nil
+	w.Poll(ctx)
+	if len(q.jobs) != 0 {
+		t.Errorf("unexpected jobs: %+v", q.jobs)
+	}
+
+	// Modified file is picked up
+	os.WriteFile(filepath.Join(dir, "talks", "old.dsh"), []byte("deck\nslide"), 0644)
+	q.jobs = nil
+	w.Poll(ctx)
+	if len(q.jobs) != 1 || q.jobs[0].Key != "talks/old.dsh" || q.jobs[0].Action != ActionRender {
+		t.Errorf("jobs = %+v", q.jobs)
+	}
+
+	// Removed file enqueues a delete
+	os.Remove(filepath.Join(dir, "talks", "new.dsh"))
+	q.jobs = nil
+	w.Poll(ctx)
+	if len(q.jobs) != 1 || q.jobs[0].Key != "talks/new.dsh" || q.jobs[0].Action != ActionDelete {
+		t.Errorf("jobs = %+v", q.jobs)
+	}
+}
+
+func TestProcess_PrunesOrphanedSlides(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+
+	p.Input.Put(ctx, "a.dsh", []byte("deck\nslide\nslide\nslide"), "text/plain")
+	if _, err := p.Process(ctx, "a.dsh"); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Input.Put(ctx, "a.dsh", []byte("deck\nslide"), "text/plain")
+	if _, err := p.Process(ctx, "a.dsh"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := p.Output.List(ctx, "a/", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"a/slide-0001.svg": true, "a/manifest.json": true}
+	if len(list.Keys) != len(want) {
+		t.Fatalf("keys = %v", list.Keys)
+	}
+	for _, k := range list.Keys {
+		if !want[k] {
+			t.Errorf("unexpected key %s", k)
+		}
+	}
+}
+
+func TestDelete_RemovesOutputAndStatus(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+
+	p.Input.Put(ctx, "talks/a.dsh", []byte("deck\nslide\nslide"), "text/plain")
+	p.Input.Put(ctx, "talks/a/sub.dsh", []byte("deck\nslide"), "text/plain")
+	p.Process(ctx, "talks/a.dsh")
+	p.Process(ctx, "talks/a/sub.dsh")
+
+	if err := p.Handle(ctx, Job{Key: "talks/a.dsh", Action: ActionDelete}); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, _ := p.Manifest(ctx, "talks/a"); m != nil {
+		t.Error("manifest still present")
+	}
+	if data, _ := p.KV.Get(ctx, StatusKey("talks/a.dsh")); data != nil {
+		t.Error("status still present")
+	}
+	if p.RenderedVersion(ctx, "talks/a.dsh") != "" {
+		t.Error("rendered marker still present")
+	}
+
+	// A nested deck sharing the prefix is untouched
+	if m, _ := p.Manifest(ctx, "talks/a/sub"); m == nil || m.SlideCount != 1 {
+		t.Errorf("nested deck manifest = %+v", m)
+	}
+	list, _ := p.Output.List(ctx, "talks/a/", "/")
+	for _, k := range list.Keys {
+		if IsSlideKey("talks/a", k) {
+			t.Errorf("slide %s not deleted", k)
+		}
+	}
+}
+
+func TestMemoryQueue_WorkersEnqueueWithoutBlocking(t *testing.T) {
+	ctx := context.Background()
+
+	// One worker fans out more jobs than the queue holds, like a library with
+	// many dependents
+	var q *MemoryQueue
+	var handled sync.WaitGroup
+	handled.Add(21)
+	q = NewMemoryQueue(func(ctx context.Context, job Job) error {
+		if job.Key == "lib.dsh" {
+			for i := range 20 {
+				if err := q.Enqueue(ctx, Job{Key: fmt.Sprintf("dep%d.dsh", i)}); err != nil {
+					t.Errorf("enqueue dependent: %v", err)
+				}
+			}
+		}
+		handled.Done()
+		return nil
+	}, 2)
+	q.Start(ctx, 1)
+	defer q.Close()
+	q.Enqueue(ctx, Job{Key: "lib.dsh"})
+
+	done := make(chan struct{})
+	go func() { handled.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker deadlocked on its own queue")
+	}
+}
+
+func TestHandle_LibraryChangeRerendersDependents(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+
+	p.Input.Put(ctx, "lib/theme.dsh", []byte("def title X\nedef"), "text/plain")
+	p.Input.Put(ctx, "talks/a.dsh", []byte("import \"../lib/theme.dsh\"\ndeck\nslide\nedeck"), "text/plain")
+	p.Input.Put(ctx, "talks/b.dsh", []byte("deck\nslide\nedeck"), "text/plain")
+	for _, key := range []string{"talks/a.dsh", "talks/b.dsh"} {
+		if err := p.Handle(ctx, Job{Key: key, Action: ActionRender}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deps, err := p.Dependents(ctx, "lib/theme.dsh")
+	if err != nil || len(deps) != 1 || deps[0] != "talks/a.dsh" {
+		t.Fatalf("dependents = %v, %v", deps, err)
+	}
+
+	// Editing the library re-renders only its dependent and never renders the library itself
+	pipe := &countingPipeline{}
+	p.Pipeline = pipe
+	p.Input.Put(ctx, "lib/theme.dsh", []byte("def title X Y\nedef"), "text/plain")
+	if err := p.Handle(ctx, Job{Key: "lib/theme.dsh", Action: ActionRender}); err != nil {
+		t.Fatal(err)
+	}
+	if pipe.calls != 1 {
+		t.Errorf("renders = %d, want 1", pipe.calls)
+	}
+	if s := readStatus(t, p, "lib/theme.dsh"); s.Status != StatusLibrary {
+		t.Errorf("library status = %+v", s)
+	}
+
+	// Dropping the import removes the edge
+	p.Input.Put(ctx, "talks/a.dsh", []byte("deck\nslide\nedeck"), "text/plain")
+	p.Handle(ctx, Job{Key: "talks/a.dsh", Action: ActionRender})
+	if deps, _ := p.Dependents(ctx, "lib/theme.dsh"); len(deps) != 0 {
+		t.Errorf("stale dependents: %v", deps)
+	}
+}
+
+// flakyQueue fails its first Enqueue and records the rest
+type flakyQueue struct {
+	failed bool
+	jobs   []Job
+}
+
+func (q *flakyQueue) Enqueue(ctx context.Context, job Job) error {
+	if !q.failed {
+		q.failed = true
+		return errors.New("queue unavailable")
+	}
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestHandle_DependentsFanOut(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	queue := &flakyQueue{}
+	p.Queue = queue
+
+	// A deck whose library is missing still records the dependency
+	p.Input.Put(ctx, "talks/a|b.dsh", []byte("import \"../lib/x|y.dsh\"\ndeck\nslide\nedeck"), "text/plain")
+	var perr *Error
+	if err := p.Handle(ctx, Job{Key: "talks/a|b.dsh", Action: ActionRender}); !errors.As(err, &perr) || perr.Stage != StageImports {
+		t.Fatalf("missing import: %v", err)
+	}
+	if deps, err := p.Dependents(ctx, "lib/x|y.dsh"); err != nil || len(deps) != 1 || deps[0] != "talks/a|b.dsh" {
+		t.Fatalf("dependents = %v, %v", deps, err)
+	}
+	if deps, _ := p.Dependents(ctx, "lib/x"); len(deps) != 0 {
+		t.Errorf("escaped key matched a shorter library: %v", deps)
+	}
+
+	// A failed fan-out is retryable, and the retry queues the dependent even
+	// though the library version itself was already recorded
+	p.Input.Put(ctx, "lib/x|y.dsh", []byte("def title X\nedef"), "text/plain")
+	job := Job{Key: "lib/x|y.dsh", Action: ActionRender}
+	err := p.Handle(ctx, job)
+	if !errors.As(err, &perr) || !perr.Retryable() {
+		t.Fatalf("fan-out error = %v, want retryable", err)
+	}
+	if err := p.Handle(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0] != (Job{Key: "talks/a|b.dsh", Action: ActionRender, Force: true}) {
+		t.Fatalf("queued = %+v", queue.jobs)
+	}
+	if err := p.Handle(ctx, job); err != nil || len(queue.jobs) != 1 {
+		t.Errorf("finished fan-out ran again: %v, %+v", err, queue.jobs)
+	}
+
+	// Jobs travel through a queue message and come back through the consumer
+	body, _ := JobMessage(queue.jobs[0])
+	m := &fakeMessage{id: "job", body: body, attempts: 1}
+	NewConsumer(p).Consume(ctx, m)
+	if !m.acked || readStatus(t, p, "talks/a|b.dsh").Status != StatusComplete {
+		t.Errorf("job message: acked=%v status=%+v", m.acked, readStatus(t, p, "talks/a|b.dsh"))
+	}
+}
+
+func TestProcessor_RecordsCatalog(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	cat, err := catalog.OpenSQLite(ctx, filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cat.Close()
+	p.Catalog = cat
+	p.WorkerID = "test"
+
+	p.Input.Put(ctx, "a.dsh", []byte("deck\nslide\nslide"), "text/plain")
+	if _, err := p.Process(ctx, "a.dsh"); err != nil {
+		t.Fatal(err)
+	}
+	p.Input.Put(ctx, "a.dsh", []byte("deck\nfail"), "text/plain")
+	p.Process(ctx, "a.dsh")
+
+	runs, err := cat.Runs(ctx, "a.dsh", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Status != catalog.RunError || runs[1].Status != catalog.RunComplete || runs[1].SlideCount != 2 || runs[1].WorkerID != "test" {
+		t.Fatalf("runs = %+v", runs)
+	}
+
+	if err := p.Delete(ctx, "a.dsh"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := cat.Status(ctx, "a.dsh"); status != nil {
+		t.Errorf("deleted source still in catalog: %+v", status)
+	}
+}
+
+func TestProcessor_VersionsAndRollback(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+
+	v1 := []byte("deck\nslide")
+	v2 := []byte("deck\nslide\nslide")
+	for _, source := range [][]byte{v1, v1, v2} {
+		p.Input.Put(ctx, "a.dsh", source, "text/plain")
+		if _, err := p.ProcessSource(ctx, "a.dsh", source); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := p.Versions(ctx, "a.dsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || !versions[0].Rendered || versions[0].SlideCount != 1 || versions[1].SlideCount != 2 {
+		t.Fatalf("versions = %+v (identical content must not add a version)", versions)
+	}
+	if _, err := p.Output.Get(ctx, VersionSlideKey("a.dsh", 1, 1)); err != nil {
+		t.Errorf("v1 slide snapshot missing: %v", err)
+	}
+
+	result, restored, err := p.Rollback(ctx, "a.dsh", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored == nil || restored.Number != 3 || restored.RestoredFrom != 1 || result.SlideCount != 1 || result.Version != 3 {
+		t.Fatalf("rollback = %+v, %+v", result, restored)
+	}
+
+	reader, _ := p.Input.Get(ctx, "a.dsh")
+	current, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(current) != string(v1) {
+		t.Errorf("source after rollback = %q", current)
+	}
+	if _, err := p.Output.Get(ctx, "a/slide-0002.svg"); err == nil {
+		t.Error("slide 2 of v2 should be pruned after rollback")
+	}
+
+	if _, _, err := p.Rollback(ctx, "a.dsh", 9); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("rollback to missing version = %v", err)
+	}
+}
+
+func TestProcessor_VersionNumbersUnderConcurrency(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	defer func(n int) { MaxVersions = n }(MaxVersions)
+	MaxVersions = 5
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.recordVersion(ctx, "a.dsh", []byte(fmt.Sprintf("deck %d", i)), "", 0)
+		}()
+	}
+	wg.Wait()
+
+	versions, _ := p.Versions(ctx, "a.dsh")
+	if len(versions) != 5 || versions[0].Number != 4 || versions[4].Number != 8 {
+		t.Fatalf("versions = %+v, want 4..8 after pruning to 5", versions)
+	}
+	seen := map[string]bool{}
+	for _, v := range versions {
+		source, err := p.VersionSource(ctx, "a.dsh", v.Number)
+		if err != nil || contentHash(source) != v.ContentHash || seen[v.ContentHash] {
+			t.Errorf("v%d source = %q, %v (overwritten by another writer?)", v.Number, source, err)
+		}
+		seen[v.ContentHash] = true
+	}
+	if reader, _ := p.Output.Get(ctx, VersionSourceKey("a.dsh", 1)); reader != nil {
+		reader.Close()
+		t.Error("pruned v1 source still stored")
+	}
+
+	if err := p.Handle(ctx, Job{Key: VersionSourceKey("a.dsh", 4)}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := p.KV.Get(ctx, StatusKey(VersionSourceKey("a.dsh", 4))); data != nil {
+		t.Errorf("reserved key was processed: %s", data)
+	}
+}
+
+func TestProcessor_VersionNumbersFromCatalog(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	p.KV = struct{ runtime.KVStore }{runtime.NewMemoryKV()} // No compare-and-swap, like Cloudflare KV
+	cat, err := catalog.OpenSQLite(ctx, filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cat.Close()
+	p.Catalog = cat
+
+	// A second writer that read the index before the first one stored it
+	cat.RecordSource(ctx, catalog.Source{Key: "a.dsh"})
+	p.recordVersion(ctx, "a.dsh", []byte("deck 1"), "", 0)
+	p.KV.Delete(ctx, versionsPrefix+"a.dsh")
+	v := p.recordVersion(ctx, "a.dsh", []byte("deck 2"), "", 0)
+	if v == nil || v.Number != 2 {
+		t.Fatalf("second version = %+v, want number 2 from the catalog", v)
+	}
+	reader, _ := p.Output.Get(ctx, VersionSourceKey("a.dsh", 1))
+	first, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(first) != "deck 1" {
+		t.Errorf("v1 source = %q, overwritten", first)
+	}
+}
+
+func TestProcessor_DeckIndex(t *testing.T) {
+	t.Run("kv", func(t *testing.T) {
+		testDeckIndex(t, newTestProcessor(t))
+	})
+	t.Run("catalog", func(t *testing.T) {
+		p := newTestProcessor(t)
+		p.Catalog = openTestCatalog(t)
+		testDeckIndex(t, p)
+	})
+}
+
+func testDeckIndex(t *testing.T, p *Processor) {
+	ctx := context.Background()
+	sources := map[string]string{
+		"intro.dsh":          "deck\nslide\neslide\nedeck\n",
+		"team/q3/report.dsh": "deck\nslide\nslide\nslide\nedeck\n",
+		"team/broken.dsh":    "deck\nfail\nedeck\n",
+		"lib/shapes.dsh":     "def box x y\nedef\n",
+	}
+	for key, source := range sources {
+		p.Input.Put(ctx, key, []byte(source), "text/plain")
+		p.Process(ctx, key)
+	}
+
+	// Rendered before the index existed; the first listing queues the backfill
+	p.removeDeck(ctx, "team/q3/report.dsh")
+	queue := &recordingQueue{}
+	p.Queue = queue
+
+	page, err := p.Decks(ctx, DeckQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Indexing || page.Total != 2 {
+		t.Errorf("listing before the backfill = %+v", page)
+	}
+	p.Decks(ctx, DeckQuery{})
+	if len(queue.jobs) != 1 || queue.jobs[0].Action != ActionReindex {
+		t.Fatalf("queued %+v, want one reindex", queue.jobs)
+	}
+	if err := p.Handle(ctx, queue.jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = p.Decks(ctx, DeckQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Indexing || page.Total != 3 {
+		t.Fatalf("indexed %d decks, want 3 (libraries excluded): %+v", page.Total, page.Decks)
+	}
+
+	report := p.DeckEntry(ctx, "team/q3/report.dsh")
+	if report == nil || report.SlideCount != 3 || report.Status != StatusComplete || report.BaseName != "team/q3/report" ||
+		report.Thumbnail != SlideKey("team/q3/report", 1) || report.ETag == "" || report.ProcessedAt == "" {
+		t.Errorf("nested deck entry = %+v", report)
+	}
+
+	page, _ = p.Decks(ctx, DeckQuery{Status: []string{StatusError}})
+	if len(page.Decks) != 1 || page.Decks[0].Key != "team/broken.dsh" || page.Decks[0].Error == "" {
+		t.Errorf("status filter = %+v", page.Decks)
+	}
+
+	page, _ = p.Decks(ctx, DeckQuery{Prefix: "team/", Sort: SortSlideCount, Desc: true, Limit: 1})
+	if len(page.Decks) != 1 || page.Decks[0].Key != "team/q3/report.dsh" || page.Total != 2 || page.Next != 1 {
+		t.Errorf("first page = %+v", page)
+	}
+	page, _ = p.Decks(ctx, DeckQuery{Prefix: "team/", Sort: SortSlideCount, Desc: true, Limit: 1, Offset: 1})
+	if len(page.Decks) != 1 || page.Decks[0].Key != "team/broken.dsh" || page.Next != 0 {
+		t.Errorf("last page = %+v", page)
+	}
+
+	if err := p.Delete(ctx, "intro.dsh"); err != nil {
+		t.Fatal(err)
+	}
+	if p.DeckEntry(ctx, "intro.dsh") != nil {
+		t.Error("deleted deck still indexed")
+	}
+
+	// Reindexing recovers rendered decks from their manifests
+	p.removeDeck(ctx, "team/q3/report.dsh")
+	if n, err := p.ReindexDecks(ctx); err != nil || n != 1 {
+		t.Fatalf("ReindexDecks = %d, %v", n, err)
+	}
+	if e := p.DeckEntry(ctx, "team/q3/report.dsh"); e == nil || e.SlideCount != 3 || e.Status != StatusComplete {
+		t.Errorf("reindexed entry = %+v", e)
+	}
+}
+
+func TestProcessor_Thumbnails(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+
+	p.Input.Put(ctx, "talks/intro.dsh", []byte("deck\nslide \"white\" \"black\"\nctext \"Hi\" 50 50 5\neslide\nslide\neslide\nedeck\n"), "text/plain")
+	result, err := p.Process(ctx, "talks/intro.dsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Thumbnail != ThumbnailKey("talks/intro", thumbnail.PNG) {
+		t.Errorf("result thumbnail = %q", result.Thumbnail)
+	}
+	if e := p.DeckEntry(ctx, "talks/intro.dsh"); e == nil || e.Thumbnail != result.Thumbnail {
+		t.Errorf("deck entry = %+v", e)
+	}
+	for _, format := range thumbnail.Formats {
+		if _, err := p.Output.Get(ctx, ThumbnailKey("talks/intro", format)); err != nil {
+			t.Errorf("no stored %s thumbnail: %v", format, err)
+		}
+	}
+
+	// Other widths are rendered from the source
+	data, err := p.Thumbnail(ctx, "talks/intro.dsh", 120, thumbnail.PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil || img.Bounds().Dx() != 120 {
+		t.Errorf("on-demand thumbnail: %v, %v", img.Bounds(), err)
+	}
+
+	// Width 0 only serves what was stored
+	if _, err := p.Thumbnail(ctx, "talks/intro.dsh", 0, thumbnail.WebP); err != nil {
+		t.Errorf("stored thumbnail: %v", err)
+	}
+	p.Input.Put(ctx, "lib.dsh", []byte("def box x y\nedef\n"), "text/plain")
+	if _, err := p.Thumbnail(ctx, "lib.dsh", 0, thumbnail.PNG); !errors.Is(err, ErrNoThumbnail) {
+		t.Errorf("unstored thumbnail error = %v", err)
+	}
+	if _, err := p.Thumbnail(ctx, "lib.dsh", 120, thumbnail.PNG); !errors.Is(err, ErrNotRenderable) {
+		t.Errorf("library thumbnail error = %v", err)
+	}
+
+	if err := p.Delete(ctx, "talks/intro.dsh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Output.Get(ctx, ThumbnailKey("talks/intro", thumbnail.WebP)); err == nil {
+		t.Error("thumbnail survived delete")
+	}
+}
+
+func TestProcessor_StoredThumbnailsUseThumbnailFonts(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+
+	var loaded []string
+	ThumbnailFonts = func(name string) []byte {
+		loaded = append(loaded, name)
+		return nil
+	}
+	defer func() { ThumbnailFonts = nil }()
+
+	p.Input.Put(ctx, "talks/intro.dsh", []byte("deck\nslide\nctext \"Hi\" 50 50 5 \"serif\"\neslide\nedeck\n"), "text/plain")
+	result, err := p.Process(ctx, "talks/intro.dsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Thumbnail == "" || !slices.Contains(loaded, "serif") {
+		t.Errorf("thumbnail %q loaded fonts %v, want serif", result.Thumbnail, loaded)
+	}
+}
@@ -0,0 +1,175 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Job actions
+const (
+	ActionRender  = "render"
+	ActionDelete  = "delete"
+	ActionReindex = "reindex" // One-time deck index backfill; has no key
+)
+
+// ErrQueueClosed is returned when enqueueing onto a closed queue
+var ErrQueueClosed = errors.New("queue closed")
+
+// Job is a unit of background work for a source key
+type Job struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	ETag   string `json:"etag,omitempty"`  // Source version; duplicates of a rendered version are skipped
+	Force  bool   `json:"force,omitempty"` // Re-render an unchanged source because a dependency changed
+}
+
+// Queue accepts jobs for background processing
+// Cloudflare Queues deliver jobs to the Worker directly; the native server
+// uses MemoryQueue fed by HTTP uploads and the filesystem Watcher.
+type Queue interface {
+	Enqueue(ctx context.Context, job Job) error
+}
+
+// JobHandler processes a single job
+type JobHandler func(ctx context.Context, job Job) error
+
+// Handle runs a job through the processor
+func (p *Processor) Handle(ctx context.Context, job Job) error {
+	switch job.Action {
+	case ActionRender, "":
+		if !strings.HasSuffix(job.Key, ".dsh") || IsReserved(job.Key) {
+			return nil
+		}
+		return p.processJob(ctx, job)
+	case ActionDelete:
+		if !strings.HasSuffix(job.Key, ".dsh") || IsReserved(job.Key) {
+			return nil
+		}
+		return p.Delete(ctx, job.Key)
+	case ActionReindex:
+		return p.backfillDecks(ctx)
+	default:
+		return fmt.Errorf("unknown job action %q", job.Action)
+	}
+}
+
+// MemoryQueue is an in-process Queue served by a pool of worker goroutines
+// Identical jobs that are still waiting are coalesced, so a burst of file
+// writes to one deck only renders it once.
+type MemoryQueue struct {
+	handle JobHandler
+	jobs   chan Job
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[Job]bool
+	closed  bool
+}
+
+// NewMemoryQueue creates a queue holding up to size waiting jobs
+func NewMemoryQueue(handle JobHandler, size int) *MemoryQueue {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryQueue{
+		handle:  handle,
+		jobs:    make(chan Job, size),
+		done:    make(chan struct{}),
+		pending: make(map[Job]bool),
+	}
+}
+
+// Start launches workers that process jobs until Close is called
+func (q *MemoryQueue) Start(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+func (q *MemoryQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.done:
+			return
+		case job := <-q.jobs:
+			q.mu.Lock()
+			delete(q.pending, job)
+			q.mu.Unlock()
+
+			if err := q.handle(context.WithValue(ctx, queueWorkerKey{}, q), job); err != nil {
+				log.Printf("processor: %s %s failed: %v", job.Action, job.Key, err)
+			}
+		}
+	}
+}
+
+// queueWorkerKey marks the context of a job running on a MemoryQueue worker
+type queueWorkerKey struct{}
+
+// Enqueue adds a job, blocking while the queue is full
+// Jobs enqueued by the queue's own workers, such as a library's dependents,
+// never block: when the queue is full they wait in a goroutine instead, since
+// a worker blocked on its own queue would never drain it.
+func (q *MemoryQueue) Enqueue(ctx context.Context, job Job) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrQueueClosed
+	}
+	if q.pending[job] {
+		q.mu.Unlock()
+		return nil
+	}
+	q.pending[job] = true
+	q.mu.Unlock()
+
+	if ctx.Value(queueWorkerKey{}) == q {
+		select {
+		case q.jobs <- job:
+		default:
+			go func() {
+				select {
+				case q.jobs <- job:
+				case <-q.done:
+				}
+			}()
+		}
+		return nil
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	case <-q.done:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		q.mu.Lock()
+		delete(q.pending, job)
+		q.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Close stops the workers after their current job; waiting jobs are dropped
+func (q *MemoryQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.done)
+	q.wg.Wait()
+}
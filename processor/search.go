@@ -0,0 +1,382 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// KV layout of the search documents and tags
+// A render writes one document holding every term of the deck and mirrors it
+// into the catalog's search tables, the index searches query. The KV copies let
+// a catalog added later be backfilled.
+//
+//	searchdoc:<key>      -> SearchDoc    (terms and per-field terms, for ranking)
+//	tags:<key>           -> ["geo","2024"]
+const (
+	searchDocPrefix = "searchdoc:"
+	tagsPrefix      = "tags:"
+)
+
+// searchBackfillKey marks that documents written before the catalog mirror were copied into it
+const searchBackfillKey = "searchindex:catalog"
+
+// ErrNoCatalog is returned by Search and AllTags on servers without a catalog
+// Scanning KV instead would cost a read per deck on every query.
+var ErrNoCatalog = fmt.Errorf("search needs the catalog, which is %w on this server", runtime.ErrNotConfigured)
+
+// MaxIndexTerms caps the distinct terms indexed per deck
+const MaxIndexTerms = 512
+
+// MaxTags caps the tags on one deck
+const MaxTags = 32
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,39}$`)
+
+// Terms too common to be worth an index entry
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "with": true, "dsh": true,
+}
+
+// SearchDoc is the indexed view of one deck
+type SearchDoc struct {
+	Key        string     `json:"key"`
+	Title      string     `json:"title,omitempty"`
+	SlideCount int        `json:"slideCount"`
+	Tags       []string   `json:"tags,omitempty"`
+	TitleTerms []string   `json:"titleTerms,omitempty"`
+	PathTerms  []string   `json:"pathTerms,omitempty"`
+	SlideTerms [][]string `json:"slideTerms,omitempty"`
+	Terms      []string   `json:"terms"` // Every indexed term, including tags
+}
+
+// SearchHit is one deck matching a search
+type SearchHit struct {
+	Key        string   `json:"key"`
+	Title      string   `json:"title,omitempty"`
+	SlideCount int      `json:"slideCount"`
+	Tags       []string `json:"tags,omitempty"`
+	Score      int      `json:"score"`
+	Slides     []int    `json:"slides,omitempty"` // 1-based slides whose text matched
+}
+
+// TagCount is a tag and the number of decks carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Tokenize splits text into lowercase index terms, dropping stop words and single characters
+func Tokenize(text string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, f := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(f)) < 2 || len(f) > 40 || stopWords[f] || seen[f] {
+			continue
+		}
+		seen[f] = true
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// NormalizeTags lowercases, trims and dedupes tags, rejecting invalid ones
+func NormalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || slices.Contains(out, t) {
+			continue
+		}
+		if !tagPattern.MatchString(t) {
+			return nil, fmt.Errorf("invalid tag %q: use letters, digits, '-' and '_' (max 40)", t)
+		}
+		out = append(out, t)
+	}
+	if len(out) > MaxTags {
+		return nil, fmt.Errorf("too many tags: %d (max %d)", len(out), MaxTags)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// slideText collects the visible text of a slide
+func slideText(s deck.Slide) string {
+	var b strings.Builder
+	for _, t := range s.Text {
+		b.WriteString(t.Tdata)
+		b.WriteByte('\n')
+	}
+	for _, l := range s.List {
+		for _, li := range l.Li {
+			b.WriteString(li.ListText)
+			b.WriteByte('\n')
+		}
+	}
+	for _, img := range s.Image {
+		b.WriteString(img.Caption)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Tags returns the tags of a source key
+func (p *Processor) Tags(ctx context.Context, key string) []string {
+	data, err := p.kv().Get(ctx, tagsPrefix+key)
+	tags := make([]string, 0)
+	if err != nil || data == nil {
+		return tags
+	}
+	json.Unmarshal(data, &tags)
+	return tags
+}
+
+// SetTags replaces the tags of a source key and updates the search index
+func (p *Processor) SetTags(ctx context.Context, key string, tags []string) ([]string, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	kv := p.kv()
+
+	if len(tags) == 0 {
+		kv.Delete(ctx, tagsPrefix+key)
+	} else {
+		data, _ := json.Marshal(tags)
+		if err := kv.Put(ctx, tagsPrefix+key, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if cat := p.catalog(); cat != nil {
+		if err := cat.SetTags(ctx, key, tags); err != nil {
+			log.Printf("catalog: set tags %s: %v", key, err)
+		}
+	}
+
+	// Re-index with the new tags; the rest of the document is unchanged
+	doc := p.searchDoc(ctx, key)
+	if doc == nil {
+		doc = &SearchDoc{Key: key, PathTerms: Tokenize(key)}
+	}
+	doc.Tags = tags
+	p.writeSearchDoc(ctx, doc)
+	return tags, nil
+}
+
+// AllTags lists every tag in use with its deck count, from the catalog
+func (p *Processor) AllTags(ctx context.Context) ([]TagCount, error) {
+	cat := p.catalog()
+	if cat == nil {
+		return nil, ErrNoCatalog
+	}
+	p.backfillSearch(ctx)
+	counts, err := cat.Tags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]TagCount, len(counts))
+	for i, tc := range counts {
+		tags[i] = TagCount{Tag: tc.Tag, Count: tc.Count}
+	}
+	return tags, nil
+}
+
+// indexDeck refreshes the search document of a rendered deck
+// source must have its imports expanded. Parse failures (e.g. data files only the
+// native renderer can reach) still index the title and path.
+func (p *Processor) indexDeck(ctx context.Context, key string, d *deck.Deck, title string, slideCount int) {
+	doc := &SearchDoc{
+		Key:        key,
+		Title:      title,
+		SlideCount: slideCount,
+		Tags:       p.Tags(ctx, key),
+		TitleTerms: Tokenize(title),
+		PathTerms:  Tokenize(key),
+	}
+
+	if d != nil {
+		doc.SlideTerms = make([][]string, len(d.Slide))
+		for i, s := range d.Slide {
+			doc.SlideTerms[i] = Tokenize(slideText(s))
+		}
+	}
+
+	p.writeSearchDoc(ctx, doc)
+}
+
+// unindexDeck removes a deck and its tags from the search index
+// The catalog drops deleted sources from its search on its own.
+func (p *Processor) unindexDeck(ctx context.Context, key string) {
+	kv := p.kv()
+	kv.Delete(ctx, searchDocPrefix+key)
+	kv.Delete(ctx, tagsPrefix+key)
+}
+
+func (p *Processor) searchDoc(ctx context.Context, key string) *SearchDoc {
+	data, err := p.kv().Get(ctx, searchDocPrefix+key)
+	if err != nil || data == nil {
+		return nil
+	}
+	var doc SearchDoc
+	if json.Unmarshal(data, &doc) != nil {
+		return nil
+	}
+	return &doc
+}
+
+// writeSearchDoc stores doc, collecting its terms, and mirrors it into the catalog
+func (p *Processor) writeSearchDoc(ctx context.Context, doc *SearchDoc) {
+	terms := make([]string, 0)
+	add := func(ts []string) {
+		for _, t := range ts {
+			if len(terms) < MaxIndexTerms && !slices.Contains(terms, t) {
+				terms = append(terms, t)
+			}
+		}
+	}
+	add(doc.Tags)
+	add(doc.TitleTerms)
+	add(doc.PathTerms)
+	for _, st := range doc.SlideTerms {
+		add(st)
+	}
+	doc.Terms = terms
+
+	data, _ := json.Marshal(doc)
+	p.kv().Put(ctx, searchDocPrefix+doc.Key, data)
+	if cat := p.catalog(); cat != nil {
+		if err := cat.IndexSearch(ctx, doc.Key, terms, data); err != nil {
+			log.Printf("catalog: index %s: %v", doc.Key, err)
+		}
+	}
+}
+
+// Search finds decks matching every query term (by prefix) and, if set, the tag
+// Hits are ranked by where the terms matched: tags and title weigh more than path,
+// path more than slide text.
+func (p *Processor) Search(ctx context.Context, query, tag string, limit int) ([]SearchHit, error) {
+	terms := Tokenize(query)
+	hits := make([]SearchHit, 0)
+	if len(terms) == 0 && tag == "" {
+		return hits, nil
+	}
+
+	docs, err := p.searchDocs(ctx, terms, tag)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		hits = append(hits, scoreHit(doc, terms))
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Key < hits[j].Key
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// searchDocs returns the documents matching every term by prefix and the tag
+func (p *Processor) searchDocs(ctx context.Context, terms []string, tag string) ([]*SearchDoc, error) {
+	cat := p.catalog()
+	if cat == nil {
+		return nil, ErrNoCatalog
+	}
+	p.backfillSearch(ctx)
+	rows, err := cat.Search(ctx, terms, tag)
+	if err != nil {
+		return nil, err
+	}
+	var docs []*SearchDoc
+	for _, row := range rows {
+		var doc SearchDoc
+		if json.Unmarshal(row, &doc) == nil {
+			docs = append(docs, &doc)
+		}
+	}
+	return docs, nil
+}
+
+// backfillSearch copies documents and tags written before the catalog mirror
+// into the catalog, once
+// Decks the catalog has never recorded are picked up by their next render.
+func (p *Processor) backfillSearch(ctx context.Context) {
+	kv := p.kv()
+	if done, err := kv.Get(ctx, searchBackfillKey); err != nil || done != nil {
+		return
+	}
+	keys, err := runtime.ListAllKV(ctx, kv, searchDocPrefix)
+	if err != nil {
+		return
+	}
+	cat := p.catalog()
+	for _, k := range keys {
+		if doc := p.searchDoc(ctx, strings.TrimPrefix(k, searchDocPrefix)); doc != nil {
+			data, _ := json.Marshal(doc)
+			if err := cat.IndexSearch(ctx, doc.Key, doc.Terms, data); err != nil {
+				log.Printf("catalog: backfill search %s: %v", doc.Key, err)
+				return
+			}
+			if err := cat.SetTags(ctx, doc.Key, doc.Tags); err != nil {
+				log.Printf("catalog: backfill tags %s: %v", doc.Key, err)
+				return
+			}
+		}
+	}
+	kv.Put(ctx, searchBackfillKey, []byte("1"))
+}
+
+// hasPrefixTerm reports whether any of ts starts with term
+func hasPrefixTerm(ts []string, term string) bool {
+	for _, t := range ts {
+		if strings.HasPrefix(t, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func scoreHit(doc *SearchDoc, terms []string) SearchHit {
+	hit := SearchHit{Key: doc.Key, Title: doc.Title, SlideCount: doc.SlideCount, Tags: doc.Tags}
+
+	for _, term := range terms {
+		if hasPrefixTerm(doc.Tags, term) {
+			hit.Score += 3
+		}
+		if hasPrefixTerm(doc.TitleTerms, term) {
+			hit.Score += 3
+		}
+		if hasPrefixTerm(doc.PathTerms, term) {
+			hit.Score += 2
+		}
+		for i, st := range doc.SlideTerms {
+			if hasPrefixTerm(st, term) {
+				hit.Score++
+				if !slices.Contains(hit.Slides, i+1) {
+					hit.Slides = append(hit.Slides, i+1)
+				}
+			}
+		}
+	}
+	sort.Ints(hit.Slides)
+	return hit
+}
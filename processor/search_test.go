@@ -0,0 +1,143 @@
+//go:build !cloudflare
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("The Election-Map of 2024: élection, map! maps/a.dsh")
+	want := []string{"election", "map", "2024", "élection", "maps"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Tokenize = %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := NormalizeTags([]string{" Geo ", "geo", "client-a", ""})
+	if err != nil || !slices.Equal(got, []string{"client-a", "geo"}) {
+		t.Errorf("NormalizeTags = %v, %v", got, err)
+	}
+	if _, err := NormalizeTags([]string{"no spaces"}); err == nil {
+		t.Error("expected error for tag with a space")
+	}
+}
+
+func TestProcessor_SearchNeedsCatalog(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	if _, err := p.Search(ctx, "elect", "", 0); !errors.Is(err, ErrNoCatalog) || !errors.Is(err, runtime.ErrNotConfigured) {
+		t.Errorf("Search without a catalog: %v", err)
+	}
+	if _, err := p.AllTags(ctx); !errors.Is(err, ErrNoCatalog) {
+		t.Errorf("AllTags without a catalog: %v", err)
+	}
+}
+
+func TestProcessor_SearchAndTags(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	p.Catalog = openTestCatalog(t)
+	decks := map[string]string{
+		"maps/us.dsh":     "deck\nslide\nctext \"Election map\" 50 50 5\neslide\nslide\ntext \"Turnout by county\" 10 10 3\neslide\nedeck\n",
+		"talks/intro.dsh": "deck\nslide\nctext \"Welcome\" 50 50 5\neslide\nedeck\n",
+	}
+	for key, source := range decks {
+		p.Input.Put(ctx, key, []byte(source), "text/plain")
+		if _, err := p.Process(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, err := p.Search(ctx, "elect", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Key != "maps/us.dsh" || !slices.Equal(hits[0].Slides, []int{1}) {
+		t.Fatalf("hits = %+v", hits)
+	}
+
+	// Every term must match
+	if hits, _ := p.Search(ctx, "election welcome", "", 0); len(hits) != 0 {
+		t.Errorf("AND search hits = %+v", hits)
+	}
+	if hits, _ := p.Search(ctx, "county", "", 0); len(hits) != 1 || !slices.Equal(hits[0].Slides, []int{2}) {
+		t.Errorf("slide 2 search hits = %+v", hits)
+	}
+	if hits, _ := p.Search(ctx, "talks", "", 0); len(hits) != 1 || hits[0].Key != "talks/intro.dsh" {
+		t.Errorf("path search hits = %+v", hits)
+	}
+
+	// Tags are searchable, filterable, and survive re-renders
+	if _, err := p.SetTags(ctx, "talks/intro.dsh", []string{"Onboarding", "geo"}); err != nil {
+		t.Fatal(err)
+	}
+	p.SetTags(ctx, "maps/us.dsh", []string{"geo"})
+	p.Handle(ctx, Job{Key: "talks/intro.dsh", Action: ActionRender, Force: true})
+
+	if hits, _ := p.Search(ctx, "onboarding", "", 0); len(hits) != 1 || hits[0].Key != "talks/intro.dsh" {
+		t.Errorf("tag term hits = %+v", hits)
+	}
+	if hits, _ := p.Search(ctx, "", "geo", 0); len(hits) != 2 {
+		t.Errorf("tag filter hits = %+v", hits)
+	}
+	if tags, _ := p.AllTags(ctx); !slices.Equal(tags, []TagCount{{"geo", 2}, {"onboarding", 1}}) {
+		t.Errorf("AllTags = %+v", tags)
+	}
+
+	// Edited text drops stale terms; deletes drop everything
+	p.Input.Put(ctx, "maps/us.dsh", []byte("deck\nslide\nctext \"Rainfall\" 50 50 5\neslide\nedeck\n"), "text/plain")
+	p.Process(ctx, "maps/us.dsh")
+	if hits, _ := p.Search(ctx, "election", "", 0); len(hits) != 0 {
+		t.Errorf("stale term hits = %+v", hits)
+	}
+
+	if err := p.Delete(ctx, "talks/intro.dsh"); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := p.Search(ctx, "welcome", "", 0); len(hits) != 0 {
+		t.Errorf("deleted deck hits = %+v", hits)
+	}
+	if tags, _ := p.AllTags(ctx); !slices.Equal(tags, []TagCount{{"geo", 1}}) {
+		t.Errorf("AllTags after delete = %+v", tags)
+	}
+}
+
+func TestProcessor_SearchBackfillsCatalog(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProcessor(t)
+	p.Input.Put(ctx, "talks/intro.dsh", []byte("deck\nslide\nctext \"Welcome\" 50 50 5\neslide\nedeck\n"), "text/plain")
+	if _, err := p.Process(ctx, "talks/intro.dsh"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rendered before the catalog held a search index
+	cat := openTestCatalog(t)
+	cat.RecordSource(ctx, catalog.Source{Key: "talks/intro.dsh"})
+	p.Catalog = cat
+
+	if hits, _ := p.Search(ctx, "welcome", "", 0); len(hits) != 1 {
+		t.Fatalf("hits after backfill = %+v", hits)
+	}
+	if done, _ := p.KV.Get(ctx, searchBackfillKey); done == nil {
+		t.Error("backfill not marked done")
+	}
+}
+
+func openTestCatalog(t *testing.T) *catalog.SQLCatalog {
+	t.Helper()
+	cat, err := catalog.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cat.Close() })
+	return cat
+}
@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+	"log"
+
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+	"github.com/joeblew999/deckfs/pkg/thumbnail"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// ThumbnailWidth is the pixel width of the thumbnails stored with every render
+// Set it at startup; 0 disables stored thumbnails (on-demand ones still work).
+var ThumbnailWidth = thumbnail.DefaultWidth
+
+// ThumbnailFonts loads the fonts thumbnails are drawn with
+// Set it at startup; when nil, or for fonts it can't load, the built-in Go fonts are used.
+var ThumbnailFonts thumbnail.FontLoader
+
+// ErrNotRenderable is returned for sources that aren't decks, such as libraries
+var ErrNotRenderable = errors.New("not a renderable deck")
+
+// ErrNoThumbnail is returned when a deck has no stored thumbnail
+var ErrNoThumbnail = errors.New("no stored thumbnail")
+
+// ThumbnailKey returns the output key of a deck's stored thumbnail
+func ThumbnailKey(baseName string, format thumbnail.Format) string {
+	return baseName + "/thumb." + string(format)
+}
+
+// storeThumbnails stores a preview of the first slide in every thumbnail format
+// Failures are logged rather than failing the render, and stale previews are
+// removed when the deck no longer has a first slide. Builds without the
+// rasterizer leave stored previews alone, since they can't replace them.
+func (p *Processor) storeThumbnails(ctx context.Context, key string, d *deck.Deck) []catalog.Output {
+	if !thumbnail.Supported {
+		return nil
+	}
+	output := p.output()
+	baseName := BaseName(key)
+
+	var outputs []catalog.Output
+	if ThumbnailWidth > 0 && d != nil && len(d.Slide) > 0 {
+		img, err := renderThumbnail(ctx, d, ThumbnailWidth)
+		if err != nil {
+			log.Printf("processor: thumbnail %s: %v", key, err)
+			return nil
+		}
+		for _, format := range thumbnail.Formats {
+			data, err := thumbnail.Encode(img, format)
+			if err == nil {
+				err = output.Put(ctx, ThumbnailKey(baseName, format), data, format.ContentType())
+			}
+			if err != nil {
+				log.Printf("processor: thumbnail %s (%s): %v", key, format, err)
+				continue
+			}
+			outputs = append(outputs, catalog.Output{
+				Key:       ThumbnailKey(baseName, format),
+				FileType:  catalog.FileThumbnail,
+				SizeBytes: int64(len(data)),
+			})
+		}
+		return outputs
+	}
+
+	p.deleteThumbnails(ctx, baseName)
+	return nil
+}
+
+func (p *Processor) deleteThumbnails(ctx context.Context, baseName string) {
+	for _, format := range thumbnail.Formats {
+		p.output().Delete(ctx, ThumbnailKey(baseName, format))
+	}
+}
+
+// Thumbnail returns a preview of the first slide of the deck at key
+// Width 0 returns the stored thumbnail, or ErrNoThumbnail when there is none.
+// Other widths are rendered from the source (the stored thumbnail is reused at
+// ThumbnailWidth), or fail with thumbnail.ErrUnsupported in builds without the
+// rasterizer.
+func (p *Processor) Thumbnail(ctx context.Context, key string, width int, format thumbnail.Format) ([]byte, error) {
+	if width == 0 || width == ThumbnailWidth {
+		if reader, err := p.output().Get(ctx, ThumbnailKey(BaseName(key), format)); err == nil {
+			defer reader.Close()
+			return io.ReadAll(reader)
+		}
+		if width == 0 {
+			return nil, ErrNoThumbnail
+		}
+	}
+	if !thumbnail.Supported {
+		return nil, thumbnail.ErrUnsupported
+	}
+
+	source, err := p.readSource(ctx, key)
+	if err != nil {
+		return nil, &Error{Stage: StageRead, Err: err}
+	}
+	if !pipeline.IsRenderable(source) {
+		return nil, ErrNotRenderable
+	}
+	if pipeline.HasImports(source) {
+		resolver := pipeline.NewImportResolver(pipeline.StorageLoader(p.input()), "")
+		if source, err = resolver.Expand(ctx, source, key); err != nil {
+			return nil, &Error{Stage: StageImports, Err: err}
+		}
+	}
+	d, err := runtime.Parse(ctx, source)
+	if err != nil {
+		return nil, &Error{Stage: StageRender, Err: err}
+	}
+	img, err := renderThumbnail(ctx, d, width)
+	if err != nil {
+		return nil, &Error{Stage: StageRender, Err: err}
+	}
+	return thumbnail.Encode(img, format)
+}
+
+func thumbnailRenderer() *thumbnail.Renderer {
+	return &thumbnail.Renderer{Fonts: ThumbnailFonts}
+}
+
+// renderThumbnail rasterizes the first slide of d in a render slot, so
+// thumbnails count against the same limits as renders
+func renderThumbnail(ctx context.Context, d *deck.Deck, width int) (img image.Image, err error) {
+	err = runtime.Bounded(ctx, func(context.Context) error {
+		img, err = thumbnailRenderer().Render(d, 0, width)
+		return err
+	})
+	return img, err
+}
+
+// storedThumbnail returns the output key of a deck's PNG preview, or its first slide without one
+func (p *Processor) storedThumbnail(ctx context.Context, baseName string) string {
+	if reader, err := p.output().Get(ctx, ThumbnailKey(baseName, thumbnail.PNG)); err == nil {
+		reader.Close()
+		return ThumbnailKey(baseName, thumbnail.PNG)
+	}
+	return SlideKey(baseName, 1)
+}
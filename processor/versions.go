@@ -0,0 +1,299 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/deckfs/catalog"
+	"github.com/joeblew999/deckfs/runtime"
+)
+
+// ReservedDir is the output storage prefix deckfs keeps for its own files
+// Source keys under it are refused, so no deck can render over them.
+const ReservedDir = "_deckfs/"
+
+// VersionsDir is the output storage prefix holding retained source versions
+// and the slides each version first rendered to:
+//
+//	_deckfs/versions/<key>/v0003.dsh
+//	_deckfs/versions/<key>/v0003/slide-0001.svg
+const VersionsDir = ReservedDir + "versions/"
+
+// KV prefix of the per-source version index (JSON list, oldest first)
+const versionsPrefix = "versions:"
+
+// MaxVersions caps the versions retained per source; older ones are pruned
+var MaxVersions = 50
+
+// IsReserved reports whether key lies under ReservedDir
+func IsReserved(key string) bool {
+	return strings.HasPrefix(key, ReservedDir)
+}
+
+// ErrVersionNotFound is returned for a version number that was never retained
+var ErrVersionNotFound = errors.New("version not found")
+
+// Version is a retained revision of a source file
+type Version struct {
+	Number       int       `json:"number"`
+	ContentHash  string    `json:"contentHash"` // SHA-256 hex
+	ETag         string    `json:"etag,omitempty"`
+	Size         int64     `json:"size"`
+	CreatedAt    time.Time `json:"createdAt"`
+	RestoredFrom int       `json:"restoredFrom,omitempty"` // Set when created by a rollback
+	Rendered     bool      `json:"rendered"`               // Slides were snapshotted
+	SlideCount   int       `json:"slideCount"`
+	Title        string    `json:"title,omitempty"`
+}
+
+// VersionSourceKey returns the output storage key of a retained source version
+func VersionSourceKey(key string, number int) string {
+	return fmt.Sprintf("%s%s/v%04d.dsh", VersionsDir, key, number)
+}
+
+// VersionSlideKey returns the output storage key of a slide snapshotted for a version
+func VersionSlideKey(key string, number, slide int) string {
+	return fmt.Sprintf("%s%s/v%04d/slide-%04d.svg", VersionsDir, key, number, slide)
+}
+
+// contentHash is the SHA-256 hex digest used to dedupe versions
+func contentHash(source []byte) string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// Versions returns the retained versions of key, oldest first
+func (p *Processor) Versions(ctx context.Context, key string) ([]Version, error) {
+	data, err := p.kv().Get(ctx, versionsPrefix+key)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]Version, 0)
+	if data == nil {
+		return versions, nil
+	}
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Version returns one retained version of key
+func (p *Processor) Version(ctx context.Context, key string, number int) (*Version, error) {
+	versions, err := p.Versions(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].Number == number {
+			return &versions[i], nil
+		}
+	}
+	return nil, ErrVersionNotFound
+}
+
+// VersionSource returns the source text of a retained version
+func (p *Processor) VersionSource(ctx context.Context, key string, number int) ([]byte, error) {
+	if _, err := p.Version(ctx, key, number); err != nil {
+		return nil, err
+	}
+	reader, err := p.output().Get(ctx, VersionSourceKey(key, number))
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return nil, ErrVersionNotFound
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Rollback re-promotes a retained version to the current source and re-renders it
+// The restored content becomes a new version, so history is never rewritten.
+func (p *Processor) Rollback(ctx context.Context, key string, number int) (*Result, *Version, error) {
+	source, err := p.VersionSource(ctx, key, number)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Record first so the new version is marked as restored; process dedupes it
+	restored := p.recordVersion(ctx, key, source, ContentVersion(source), number)
+	if err := p.input().Put(ctx, key, source, "text/plain"); err != nil {
+		return nil, nil, &Error{Stage: StageStore, Err: fmt.Errorf("restore source: %w", err)}
+	}
+
+	result, err := p.ProcessSource(ctx, key, source)
+	return result, restored, err
+}
+
+// recordVersion retains source as a new version unless it matches the latest one
+// Returns the version the content belongs to, or nil if retention failed.
+//
+// With an AtomicKV the number is taken inside a compare-and-swap of the index.
+// Cloudflare KV has none, so there the catalog hands out numbers; without a
+// catalog concurrent uploads of one source can still share a number.
+func (p *Processor) recordVersion(ctx context.Context, key string, source []byte, etag string, restoredFrom int) *Version {
+	output := p.output()
+	if output == nil {
+		return nil
+	}
+
+	v := Version{
+		ContentHash:  contentHash(source),
+		ETag:         etag,
+		Size:         int64(len(source)),
+		CreatedAt:    time.Now().UTC(),
+		RestoredFrom: restoredFrom,
+	}
+	_, atomic := p.kv().(runtime.AtomicKV)
+	cat := p.catalog()
+
+	var latest *Version
+	var pruned []Version
+	_, err := p.updateVersions(ctx, key, func(versions []Version) ([]Version, error) {
+		latest, pruned = nil, nil
+		last := 0
+		if n := len(versions); n > 0 {
+			if versions[n-1].ContentHash == v.ContentHash {
+				latest = &versions[n-1]
+				return nil, nil
+			}
+			last = versions[n-1].Number
+		}
+
+		v.Number = last + 1
+		if !atomic && cat != nil {
+			n, err := cat.AddVersion(ctx, key, catalog.Version{
+				ContentHash: v.ContentHash,
+				ETag:        v.ETag,
+				SizeBytes:   v.Size,
+			}, last)
+			if err != nil && !errors.Is(err, catalog.ErrUnknownSource) {
+				return nil, fmt.Errorf("allocate number: %w", err)
+			}
+			if err == nil {
+				v.Number = n
+			}
+		}
+
+		versions = append(versions, v)
+		if MaxVersions > 0 && len(versions) > MaxVersions {
+			pruned = slices.Clone(versions[:len(versions)-MaxVersions])
+			versions = versions[len(versions)-MaxVersions:]
+		}
+		return versions, nil
+	})
+	if err != nil {
+		log.Printf("processor: versions %s: %v", key, err)
+		return nil
+	}
+	if latest != nil {
+		return latest
+	}
+
+	// The number is ours now, so the blob can't be overwritten by another writer
+	if err := output.Put(ctx, VersionSourceKey(key, v.Number), source, "text/plain"); err != nil {
+		log.Printf("processor: store version %s v%d: %v", key, v.Number, err)
+		p.updateVersions(ctx, key, func(versions []Version) ([]Version, error) {
+			return slices.DeleteFunc(versions, func(r Version) bool { return r.Number == v.Number }), nil
+		})
+		return nil
+	}
+	p.pruneVersions(ctx, key, pruned)
+	return &v
+}
+
+// pruneVersions deletes the stored source and slide snapshots of dropped versions
+// The catalog keeps their rows as history.
+func (p *Processor) pruneVersions(ctx context.Context, key string, pruned []Version) {
+	output := p.output()
+	for _, v := range pruned {
+		if err := output.Delete(ctx, VersionSourceKey(key, v.Number)); err != nil {
+			log.Printf("processor: prune %s v%d: %v", key, v.Number, err)
+		}
+		for i := 1; i <= v.SlideCount; i++ {
+			output.Delete(ctx, VersionSlideKey(key, v.Number, i))
+		}
+	}
+}
+
+// snapshotVersion copies the slides of the first successful render of a version
+// Later forced re-renders (library changes) leave the snapshot untouched.
+func (p *Processor) snapshotVersion(ctx context.Context, key string, v *Version, result *Result) {
+	if v == nil || v.Rendered || result == nil {
+		return
+	}
+
+	output := p.output()
+	for i, slide := range result.slides {
+		if err := output.Put(ctx, VersionSlideKey(key, v.Number, i+1), slide, "image/svg+xml"); err != nil {
+			log.Printf("processor: snapshot %s v%d: %v", key, v.Number, err)
+			return
+		}
+	}
+
+	_, err := p.updateVersions(ctx, key, func(versions []Version) ([]Version, error) {
+		i := slices.IndexFunc(versions, func(r Version) bool { return r.Number == v.Number })
+		if i < 0 {
+			return nil, nil // Pruned meanwhile
+		}
+		versions[i].Rendered = true
+		versions[i].SlideCount = result.SlideCount
+		versions[i].Title = result.Title
+		*v = versions[i]
+		return versions, nil
+	})
+	if err != nil {
+		log.Printf("processor: versions %s: %v", key, err)
+	}
+}
+
+// catalogVersion mirrors a retained version into the catalog's versions table
+func (p *Processor) catalogVersion(ctx context.Context, key string, v *Version) {
+	cat := p.catalog()
+	if cat == nil || v == nil {
+		return
+	}
+	err := cat.RecordVersion(ctx, key, catalog.Version{
+		Number:      v.Number,
+		ContentHash: v.ContentHash,
+		ETag:        v.ETag,
+		SizeBytes:   v.Size,
+	})
+	if err != nil {
+		log.Printf("catalog: record version %s v%d: %v", key, v.Number, err)
+	}
+}
+
+// updateVersions applies update to the version index of key and stores the result
+// update returns nil to leave the index unchanged; it reruns when a concurrent
+// writer got there first (see updateKV).
+func (p *Processor) updateVersions(ctx context.Context, key string, update func([]Version) ([]Version, error)) ([]Version, error) {
+	var versions []Version
+	err := p.updateKV(ctx, versionsPrefix+key, func(old []byte) ([]byte, error) {
+		versions = nil
+		if old != nil {
+			if err := json.Unmarshal(old, &versions); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if versions, err = update(versions); err != nil || versions == nil {
+			return nil, err
+		}
+		return json.Marshal(versions)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
@@ -0,0 +1,126 @@
+//go:build !cloudflare
+
+package processor
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileState is the change-detection fingerprint of a watched file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watcher polls a directory tree and enqueues jobs for changed or removed .dsh files
+// Polling keeps it dependency-free and works the same on every OS and on
+// network or bind-mounted volumes where inotify events are unreliable.
+type Watcher struct {
+	dir      string
+	queue    Queue
+	interval time.Duration
+	seen     map[string]fileState
+}
+
+// NewWatcher creates a watcher for dir that scans every interval
+func NewWatcher(dir string, queue Queue, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	return &Watcher{
+		dir:      dir,
+		queue:    queue,
+		interval: interval,
+	}
+}
+
+// Run scans until ctx is cancelled
+// The first scan records the existing files without enqueueing them.
+func (w *Watcher) Run(ctx context.Context) error {
+	seen, err := w.scan()
+	if err != nil {
+		return err
+	}
+	w.seen = seen
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.Poll(ctx); err != nil {
+				log.Printf("watcher: %v", err)
+			}
+		}
+	}
+}
+
+// Poll performs one scan and enqueues jobs for files that are new, modified or removed
+func (w *Watcher) Poll(ctx context.Context) error {
+	current, err := w.scan()
+	if err != nil {
+		return err
+	}
+
+	for key, state := range current {
+		if prev, ok := w.seen[key]; ok && prev == state {
+			continue
+		}
+		if err := w.queue.Enqueue(ctx, Job{Key: key, Action: ActionRender}); err != nil {
+			return err
+		}
+	}
+	for key := range w.seen {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if err := w.queue.Enqueue(ctx, Job{Key: key, Action: ActionDelete}); err != nil {
+			return err
+		}
+	}
+
+	w.seen = current
+	return nil
+}
+
+// scan returns the fingerprint of every .dsh file under dir, keyed by storage key
+func (w *Watcher) scan() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if path != w.dir && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".dsh") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed between listing and stat
+		}
+
+		rel, err := filepath.Rel(w.dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// EventSchemaVersion is bumped whenever Event changes incompatibly
+// Consumers should ignore events with a version they don't understand
+const EventSchemaVersion = 1
+
+// Deck lifecycle event types
+const (
+	EventDeckUploaded   = "deck.uploaded"
+	EventDeckProcessing = "deck.processing"
+	EventDeckRendered   = "deck.rendered"
+	EventDeckFailed     = "deck.failed"
+	EventDeckDeleted    = "deck.deleted"
+)
+
+// EventSubjectPrefix is prepended to event types to form publish subjects
+const EventSubjectPrefix = "deckfs."
+
+// Event is the payload published for deck lifecycle changes
+type Event struct {
+	Version    int    `json:"version"`
+	Type       string `json:"type"`
+	Key        string `json:"key"`
+	SlideCount int    `json:"slideCount,omitempty"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Time       string `json:"time"`
+}
+
+// EventSubject returns the publish subject for an event type
+// e.g. "deck.rendered" -> "deckfs.deck.rendered"
+func EventSubject(eventType string) string {
+	return EventSubjectPrefix + eventType
+}
+
+// PublishEvent stamps and publishes a deck event on the configured publisher
+// Publishing is best effort; callers typically log and ignore the error
+func PublishEvent(ctx context.Context, e Event) error {
+	e.Version = EventSchemaVersion
+	if e.Time == "" {
+		e.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return Events().Publish(ctx, EventSubject(e.Type), data)
+}
+
+// Events returns the event publisher
+func Events() Publisher {
+	if Current == nil || Current.Publisher == nil {
+		return &noopPublisher{}
+	}
+	return Current.Publisher
+}
+
+// noopPublisher discards events when no publisher is configured
+type noopPublisher struct{}
+
+func (p *noopPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	return nil
+}
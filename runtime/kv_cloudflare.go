@@ -4,10 +4,14 @@ package runtime
 
 import (
 	"context"
+	"time"
 
 	"github.com/syumai/workers/cloudflare/kv"
 )
 
+// cloudflareMinTTL is the shortest expiration Cloudflare KV accepts
+const cloudflareMinTTL = 60 * time.Second
+
 // CloudflareKV implements KVStore using Cloudflare KV
 type CloudflareKV struct {
 	namespace *kv.Namespace
@@ -27,6 +31,10 @@ func (k *CloudflareKV) Get(ctx context.Context, key string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Missing keys resolve to JS null, which stringifies as "<null>"
+	if val == "<null>" {
+		return nil, nil
+	}
 	return []byte(val), nil
 }
 
@@ -34,6 +42,41 @@ func (k *CloudflareKV) Put(ctx context.Context, key string, value []byte) error
 	return k.namespace.PutString(key, string(value), nil)
 }
 
+// PutWithTTL stores a value with an expiration
+// TTLs below Cloudflare's 60 second minimum are rounded up
+func (k *CloudflareKV) PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return k.Put(ctx, key, value)
+	}
+	if ttl < cloudflareMinTTL {
+		ttl = cloudflareMinTTL
+	}
+	return k.namespace.PutString(key, string(value), &kv.PutOptions{
+		ExpirationTTL: int(ttl.Seconds()),
+	})
+}
+
+func (k *CloudflareKV) List(ctx context.Context, prefix string, cursor string) (*KVListResult, error) {
+	res, err := k.namespace.List(&kv.ListOptions{
+		Prefix: prefix,
+		Cursor: cursor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &KVListResult{
+		Keys: make([]string, len(res.Keys)),
+	}
+	for i, key := range res.Keys {
+		result.Keys[i] = key.Name
+	}
+	if !res.ListComplete {
+		result.Cursor = res.Cursor
+	}
+	return result, nil
+}
+
 func (k *CloudflareKV) Delete(ctx context.Context, key string) error {
 	return k.namespace.Delete(key)
 }
@@ -0,0 +1,277 @@
+//go:build !cloudflare
+
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// compactMinRecords is the log size below which compaction is never attempted
+const compactMinRecords = 1024
+
+// FileKV implements KVStore using an append-only JSON-lines log on local disk
+// Used by wazero server so processing status and caches survive restarts.
+// All entries are held in memory; the log is replayed on open and compacted
+// once it holds more than twice as many records as live keys.
+type FileKV struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	entries kvTable
+	records int // Number of records currently in the log file
+}
+
+// kvRecord is a single line in the log file
+type kvRecord struct {
+	Op        string `json:"op"` // "put" or "del"
+	Key       string `json:"key"`
+	Value     []byte `json:"value,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"` // Unix seconds, 0 means no expiry
+}
+
+// NewFileKV opens (or creates) a file-backed KV store at path
+func NewFileKV(path string) (*FileKV, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return nil, err
+	}
+
+	kv := &FileKV{
+		path:    absPath,
+		entries: make(kvTable),
+	}
+
+	if err := kv.load(); err != nil {
+		return nil, err
+	}
+
+	// Start from a compact log so replay stays fast across restarts
+	if err := kv.compact(); err != nil {
+		return nil, err
+	}
+
+	return kv, nil
+}
+
+// load replays the log file into memory
+func (k *FileKV) load() error {
+	f, err := os.Open(k.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 32*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec kvRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			// A torn final write after a crash is expected; skip it
+			continue
+		}
+
+		switch rec.Op {
+		case "put":
+			entry := kvEntry{Value: rec.Value}
+			if rec.ExpiresAt > 0 {
+				entry.ExpiresAt = time.Unix(rec.ExpiresAt, 0)
+			}
+			if entry.expired(now) {
+				delete(k.entries, rec.Key)
+			} else {
+				k.entries[rec.Key] = entry
+			}
+		case "del":
+			delete(k.entries, rec.Key)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// compact rewrites the log with only live entries and reopens it for appending
+// Caller must hold k.mu (or be the constructor)
+func (k *FileKV) compact() error {
+	if k.file != nil {
+		k.file.Close()
+		k.file = nil
+	}
+
+	tmpPath := k.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := bufio.NewWriter(tmp)
+	records := 0
+	for key, entry := range k.entries {
+		if entry.expired(now) {
+			delete(k.entries, key)
+			continue
+		}
+		if err := writeRecord(w, putRecord(key, entry)); err != nil {
+			tmp.Close()
+			return err
+		}
+		records++
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, k.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(k.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	k.file = file
+	k.records = records
+	return nil
+}
+
+// append writes a record to the log, then applies it to memory, compacting when
+// the log has grown too large
+// A record that can't be written isn't applied, so memory never holds changes
+// that would be lost on restart. Caller must hold k.mu
+func (k *FileKV) append(rec kvRecord, apply func()) error {
+	if k.file == nil {
+		return fmt.Errorf("kv store is closed")
+	}
+
+	if err := writeRecord(k.file, rec); err != nil {
+		return err
+	}
+	k.records++
+	apply()
+
+	if k.records > compactMinRecords && k.records > 2*len(k.entries) {
+		return k.compact()
+	}
+	return nil
+}
+
+func (k *FileKV) Get(ctx context.Context, key string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Expired entries are dropped from the log at next compaction
+	entry, ok := k.entries.get(key, time.Now())
+	if !ok {
+		return nil, nil
+	}
+	return bytes.Clone(entry.Value), nil // Callers may modify the result
+}
+
+func (k *FileKV) Put(ctx context.Context, key string, value []byte) error {
+	return k.PutWithTTL(ctx, key, value, 0)
+}
+
+// PutWithTTL stores a value that expires after ttl (0 means never)
+func (k *FileKV) PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := newKVEntry(value, ttl)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.append(putRecord(key, entry), func() { k.entries[key] = entry })
+}
+
+func (k *FileKV) CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error) {
+	entry := newKVEntry(value, ttl)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if !k.entries.matches(key, old, time.Now()) {
+		return false, nil
+	}
+	if err := k.append(putRecord(key, entry), func() { k.entries[key] = entry }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (k *FileKV) Delete(ctx context.Context, key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.entries[key]; !ok {
+		return nil
+	}
+	return k.append(kvRecord{Op: "del", Key: key}, func() { delete(k.entries, key) })
+}
+
+func (k *FileKV) List(ctx context.Context, prefix, cursor string) (*KVListResult, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.entries.list(prefix, cursor, time.Now()), nil
+}
+
+// Close flushes and closes the log file
+func (k *FileKV) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.file == nil {
+		return nil
+	}
+	err := k.file.Close()
+	k.file = nil
+	return err
+}
+
+func putRecord(key string, entry kvEntry) kvRecord {
+	rec := kvRecord{Op: "put", Key: key, Value: entry.Value}
+	if !entry.ExpiresAt.IsZero() {
+		rec.ExpiresAt = entry.ExpiresAt.Unix()
+	}
+	return rec
+}
+
+func writeRecord(w io.Writer, rec kvRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,149 @@
+//go:build !cloudflare
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileKV_SurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.jsonl")
+
+	kv, err := NewFileKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Put(ctx, "status:a.dsh", []byte(`{"status":"complete"}`))
+	kv.Put(ctx, "status:b.dsh", []byte(`{"status":"error"}`))
+	kv.Put(ctx, "cache:x", []byte("1"))
+	kv.Delete(ctx, "status:b.dsh")
+	kv.Close()
+
+	kv, err = NewFileKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+
+	got, _ := kv.Get(ctx, "status:a.dsh")
+	if string(got) != `{"status":"complete"}` {
+		t.Errorf("Get after reopen = %q", got)
+	}
+	if got, _ := kv.Get(ctx, "status:b.dsh"); got != nil {
+		t.Errorf("deleted key still present: %q", got)
+	}
+
+	page, _ := kv.List(ctx, "status:", "")
+	if len(page.Keys) != 1 || page.Keys[0] != "status:a.dsh" {
+		t.Errorf("List(status:) = %v", page.Keys)
+	}
+}
+
+func TestFileKV_TTL(t *testing.T) {
+	ctx := context.Background()
+	kv, err := NewFileKV(filepath.Join(t.TempDir(), "kv.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+
+	kv.PutWithTTL(ctx, "short", []byte("v"), time.Millisecond)
+	kv.PutWithTTL(ctx, "long", []byte("v"), time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	if got, _ := kv.Get(ctx, "short"); got != nil {
+		t.Errorf("expired key returned %q", got)
+	}
+	if got, _ := kv.Get(ctx, "long"); string(got) != "v" {
+		t.Errorf("live key returned %q", got)
+	}
+	if page, _ := kv.List(ctx, "", ""); len(page.Keys) != 1 {
+		t.Errorf("List should skip expired keys, got %v", page.Keys)
+	}
+}
+
+func TestFileKV_CompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.jsonl")
+	kv, err := NewFileKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := kv.CompareAndSwap(ctx, "lock", nil, []byte("a"), 0); !ok {
+		t.Fatal("CAS on absent key should succeed")
+	}
+	if ok, _ := kv.CompareAndSwap(ctx, "lock", nil, []byte("b"), 0); ok {
+		t.Fatal("CAS expecting absent key should fail once it exists")
+	}
+	if ok, _ := kv.CompareAndSwap(ctx, "lock", []byte("a"), []byte("c"), 0); !ok {
+		t.Fatal("CAS with matching old value should succeed")
+	}
+	kv.Close()
+
+	kv, _ = NewFileKV(path)
+	defer kv.Close()
+	if got, _ := kv.Get(ctx, "lock"); string(got) != "c" {
+		t.Errorf("swapped value not persisted, got %q", got)
+	}
+}
+
+func TestFileKV_ListPaging(t *testing.T) {
+	ctx := context.Background()
+	kv, err := NewFileKV(filepath.Join(t.TempDir(), "kv.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+
+	total := kvListLimit + 5
+	for i := 0; i < total; i++ {
+		kv.Put(ctx, fmt.Sprintf("status:%05d", i), []byte("x"))
+	}
+
+	first, _ := kv.List(ctx, "status:", "")
+	if len(first.Keys) != kvListLimit || first.Cursor == "" {
+		t.Fatalf("first page: %d keys, cursor %q", len(first.Keys), first.Cursor)
+	}
+
+	keys, err := ListAllKV(ctx, kv, "status:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != total {
+		t.Errorf("ListAllKV returned %d keys, want %d", len(keys), total)
+	}
+}
+
+func TestFileKV_FailedWriteNotApplied(t *testing.T) {
+	ctx := context.Background()
+	kv, err := NewFileKV(filepath.Join(t.TempDir(), "kv.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	kv.Put(ctx, "a", []byte("1"))
+
+	// Callers can't change stored values through what Get returns
+	got, _ := kv.Get(ctx, "a")
+	got[0] = 'x'
+	if got, _ := kv.Get(ctx, "a"); string(got) != "1" {
+		t.Errorf("stored value changed to %q", got)
+	}
+
+	kv.file.Close() // Writes to the log now fail
+	if err := kv.Put(ctx, "a", []byte("2")); err == nil {
+		t.Fatal("Put succeeded with the log closed")
+	}
+	if err := kv.Delete(ctx, "a"); err == nil {
+		t.Fatal("Delete succeeded with the log closed")
+	}
+	if got, _ := kv.Get(ctx, "a"); string(got) != "1" {
+		t.Errorf("Get = %q after failed writes, want the logged 1", got)
+	}
+}
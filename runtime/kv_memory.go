@@ -0,0 +1,141 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kvListLimit is the maximum number of keys returned per List page
+// Matches the Cloudflare KV default so callers page the same way everywhere
+const kvListLimit = 1000
+
+// kvEntry is a live value held in memory
+type kvEntry struct {
+	Value     []byte
+	ExpiresAt time.Time // Zero means no expiry
+}
+
+func (e kvEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+func newKVEntry(value []byte, ttl time.Duration) kvEntry {
+	entry := kvEntry{Value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	return entry
+}
+
+// kvTable is the in-memory key table shared by MemoryKV and FileKV
+// It is not safe for concurrent use; callers hold their own lock.
+type kvTable map[string]kvEntry
+
+// get returns the live entry for key, dropping it if it has expired
+func (t kvTable) get(key string, now time.Time) (kvEntry, bool) {
+	entry, ok := t[key]
+	if !ok {
+		return kvEntry{}, false
+	}
+	if entry.expired(now) {
+		delete(t, key)
+		return kvEntry{}, false
+	}
+	return entry, true
+}
+
+// matches reports whether the current value of key equals old (nil old means absent)
+func (t kvTable) matches(key string, old []byte, now time.Time) bool {
+	entry, ok := t.get(key, now)
+	if old == nil {
+		return !ok
+	}
+	return ok && bytes.Equal(entry.Value, old)
+}
+
+// list returns one page of live keys with prefix, starting after cursor
+func (t kvTable) list(prefix, cursor string, now time.Time) *KVListResult {
+	keys := make([]string, 0)
+	for key, entry := range t {
+		if entry.expired(now) || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if cursor != "" && key <= cursor {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := &KVListResult{Keys: keys}
+	if len(keys) > kvListLimit {
+		result.Keys = keys[:kvListLimit]
+		result.Cursor = keys[kvListLimit-1]
+	}
+	return result
+}
+
+// MemoryKV implements KVStore in process memory
+// Used for tests and single-process deployments that don't need persistence
+type MemoryKV struct {
+	mu      sync.Mutex
+	entries kvTable
+}
+
+// NewMemoryKV creates an empty in-memory KV store
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{entries: make(kvTable)}
+}
+
+func (k *MemoryKV) Get(ctx context.Context, key string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	entry, ok := k.entries.get(key, time.Now())
+	if !ok {
+		return nil, nil
+	}
+	return bytes.Clone(entry.Value), nil // Callers may modify the result
+}
+
+func (k *MemoryKV) Put(ctx context.Context, key string, value []byte) error {
+	return k.PutWithTTL(ctx, key, value, 0)
+}
+
+func (k *MemoryKV) PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.entries[key] = newKVEntry(value, ttl)
+	return nil
+}
+
+func (k *MemoryKV) CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if !k.entries.matches(key, old, time.Now()) {
+		return false, nil
+	}
+	k.entries[key] = newKVEntry(value, ttl)
+	return true, nil
+}
+
+func (k *MemoryKV) Delete(ctx context.Context, key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.entries, key)
+	return nil
+}
+
+func (k *MemoryKV) List(ctx context.Context, prefix, cursor string) (*KVListResult, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.entries.list(prefix, cursor, time.Now()), nil
+}
@@ -0,0 +1,183 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+)
+
+// Limits bounds the renders a server runs
+// Zero fields are unlimited.
+type Limits struct {
+	MaxSourceBytes int           // Source after import expansion
+	MaxSlides      int           // Checked on the result; native pipelines also stop before rendering
+	RenderTimeout  time.Duration // Wall-clock time of one render, not counting time queued
+	MaxConcurrent  int           // Renders running at once
+	MaxQueued      int           // Renders waiting for a slot before new ones are refused
+	QueueTimeout   time.Duration // How long a render waits for a slot
+}
+
+// DefaultLimits keep one oversized or runaway deck from starving the rest
+var DefaultLimits = Limits{
+	MaxSourceBytes: 8 << 20,
+	MaxSlides:      500,
+	RenderTimeout:  time.Minute,
+	MaxConcurrent:  4,
+	MaxQueued:      32,
+	QueueTimeout:   30 * time.Second,
+}
+
+// LimitedPipeline enforces Limits around another pipeline
+// Limit failures are *pipeline.LimitError.
+type LimitedPipeline struct {
+	Pipeline
+	limits Limits
+	slots  chan struct{} // Nil without a concurrency limit
+
+	mu      sync.Mutex
+	waiting int
+}
+
+// WithLimits wraps p so every render is checked against l
+func WithLimits(p Pipeline, l Limits) *LimitedPipeline {
+	lp := &LimitedPipeline{Pipeline: p, limits: l}
+	if l.MaxConcurrent > 0 {
+		lp.slots = make(chan struct{}, l.MaxConcurrent)
+	}
+	return lp
+}
+
+// Describe implements Describer for the wrapped pipeline
+func (p *LimitedPipeline) Describe() PipelineInfo {
+	if d, ok := p.Pipeline.(Describer); ok {
+		return d.Describe()
+	}
+	return PipelineInfo{}
+}
+
+func (p *LimitedPipeline) Process(ctx context.Context, source []byte, format Format) (*ProcessResult, error) {
+	return p.ProcessWithWorkDir(ctx, source, format, "")
+}
+
+func (p *LimitedPipeline) ProcessWithWorkDir(ctx context.Context, source []byte, format Format, workDir string) (*ProcessResult, error) {
+	var result *ProcessResult
+	err := p.bounded(ctx, source, func(ctx context.Context) (err error) {
+		result, err = p.Pipeline.ProcessWithWorkDir(ctx, source, format, workDir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if max := p.limits.MaxSlides; max > 0 && result.SlideCount > max {
+		return nil, &pipeline.LimitError{Limit: pipeline.LimitSlides, Max: int64(max), Actual: int64(result.SlideCount), Unit: "slides"}
+	}
+	return result, nil
+}
+
+// Parse implements Parser under the same limits and render slots as renders
+// Pipelines that don't parse themselves run decksh in this process.
+func (p *LimitedPipeline) Parse(ctx context.Context, source []byte) (*deck.Deck, error) {
+	var d *deck.Deck
+	err := p.bounded(ctx, source, func(ctx context.Context) (err error) {
+		if parser, ok := p.Pipeline.(Parser); ok {
+			d, err = parser.Parse(ctx, source)
+		} else {
+			d, err = pipeline.Parse(ctx, source)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if max := p.limits.MaxSlides; max > 0 && len(d.Slide) > max {
+		return nil, &pipeline.LimitError{Limit: pipeline.LimitSlides, Max: int64(max), Actual: int64(len(d.Slide)), Unit: "slides"}
+	}
+	return d, nil
+}
+
+// Bounded runs fn, render work done in this process such as rasterizing a
+// thumbnail, in a render slot of the global pipeline and under its RenderTimeout
+// Without a LimitedPipeline fn just runs.
+func Bounded(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p, ok := globalPipeline.(*LimitedPipeline); ok {
+		return p.bounded(ctx, nil, fn)
+	}
+	return fn(ctx)
+}
+
+// bounded runs fn on source with a render slot and under RenderTimeout,
+// refusing oversized sources first
+func (p *LimitedPipeline) bounded(ctx context.Context, source []byte, fn func(ctx context.Context) error) error {
+	if max := p.limits.MaxSourceBytes; max > 0 && len(source) > max {
+		return &pipeline.LimitError{Limit: pipeline.LimitSource, Max: int64(max), Actual: int64(len(source)), Unit: "bytes"}
+	}
+
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	renderCtx := ctx
+	if p.limits.RenderTimeout > 0 {
+		var cancel context.CancelFunc
+		renderCtx, cancel = context.WithTimeout(ctx, p.limits.RenderTimeout)
+		defer cancel()
+	}
+
+	if err := fn(renderCtx); err != nil {
+		// Only our own deadline is a render timeout; the caller's is its business
+		if pipeline.Expired(ctx) == nil && errors.Is(pipeline.Expired(renderCtx), context.DeadlineExceeded) {
+			return &pipeline.LimitError{Limit: pipeline.LimitTimeout, Max: p.limits.RenderTimeout.Milliseconds(), Unit: "ms"}
+		}
+		return err
+	}
+	return nil
+}
+
+// acquire waits for a render slot, refusing at once when MaxQueued renders
+// are already waiting
+func (p *LimitedPipeline) acquire(ctx context.Context) (release func(), err error) {
+	if p.slots == nil {
+		return func() {}, nil
+	}
+	release = func() { <-p.slots }
+
+	select {
+	case p.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	p.mu.Lock()
+	if p.limits.MaxQueued > 0 && p.waiting >= p.limits.MaxQueued {
+		p.mu.Unlock()
+		return nil, &pipeline.LimitError{Limit: pipeline.LimitQueue, Max: int64(p.limits.MaxQueued), Unit: "renders"}
+	}
+	p.waiting++
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.waiting--
+		p.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if p.limits.QueueTimeout > 0 {
+		timer := time.NewTimer(p.limits.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		return nil, &pipeline.LimitError{Limit: pipeline.LimitQueueTimeout, Max: p.limits.QueueTimeout.Milliseconds(), Unit: "ms"}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,197 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+)
+
+// slowPipeline renders one slide per source byte after delay, or until ctx ends
+type slowPipeline struct {
+	delay time.Duration
+}
+
+func (p slowPipeline) Process(ctx context.Context, source []byte, format Format) (*ProcessResult, error) {
+	return p.ProcessWithWorkDir(ctx, source, format, "")
+}
+
+func (p slowPipeline) ProcessWithWorkDir(ctx context.Context, source []byte, format Format, workDir string) (*ProcessResult, error) {
+	select {
+	case <-time.After(p.delay):
+		return &ProcessResult{SlideCount: len(source)}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p slowPipeline) Parse(ctx context.Context, source []byte) (*deck.Deck, error) {
+	result, err := p.ProcessWithWorkDir(ctx, source, FormatSVG, "")
+	if err != nil {
+		return nil, err
+	}
+	return &deck.Deck{Slide: make([]deck.Slide, result.SlideCount)}, nil
+}
+
+func (p slowPipeline) SupportedFormats() []Format {
+	return []Format{FormatSVG}
+}
+
+func limitOf(err error) string {
+	var lerr *pipeline.LimitError
+	if errors.As(err, &lerr) {
+		return lerr.Limit
+	}
+	return ""
+}
+
+func TestLimitedPipeline_Sizes(t *testing.T) {
+	p := WithLimits(slowPipeline{}, Limits{MaxSourceBytes: 8, MaxSlides: 4})
+	ctx := context.Background()
+
+	if _, err := p.Process(ctx, []byte("abc"), FormatSVG); err != nil {
+		t.Fatalf("within limits: %v", err)
+	}
+	if _, err := p.Process(ctx, []byte("abcdefghi"), FormatSVG); limitOf(err) != pipeline.LimitSource {
+		t.Errorf("oversized source: %v", err)
+	}
+	if _, err := p.Process(ctx, []byte("abcdef"), FormatSVG); limitOf(err) != pipeline.LimitSlides {
+		t.Errorf("too many slides: %v", err)
+	}
+}
+
+func TestLimitedPipeline_Timeout(t *testing.T) {
+	p := WithLimits(slowPipeline{delay: time.Second}, Limits{RenderTimeout: 10 * time.Millisecond})
+	if _, err := p.Process(context.Background(), []byte("a"), FormatSVG); limitOf(err) != pipeline.LimitTimeout {
+		t.Errorf("slow render: %v", err)
+	}
+
+	// The caller's own deadline isn't reported as a render timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	p = WithLimits(slowPipeline{delay: time.Second}, Limits{RenderTimeout: time.Minute})
+	if _, err := p.Process(ctx, []byte("a"), FormatSVG); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("caller deadline: %v", err)
+	}
+}
+
+func TestLimitedPipeline_Queue(t *testing.T) {
+	p := WithLimits(slowPipeline{delay: 200 * time.Millisecond}, Limits{MaxConcurrent: 1, MaxQueued: 1, QueueTimeout: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	running := make(chan error)
+	go func() {
+		_, err := p.Process(ctx, []byte("a"), FormatSVG)
+		running <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	queued := make(chan error)
+	go func() {
+		_, err := p.Process(ctx, []byte("a"), FormatSVG)
+		queued <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := p.Process(ctx, []byte("a"), FormatSVG); limitOf(err) != pipeline.LimitQueue {
+		t.Errorf("full queue: %v", err)
+	}
+	if err := <-queued; limitOf(err) != pipeline.LimitQueueTimeout {
+		t.Errorf("queued past timeout: %v", err)
+	}
+	if err := <-running; err != nil {
+		t.Errorf("running render: %v", err)
+	}
+	if _, err := p.Process(ctx, []byte("a"), FormatSVG); err != nil {
+		t.Errorf("after the queue drained: %v", err)
+	}
+}
+
+func TestLimitedPipeline_Parse(t *testing.T) {
+	p := WithLimits(slowPipeline{delay: 100 * time.Millisecond}, Limits{
+		MaxSourceBytes: 8,
+		MaxSlides:      4,
+		RenderTimeout:  50 * time.Millisecond,
+		MaxConcurrent:  1,
+		MaxQueued:      1,
+		QueueTimeout:   time.Minute,
+	})
+	SetPipeline(p)
+	defer SetPipeline(nil)
+	ctx := context.Background()
+
+	if _, err := Parse(ctx, []byte("abcdefghi")); limitOf(err) != pipeline.LimitSource {
+		t.Errorf("oversized source: %v", err)
+	}
+	if _, err := Parse(ctx, []byte("a")); limitOf(err) != pipeline.LimitTimeout {
+		t.Errorf("slow parse: %v", err)
+	}
+
+	// Parses wait for the same slots as renders
+	p.Pipeline = slowPipeline{delay: 20 * time.Millisecond}
+	p.limits.RenderTimeout = time.Second
+	running := make(chan error)
+	go func() {
+		_, err := p.Process(ctx, []byte("a"), FormatSVG)
+		running <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	start := time.Now()
+	if _, err := Parse(ctx, []byte("abcdef")); limitOf(err) != pipeline.LimitSlides {
+		t.Errorf("too many slides: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("parse didn't wait for the render slot (%v)", elapsed)
+	}
+	if err := <-running; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBounded(t *testing.T) {
+	ctx := context.Background()
+	ran := false
+	if err := Bounded(ctx, func(context.Context) error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("without limits: ran %v, %v", ran, err)
+	}
+
+	p := WithLimits(slowPipeline{delay: 20 * time.Millisecond}, Limits{
+		RenderTimeout: 10 * time.Millisecond,
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		QueueTimeout:  time.Minute,
+	})
+	SetPipeline(p)
+	defer SetPipeline(nil)
+
+	// A deadline passed while fn never yielded is still a render timeout
+	err := Bounded(ctx, func(ctx context.Context) error {
+		time.Sleep(15 * time.Millisecond)
+		return pipeline.Expired(ctx)
+	})
+	if limitOf(err) != pipeline.LimitTimeout {
+		t.Errorf("slow work: %v", err)
+	}
+
+	// Work waits for the render slot
+	p.limits.RenderTimeout = time.Second
+	running := make(chan error)
+	go func() {
+		_, err := p.Process(ctx, []byte("a"), FormatSVG)
+		running <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	start := time.Now()
+	if err := Bounded(ctx, func(context.Context) error { return nil }); err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("work didn't wait for the render slot (%v)", elapsed)
+	}
+	if err := <-running; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,11 @@
 package runtime
 
-import "context"
+import (
+	"context"
+
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/pipeline"
+)
 
 // Pipeline abstracts deck processing across different runtimes
 type Pipeline interface {
@@ -14,6 +19,25 @@ type Pipeline interface {
 	SupportedFormats() []Format
 }
 
+// Parser is optionally implemented by pipelines that parse decksh source the
+// same way they render it; see pipeline.Parser
+type Parser = pipeline.Parser
+
+// Describer is optionally implemented by pipelines that report their setup
+// for the /health readiness report
+type Describer interface {
+	Describe() PipelineInfo
+}
+
+// PipelineInfo describes how a pipeline renders
+type PipelineInfo struct {
+	Type     string            `json:"type"` // native or wasm
+	Binaries []pipeline.Binary `json:"binaries,omitempty"`
+	// FontDir is the local font directory PNG and PDF renders read, when they
+	// don't get fonts from a font provider
+	FontDir string `json:"fontDir,omitempty"`
+}
+
 // Format represents output format
 type Format string
 
@@ -41,3 +65,14 @@ func SetPipeline(p Pipeline) {
 func GetPipeline() Pipeline {
 	return globalPipeline
 }
+
+// Parse converts decksh source into the deck model through the global
+// pipeline, so parses share its limits and render slots
+// Imports must already be expanded. Without a parsing pipeline decksh runs in
+// this process.
+func Parse(ctx context.Context, source []byte) (*deck.Deck, error) {
+	if p, ok := globalPipeline.(Parser); ok {
+		return p.Parse(ctx, source)
+	}
+	return pipeline.Parse(ctx, source)
+}
@@ -5,6 +5,8 @@ package runtime
 import (
 	"context"
 
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/fonts"
 	"github.com/joeblew999/deckfs/pkg/pipeline"
 )
 
@@ -25,6 +27,30 @@ func NewNativePipeline(binDir string) (*NativePipeline, error) {
 	}, nil
 }
 
+// SetFontProvider makes PNG and PDF renders fetch their fonts from f
+func (p *NativePipeline) SetFontProvider(f pipeline.FontProvider) {
+	p.internal.SetFontProvider(f)
+}
+
+// SetFontMap sets the font-family stacks SVG slides are written with
+func (p *NativePipeline) SetFontMap(m fonts.FontMap) {
+	p.internal.SetFontMap(m)
+}
+
+// SetLimits bounds the slides and child process resources of each render
+func (p *NativePipeline) SetLimits(l pipeline.Limits) error {
+	return p.internal.SetLimits(l)
+}
+
+// Describe implements Describer
+func (p *NativePipeline) Describe() PipelineInfo {
+	info := PipelineInfo{Type: "native", Binaries: p.internal.Binaries()}
+	if !p.internal.HasFontProvider() {
+		info.FontDir = p.internal.FontDir()
+	}
+	return info
+}
+
 func (p *NativePipeline) Process(ctx context.Context, source []byte, format Format) (*ProcessResult, error) {
 	return p.ProcessWithWorkDir(ctx, source, format, "")
 }
@@ -65,6 +91,11 @@ func (p *NativePipeline) ProcessWithWorkDir(ctx context.Context, source []byte,
 	}, nil
 }
 
+// Parse implements Parser with the decksh binary
+func (p *NativePipeline) Parse(ctx context.Context, source []byte) (*deck.Deck, error) {
+	return p.internal.Parse(ctx, source)
+}
+
 func (p *NativePipeline) SupportedFormats() []Format {
 	formats := p.internal.SupportedFormats()
 	result := make([]Format, len(formats))
@@ -5,13 +5,16 @@ package runtime
 import (
 	"context"
 
+	"github.com/ajstarks/deck"
+	"github.com/joeblew999/deckfs/pkg/fonts"
 	"github.com/joeblew999/deckfs/pkg/pipeline"
 )
 
 // WASMPipeline implements Pipeline using internal WASM processors
 type WASMPipeline struct {
-	width  int
-	height int
+	width   int
+	height  int
+	fontMap fonts.FontMap
 }
 
 // NewWASMPipeline creates a new WASM pipeline
@@ -29,6 +32,17 @@ func (p *WASMPipeline) WithDimensions(width, height int) *WASMPipeline {
 	return p
 }
 
+// WithFontMap sets the font-family stacks SVG slides are written with
+func (p *WASMPipeline) WithFontMap(m fonts.FontMap) *WASMPipeline {
+	p.fontMap = m
+	return p
+}
+
+// Describe implements Describer
+func (p *WASMPipeline) Describe() PipelineInfo {
+	return PipelineInfo{Type: "wasm"}
+}
+
 func (p *WASMPipeline) Process(ctx context.Context, source []byte, format Format) (*ProcessResult, error) {
 	return p.ProcessWithWorkDir(ctx, source, format, "")
 }
@@ -37,6 +51,7 @@ func (p *WASMPipeline) ProcessWithWorkDir(ctx context.Context, source []byte, fo
 	// Create internal pipeline
 	internalPipeline := pipeline.NewWASMPipeline()
 	internalPipeline.WithDimensions(p.width, p.height)
+	internalPipeline.WithFontMap(p.fontMap)
 
 	// Convert format
 	var internalFormat pipeline.OutputFormat
@@ -65,6 +80,11 @@ func (p *WASMPipeline) ProcessWithWorkDir(ctx context.Context, source []byte, fo
 	}, nil
 }
 
+// Parse implements Parser in this process, as renders run here too
+func (p *WASMPipeline) Parse(ctx context.Context, source []byte) (*deck.Deck, error) {
+	return pipeline.Parse(ctx, source)
+}
+
 func (p *WASMPipeline) SupportedFormats() []Format {
 	return []Format{FormatSVG}
 }
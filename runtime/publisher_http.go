@@ -0,0 +1,108 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpPublishTimeout bounds each publish request by default
+const httpPublishTimeout = 10 * time.Second
+
+// HTTPPublisher implements Publisher by POSTing to an HTTP publish endpoint
+// Each message is sent as POST {baseURL}/{subject} with the payload as body,
+// which matches NATS HTTP gateways and works from Workers where raw TCP isn't available
+type HTTPPublisher struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	timeout    time.Duration
+	dispatch   func(task func()) // Runs sends; nil sends inline
+}
+
+// NewHTTPPublisher creates a publisher for the given endpoint
+// If client is nil, http.DefaultClient is used
+func NewHTTPPublisher(baseURL string, client *http.Client) *HTTPPublisher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPPublisher{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: client,
+		timeout:    httpPublishTimeout,
+	}
+}
+
+// WithToken sets a bearer token sent with every publish request
+func (p *HTTPPublisher) WithToken(token string) *HTTPPublisher {
+	p.token = token
+	return p
+}
+
+// WithTimeout bounds each publish request (0 means no limit)
+func (p *HTTPPublisher) WithTimeout(timeout time.Duration) *HTTPPublisher {
+	p.timeout = timeout
+	return p
+}
+
+// WithDispatch makes Publish hand each send to dispatch and return at once,
+// logging failures
+// Workers pass cloudflare.WaitUntil so sends finish after the response.
+func (p *HTTPPublisher) WithDispatch(dispatch func(task func())) *HTTPPublisher {
+	p.dispatch = dispatch
+	return p
+}
+
+// WithAsync makes Publish return immediately and send in goroutines
+// Only suitable for long-running servers; Workers use WithDispatch
+func (p *HTTPPublisher) WithAsync(async bool) *HTTPPublisher {
+	if !async {
+		return p.WithDispatch(nil)
+	}
+	return p.WithDispatch(func(task func()) { go task() })
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	if p.dispatch == nil {
+		return p.send(ctx, subject, data)
+	}
+	detached := context.WithoutCancel(ctx)
+	p.dispatch(func() {
+		if err := p.send(detached, subject, data); err != nil {
+			log.Printf("publisher: %v", err)
+		}
+	})
+	return nil
+}
+
+// send performs one publish request
+func (p *HTTPPublisher) send(ctx context.Context, subject string, data []byte) error {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/"+subject, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("publish to %s failed: %w", subject, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("publish to %s failed: %s", subject, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+//go:build !cloudflare
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSPublisher implements Publisher using a native NATS connection
+// Used by wazero server; Workers use HTTPPublisher instead
+type NATSPublisher struct {
+	conn *nats.Conn
+}
+
+// NewNATSPublisher connects to the NATS server at url
+func NewNATSPublisher(url string, opts ...nats.Option) (*NATSPublisher, error) {
+	opts = append([]nats.Option{nats.Name("deckfs")}, opts...)
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect failed: %w", err)
+	}
+	return &NATSPublisher{conn: conn}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	if err := p.conn.Publish(subject, data); err != nil {
+		return fmt.Errorf("nats publish failed: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the connection
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,149 @@
+//go:build !cloudflare
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// startNATS runs an embedded NATS server on a random port
+func startNATS(t *testing.T) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:   "127.0.0.1",
+		Port:   server.RANDOM_PORT,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestNATSPublisher_PublishEvent(t *testing.T) {
+	srv := startNATS(t)
+
+	sub, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	msgs := make(chan *nats.Msg, 4)
+	if _, err := sub.ChanSubscribe(EventSubjectPrefix+"deck.>", msgs); err != nil {
+		t.Fatal(err)
+	}
+	sub.Flush()
+
+	pub, err := NewNATSPublisher(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+
+	prev := Current
+	SetRuntime(&Runtime{Publisher: pub})
+	defer SetRuntime(prev)
+
+	err = PublishEvent(context.Background(), Event{
+		Type:       EventDeckRendered,
+		Key:        "talks/intro.dsh",
+		SlideCount: 3,
+		DurationMs: 42,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-msgs:
+		if msg.Subject != "deckfs.deck.rendered" {
+			t.Errorf("subject = %q", msg.Subject)
+		}
+
+		var e Event
+		if err := json.Unmarshal(msg.Data, &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Version != EventSchemaVersion || e.Key != "talks/intro.dsh" || e.SlideCount != 3 || e.Time == "" {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody []byte
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotBody = make([]byte, r.ContentLength)
+		r.Body.Read(gotBody)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	pub := NewHTTPPublisher(ts.URL+"/", nil).WithToken("secret")
+	if err := pub.Publish(context.Background(), "deckfs.deck.failed", []byte(`{"key":"a.dsh"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotPath != "/deckfs.deck.failed" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("auth = %q", gotAuth)
+	}
+	if string(gotBody) != `{"key":"a.dsh"}` {
+		t.Errorf("body = %q", gotBody)
+	}
+}
+
+func TestHTTPPublisher_TimeoutAndDispatch(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	// A stalled gateway fails the publish instead of hanging it
+	pub := NewHTTPPublisher(ts.URL, nil).WithTimeout(50 * time.Millisecond)
+	start := time.Now()
+	if err := pub.Publish(context.Background(), "deckfs.deck.failed", []byte(`{}`)); err == nil {
+		t.Error("publish to a stalled gateway succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("publish took %v", elapsed)
+	}
+
+	// Dispatched publishes return before the request is sent
+	var tasks []func()
+	pub.WithDispatch(func(task func()) { tasks = append(tasks, task) })
+	if err := pub.Publish(context.Background(), "deckfs.deck.failed", []byte(`{}`)); err != nil || len(tasks) != 1 {
+		t.Fatalf("dispatched publish = %v with %d tasks", err, len(tasks))
+	}
+	tasks[0]()
+}
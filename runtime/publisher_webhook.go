@@ -0,0 +1,420 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KV keys used by the webhook publisher
+const (
+	webhookSubPrefix        = "webhook:sub:"
+	webhookIndexKey         = "webhook:index" // Every subscription in one value, read by Publish
+	webhookDeadLetterPrefix = "deadletter:webhook:"
+)
+
+// Webhook delivery headers
+const (
+	WebhookSignatureHeader = "X-DeckFS-Signature"
+	WebhookTimestampHeader = "X-DeckFS-Timestamp"
+	WebhookEventHeader     = "X-DeckFS-Event"
+	WebhookDeliveryHeader  = "X-DeckFS-Delivery"
+)
+
+// DeadLetterTTL is how long failed deliveries are kept for inspection
+const DeadLetterTTL = 7 * 24 * time.Hour
+
+// Webhook publisher defaults
+const (
+	webhookTimeout  = 10 * time.Second // Per delivery attempt
+	webhookCacheTTL = time.Minute      // Subscriptions held in memory between events
+)
+
+// WebhookSubscription is a registered webhook endpoint
+type WebhookSubscription struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events,omitempty"` // Event types to deliver ("deck.rendered"); empty means all
+	CreatedAt string   `json:"createdAt"`
+}
+
+// Wants reports whether the subscription should receive the given event type
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeadLetter records a delivery that exhausted its retries
+type WebhookDeadLetter struct {
+	DeliveryID     string `json:"deliveryId"`
+	SubscriptionID string `json:"subscriptionId"`
+	URL            string `json:"url"`
+	Subject        string `json:"subject"`
+	Payload        string `json:"payload"`
+	Attempts       int    `json:"attempts"`
+	Error          string `json:"error"`
+	FailedAt       string `json:"failedAt"`
+}
+
+// WebhookPublisher implements Publisher by POSTing events to registered webhooks
+// Subscriptions and dead letters are stored in KV. Each delivery is signed with
+// HMAC-SHA256 over "timestamp.body" using the subscription secret and retried
+// with exponential backoff.
+// Publish reads every subscription from one KV value, kept in memory for
+// webhookCacheTTL, so an event costs at most one KV read.
+type WebhookPublisher struct {
+	kv          KVStore
+	httpClient  *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	timeout     time.Duration
+	dispatch    func(task func()) // Runs deliveries; nil delivers inline
+
+	mu       sync.Mutex
+	cached   []WebhookSubscription
+	cachedAt time.Time
+}
+
+// NewWebhookPublisher creates a webhook publisher backed by kv
+// If client is nil, http.DefaultClient is used
+func NewWebhookPublisher(kv KVStore, client *http.Client) *WebhookPublisher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookPublisher{
+		kv:          kv,
+		httpClient:  client,
+		maxAttempts: 5,
+		baseDelay:   500 * time.Millisecond,
+		timeout:     webhookTimeout,
+	}
+}
+
+// WithRetry sets the delivery attempt budget and the initial backoff delay
+func (p *WebhookPublisher) WithRetry(maxAttempts int, baseDelay time.Duration) *WebhookPublisher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	p.maxAttempts = maxAttempts
+	p.baseDelay = baseDelay
+	return p
+}
+
+// WithTimeout bounds each delivery attempt (0 means no limit)
+func (p *WebhookPublisher) WithTimeout(timeout time.Duration) *WebhookPublisher {
+	p.timeout = timeout
+	return p
+}
+
+// WithDispatch makes Publish hand each delivery to dispatch and return at once
+// Workers pass cloudflare.WaitUntil so deliveries finish after the response.
+func (p *WebhookPublisher) WithDispatch(dispatch func(task func())) *WebhookPublisher {
+	p.dispatch = dispatch
+	return p
+}
+
+// WithAsync makes Publish return immediately and deliver in goroutines
+// Only suitable for long-running servers; Workers use WithDispatch
+func (p *WebhookPublisher) WithAsync(async bool) *WebhookPublisher {
+	if !async {
+		return p.WithDispatch(nil)
+	}
+	return p.WithDispatch(func(task func()) { go task() })
+}
+
+// Register stores a new subscription, generating its ID and (if empty) secret
+func (p *WebhookPublisher) Register(ctx context.Context, sub WebhookSubscription) (*WebhookSubscription, error) {
+	if !strings.HasPrefix(sub.URL, "http://") && !strings.HasPrefix(sub.URL, "https://") {
+		return nil, fmt.Errorf("webhook url must be http or https")
+	}
+
+	sub.ID = randomHex(8)
+	if sub.Secret == "" {
+		sub.Secret = randomHex(32)
+	}
+	sub.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.kv.Put(ctx, webhookSubPrefix+sub.ID, data); err != nil {
+		return nil, err
+	}
+	if err := p.saveIndex(ctx, &sub, ""); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Subscription returns a registered subscription, or nil if it doesn't exist
+func (p *WebhookPublisher) Subscription(ctx context.Context, id string) (*WebhookSubscription, error) {
+	data, err := p.kv.Get(ctx, webhookSubPrefix+id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var sub WebhookSubscription
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Subscriptions returns all registered subscriptions
+func (p *WebhookPublisher) Subscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	keys, err := ListAllKV(ctx, p.kv, webhookSubPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := make([]WebhookSubscription, 0, len(keys))
+	for _, key := range keys {
+		sub, err := p.Subscription(ctx, strings.TrimPrefix(key, webhookSubPrefix))
+		if err != nil || sub == nil {
+			continue
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, nil
+}
+
+// Unregister removes a subscription
+func (p *WebhookPublisher) Unregister(ctx context.Context, id string) error {
+	if err := p.kv.Delete(ctx, webhookSubPrefix+id); err != nil {
+		return err
+	}
+	return p.saveIndex(ctx, nil, id)
+}
+
+// saveIndex rewrites the subscription list Publish reads, with added stored and
+// removed dropped; KV listings can lag behind writes, so both are applied by hand
+func (p *WebhookPublisher) saveIndex(ctx context.Context, added *WebhookSubscription, removed string) error {
+	subs, err := p.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	index := make([]WebhookSubscription, 0, len(subs)+1)
+	for _, sub := range subs {
+		if sub.ID != removed && (added == nil || sub.ID != added.ID) {
+			index = append(index, sub)
+		}
+	}
+	if added != nil {
+		index = append(index, *added)
+	}
+	return p.writeIndex(ctx, index)
+}
+
+// writeIndex stores index as the subscription list and drops the memory copy
+func (p *WebhookPublisher) writeIndex(ctx context.Context, index []WebhookSubscription) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.cached = nil
+	p.mu.Unlock()
+	return p.kv.Put(ctx, webhookIndexKey, data)
+}
+
+// active returns the subscriptions events are delivered to
+func (p *WebhookPublisher) active(ctx context.Context) ([]WebhookSubscription, error) {
+	p.mu.Lock()
+	if p.cached != nil && time.Since(p.cachedAt) < webhookCacheTTL {
+		subs := p.cached
+		p.mu.Unlock()
+		return subs, nil
+	}
+	p.mu.Unlock()
+
+	data, err := p.kv.Get(ctx, webhookIndexKey)
+	if err != nil {
+		return nil, err
+	}
+	var subs []WebhookSubscription
+	if data == nil || json.Unmarshal(data, &subs) != nil {
+		// Subscriptions registered before the index existed
+		if subs, err = p.Subscriptions(ctx); err != nil {
+			return nil, err
+		}
+		p.writeIndex(ctx, subs)
+	}
+
+	p.mu.Lock()
+	p.cached, p.cachedAt = subs, time.Now()
+	p.mu.Unlock()
+	return subs, nil
+}
+
+// DeadLetters returns failed deliveries recorded for a subscription
+func (p *WebhookPublisher) DeadLetters(ctx context.Context, id string) ([]WebhookDeadLetter, error) {
+	keys, err := ListAllKV(ctx, p.kv, webhookDeadLetterPrefix+id+":")
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]WebhookDeadLetter, 0, len(keys))
+	for _, key := range keys {
+		data, err := p.kv.Get(ctx, key)
+		if err != nil || data == nil {
+			continue
+		}
+		var dl WebhookDeadLetter
+		if err := json.Unmarshal(data, &dl); err == nil {
+			letters = append(letters, dl)
+		}
+	}
+	return letters, nil
+}
+
+// Publish delivers the payload to every subscription that wants this subject
+// With a dispatcher, delivery failures are only recorded as dead letters.
+func (p *WebhookPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	subs, err := p.active(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+
+	eventType := strings.TrimPrefix(subject, EventSubjectPrefix)
+	var errs []error
+	for i := range subs {
+		sub := subs[i]
+		if !sub.Wants(eventType) {
+			continue
+		}
+
+		if p.dispatch != nil {
+			detached := context.WithoutCancel(ctx)
+			p.dispatch(func() { p.Deliver(detached, &sub, subject, data) })
+			continue
+		}
+		if err := p.Deliver(ctx, &sub, subject, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Deliver sends one payload to one subscription, retrying with exponential backoff
+// When all attempts fail, a dead-letter record is written to KV
+func (p *WebhookPublisher) Deliver(ctx context.Context, sub *WebhookSubscription, subject string, data []byte) error {
+	deliveryID := randomHex(8)
+	delay := p.baseDelay
+
+	var lastErr error
+	attempts := 0
+retry:
+	for attempts < p.maxAttempts {
+		attempts++
+		lastErr = p.send(ctx, sub, deliveryID, subject, data)
+		if lastErr == nil {
+			return nil
+		}
+		if attempts == p.maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			lastErr = ctx.Err()
+			break retry
+		case <-time.After(delay):
+			delay *= 2
+		}
+	}
+
+	dl := WebhookDeadLetter{
+		DeliveryID:     deliveryID,
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		Subject:        subject,
+		Payload:        string(data),
+		Attempts:       attempts,
+		Error:          lastErr.Error(),
+		FailedAt:       time.Now().UTC().Format(time.RFC3339),
+	}
+	dlJSON, _ := json.Marshal(dl)
+	p.kv.PutWithTTL(context.WithoutCancel(ctx), webhookDeadLetterPrefix+sub.ID+":"+deliveryID, dlJSON, DeadLetterTTL)
+
+	return fmt.Errorf("webhook %s delivery failed after %d attempts: %w", sub.ID, attempts, lastErr)
+}
+
+// send performs a single signed delivery attempt
+func (p *WebhookPublisher) send(ctx context.Context, sub *WebhookSubscription, deliveryID, subject string, data []byte) error {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, subject)
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(sub.Secret, timestamp, data))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook computes the hex HMAC-SHA256 of "timestamp.body" with secret
+// Receivers recompute it to verify X-DeckFS-Signature
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MultiPublisher fans a message out to several publishers
+type MultiPublisher []Publisher
+
+func (m MultiPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	var errs []error
+	for _, p := range m {
+		if err := p.Publish(ctx, subject, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
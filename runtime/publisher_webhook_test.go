@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookPublisher_SignedDelivery(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+	wp := NewWebhookPublisher(kv, nil).WithRetry(1, 0)
+
+	received := make(chan *http.Request, 1)
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer ts.Close()
+
+	sub, err := wp.Register(ctx, WebhookSubscription{URL: ts.URL, Events: []string{EventDeckRendered}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Secret == "" {
+		t.Fatal("expected generated secret")
+	}
+
+	// Not subscribed to failures: nothing should be delivered
+	if err := wp.Publish(ctx, EventSubject(EventDeckFailed), []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"type":"deck.rendered","key":"a.dsh"}`)
+	if err := wp.Publish(ctx, EventSubject(EventDeckRendered), payload); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-received:
+		if r.Header.Get(WebhookEventHeader) != "deckfs.deck.rendered" {
+			t.Errorf("event header = %q", r.Header.Get(WebhookEventHeader))
+		}
+		want := "sha256=" + SignWebhook(sub.Secret, r.Header.Get(WebhookTimestampHeader), payload)
+		if got := r.Header.Get(WebhookSignatureHeader); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if string(body) != string(payload) {
+			t.Errorf("body = %q", body)
+		}
+	default:
+		t.Fatal("webhook was not delivered")
+	}
+
+	if len(received) != 0 {
+		t.Error("unsubscribed event was delivered")
+	}
+}
+
+func TestWebhookPublisher_RetriesThenSucceeds(t *testing.T) {
+	ctx := context.Background()
+	wp := NewWebhookPublisher(NewMemoryKV(), nil).WithRetry(3, time.Millisecond)
+
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	sub, _ := wp.Register(ctx, WebhookSubscription{URL: ts.URL})
+	if err := wp.Deliver(ctx, sub, "deckfs.deck.rendered", []byte(`{}`)); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+
+	if letters, _ := wp.DeadLetters(ctx, sub.ID); len(letters) != 0 {
+		t.Errorf("unexpected dead letters: %+v", letters)
+	}
+}
+
+func TestWebhookPublisher_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+	wp := NewWebhookPublisher(NewMemoryKV(), nil).WithRetry(2, time.Millisecond)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	sub, _ := wp.Register(ctx, WebhookSubscription{URL: ts.URL})
+	err := wp.Publish(ctx, "deckfs.deck.failed", []byte(`{"key":"b.dsh"}`))
+	if err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	letters, err := wp.DeadLetters(ctx, sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(letters))
+	}
+	dl := letters[0]
+	if dl.Attempts != 2 || dl.Subject != "deckfs.deck.failed" || !strings.Contains(dl.Error, "500") {
+		t.Errorf("unexpected dead letter: %+v", dl)
+	}
+}
+
+func TestWebhookPublisher_DispatchAndTimeout(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	// A subscription stored before the index existed is still found
+	sub := WebhookSubscription{ID: "legacy", URL: ts.URL, Secret: "s"}
+	data, _ := json.Marshal(sub)
+	kv.Put(ctx, webhookSubPrefix+sub.ID, data)
+
+	var tasks []func()
+	wp := NewWebhookPublisher(kv, nil).WithRetry(1, 0).WithTimeout(20 * time.Millisecond).
+		WithDispatch(func(task func()) { tasks = append(tasks, task) })
+	if err := wp.Publish(ctx, EventSubject(EventDeckRendered), []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("dispatched %d deliveries, want 1", len(tasks))
+	}
+	if index, _ := kv.Get(ctx, webhookIndexKey); index == nil {
+		t.Error("subscription index was not backfilled")
+	}
+
+	tasks[0]()
+	letters, _ := wp.DeadLetters(ctx, sub.ID)
+	if len(letters) != 1 || !strings.Contains(letters[0].Error, "deadline") {
+		t.Errorf("dead letters = %+v, want one timed-out delivery", letters)
+	}
+
+	if err := wp.Unregister(ctx, sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	tasks = nil
+	wp.Publish(ctx, EventSubject(EventDeckRendered), []byte(`{}`))
+	if len(tasks) != 0 {
+		t.Error("delivered to an unregistered subscription")
+	}
+}
@@ -0,0 +1,224 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is a token bucket: Burst requests at once, refilled at Limit per Period
+// A zero Limit means unlimited.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+	Burst  int // Defaults to Limit
+}
+
+// ParseRate parses "LIMIT/PERIOD" with an optional ",BURST", e.g. "30/1m,10"
+// "" and "0" parse to an unlimited rate.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+	spec, burst, hasBurst := strings.Cut(s, ",")
+	limit, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q is not LIMIT/PERIOD, e.g. 30/1m", s)
+	}
+	var r Rate
+	var err error
+	if r.Limit, err = strconv.Atoi(strings.TrimSpace(limit)); err != nil || r.Limit < 0 {
+		return Rate{}, fmt.Errorf("rate %q: limit must be a whole number", s)
+	}
+	if r.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil || r.Period <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: period must be a duration such as 1m", s)
+	}
+	if hasBurst {
+		if r.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || r.Burst < 0 {
+			return Rate{}, fmt.Errorf("rate %q: burst must be a whole number", s)
+		}
+	}
+	return r, nil
+}
+
+func (r Rate) String() string {
+	if r.Limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s,%d", r.Limit, r.Period, r.burst())
+}
+
+func (r Rate) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// RateDecision is the outcome of taking a token from a bucket
+type RateDecision struct {
+	Allowed    bool
+	Limit      int           // Bucket size
+	Remaining  int           // Whole tokens left
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next token, when refused
+}
+
+// RateLimiter takes tokens from token buckets named by key
+// On error the decision is still filled in when one was made, e.g. when only
+// storing the bucket failed.
+type RateLimiter interface {
+	Take(ctx context.Context, key string, rate Rate) (RateDecision, error)
+}
+
+// bucket is a token bucket's state
+type bucket struct {
+	Tokens  float64 `json:"tokens"`
+	Updated int64   `json:"updated"` // Unix nanoseconds
+}
+
+// take refills b to now and takes one token if there is one
+func (r Rate) take(b *bucket, now time.Time) RateDecision {
+	size := float64(r.burst())
+	perToken := r.Period / time.Duration(r.Limit)
+
+	if b.Updated == 0 {
+		b.Tokens = size
+	} else if elapsed := now.UnixNano() - b.Updated; elapsed > 0 {
+		b.Tokens = math.Min(size, b.Tokens+float64(elapsed)/float64(perToken))
+	}
+	b.Updated = now.UnixNano()
+
+	d := RateDecision{Limit: int(size)}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = time.Duration((1 - b.Tokens) * float64(perToken))
+	}
+	d.Remaining = int(b.Tokens)
+	d.Reset = time.Duration((size - b.Tokens) * float64(perToken))
+	return d
+}
+
+// MemoryRateLimiter keeps token buckets in process memory
+// Used by the native server, where one process sees every request.
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	resets  map[string]time.Time // When each bucket is full again and can be dropped
+	swept   time.Time
+}
+
+// NewMemoryRateLimiter creates an in-memory rate limiter
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: make(map[string]*bucket), resets: make(map[string]time.Time), swept: time.Now()}
+}
+
+// memorySweepInterval is how often full buckets are dropped
+const memorySweepInterval = time.Minute
+
+func (l *MemoryRateLimiter) Take(ctx context.Context, key string, rate Rate) (RateDecision, error) {
+	if rate.Limit == 0 {
+		return RateDecision{Allowed: true}, nil
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= memorySweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{}
+		l.buckets[key] = b
+	}
+	d := rate.take(b, now)
+	l.resets[key] = now.Add(d.Reset)
+	return d, nil
+}
+
+// sweep drops the buckets that are full by now; l.mu must be held
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	for k, full := range l.resets {
+		if now.After(full) {
+			delete(l.buckets, k)
+			delete(l.resets, k)
+		}
+	}
+	l.swept = now
+}
+
+// kvRateLimitPrefix is the KV prefix of token buckets stored by KVRateLimiter
+const kvRateLimitPrefix = "ratelimit:"
+
+// kvMinTTL is the shortest TTL Cloudflare KV accepts
+const kvMinTTL = time.Minute
+
+// KVRateLimiter keeps token buckets in a KV store, shared by every instance
+// Every allowed Take writes the bucket back, so each allowed request costs a KV
+// write; refused requests only read, as a bucket with no token left is
+// unchanged. With an AtomicKV, updates use compare-and-swap. Cloudflare KV has
+// none, so there the last write wins: overlapping requests read the same bucket
+// and spend one token between them, and eventual consistency lets requests in
+// different locations each see a token. The limit is approximate.
+type KVRateLimiter struct {
+	kv KVStore
+}
+
+// NewKVRateLimiter creates a rate limiter backed by kv
+func NewKVRateLimiter(kv KVStore) *KVRateLimiter {
+	return &KVRateLimiter{kv: kv}
+}
+
+// kvRateLimitAttempts bounds compare-and-swap retries under contention
+const kvRateLimitAttempts = 3
+
+func (l *KVRateLimiter) Take(ctx context.Context, key string, rate Rate) (RateDecision, error) {
+	if rate.Limit == 0 {
+		return RateDecision{Allowed: true}, nil
+	}
+	kvKey := kvRateLimitPrefix + key
+	atomic, isAtomic := l.kv.(AtomicKV)
+
+	for attempt := 1; ; attempt++ {
+		old, err := l.kv.Get(ctx, kvKey)
+		if err != nil {
+			return RateDecision{}, err
+		}
+		var b bucket
+		if old != nil {
+			if err := json.Unmarshal(old, &b); err != nil {
+				b = bucket{} // Start over rather than fail every request
+			}
+		}
+
+		d := rate.take(&b, time.Now())
+		if !d.Allowed {
+			return d, nil
+		}
+		value, _ := json.Marshal(b)
+		ttl := max(d.Reset, kvMinTTL)
+
+		if !isAtomic {
+			// Cloudflare refuses more than one write per key per second; the
+			// decision stands on the state read
+			return d, l.kv.PutWithTTL(ctx, kvKey, value, ttl)
+		}
+		swapped, err := atomic.CompareAndSwap(ctx, kvKey, old, value, ttl)
+		if err != nil {
+			return d, err
+		}
+		if swapped || attempt == kvRateLimitAttempts {
+			return d, nil
+		}
+	}
+}
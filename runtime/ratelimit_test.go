@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRate_Take(t *testing.T) {
+	rate := Rate{Limit: 60, Period: time.Minute, Burst: 2} // One token a second
+	now := time.Unix(1700000000, 0)
+	var b bucket
+
+	for i, want := range []bool{true, true, false} {
+		if d := rate.take(&b, now); d.Allowed != want {
+			t.Fatalf("take %d: allowed = %v, want %v", i, d.Allowed, want)
+		}
+	}
+	d := rate.take(&b, now)
+	if d.Limit != 2 || d.Remaining != 0 || d.RetryAfter != time.Second || d.Reset != 2*time.Second {
+		t.Errorf("refused decision = %+v", d)
+	}
+
+	if d := rate.take(&b, now.Add(time.Second)); !d.Allowed {
+		t.Error("no token after refill")
+	}
+	if d := rate.take(&b, now.Add(time.Hour)); !d.Allowed || d.Remaining != 1 {
+		t.Errorf("after an hour = %+v, want a full bucket of 2", d)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for in, want := range map[string]Rate{
+		"":           {},
+		"0":          {},
+		"30/1m":      {Limit: 30, Period: time.Minute},
+		"30/1m,10":   {Limit: 30, Period: time.Minute, Burst: 10},
+		" 5 / 1s ,1": {Limit: 5, Period: time.Second, Burst: 1},
+	} {
+		if got, err := ParseRate(in); err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"30", "x/1m", "30/x", "30/0s", "-1/1m", "30/1m,x"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) accepted", in)
+		}
+	}
+}
+
+func TestRateLimiters(t *testing.T) {
+	rate := Rate{Limit: 3, Period: time.Hour}
+	for name, limiter := range map[string]RateLimiter{
+		"memory":       NewMemoryRateLimiter(),
+		"kv":           NewKVRateLimiter(NewMemoryKV()),
+		"kv-no-atomic": NewKVRateLimiter(struct{ KVStore }{NewMemoryKV()}),
+	} {
+		ctx := context.Background()
+		for i := range 4 {
+			d, err := limiter.Take(ctx, "a", rate)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if d.Allowed != (i < 3) || d.Remaining != max(2-i, 0) {
+				t.Errorf("%s: take %d = %+v", name, i, d)
+			}
+		}
+		if d, _ := limiter.Take(ctx, "b", rate); !d.Allowed {
+			t.Errorf("%s: buckets are not separate per key", name)
+		}
+		if d, _ := limiter.Take(ctx, "a", Rate{}); !d.Allowed {
+			t.Errorf("%s: unlimited rate refused", name)
+		}
+	}
+}
+
+func TestMemoryRateLimiter_Sweep(t *testing.T) {
+	l := NewMemoryRateLimiter()
+	ctx := context.Background()
+	l.Take(ctx, "a", Rate{Limit: 60, Period: time.Minute, Burst: 1}) // Full again in a second
+	l.Take(ctx, "b", Rate{Limit: 1, Period: time.Hour})
+
+	// Within the interval nothing is swept
+	l.Take(ctx, "c", Rate{Limit: 1, Period: time.Hour})
+	if len(l.buckets) != 3 {
+		t.Fatalf("%d buckets before the sweep, want 3", len(l.buckets))
+	}
+	l.swept = time.Now().Add(-memorySweepInterval)
+	l.resets["a"] = time.Now().Add(-time.Second)
+	l.Take(ctx, "c", Rate{Limit: 1, Period: time.Hour})
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 2 {
+		t.Errorf("buckets after the sweep = %v, want b and c", l.buckets)
+	}
+}
+
+func TestKVRateLimiter_RefusalDoesNotWrite(t *testing.T) {
+	kv := NewMemoryKV()
+	l := NewKVRateLimiter(kv)
+	ctx := context.Background()
+	rate := Rate{Limit: 1, Period: time.Hour}
+	if d, _ := l.Take(ctx, "a", rate); !d.Allowed {
+		t.Fatal("first take refused")
+	}
+	before, _ := kv.Get(ctx, kvRateLimitPrefix+"a")
+	if d, _ := l.Take(ctx, "a", rate); d.Allowed {
+		t.Fatal("second take allowed")
+	}
+	if after, _ := kv.Get(ctx, kvRateLimitPrefix+"a"); string(after) != string(before) {
+		t.Errorf("refusal rewrote the bucket: %s -> %s", before, after)
+	}
+}
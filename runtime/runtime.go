@@ -3,7 +3,11 @@ package runtime
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
+
+	"github.com/joeblew999/deckfs/catalog"
 )
 
 // Storage abstracts file storage (R2, local filesystem, etc.)
@@ -24,14 +28,61 @@ type FilesystemStorage interface {
 // ListResult holds storage listing results
 type ListResult struct {
 	Keys              []string
+	Objects           []ObjectInfo // Metadata for Keys, in the same order, when the backend reports it
 	DelimitedPrefixes []string
 }
 
+// ObjectInfo describes a stored object without reading it
+type ObjectInfo struct {
+	Key      string
+	Size     int64
+	ETag     string // Changes whenever the content does; format is backend specific
+	Modified time.Time
+}
+
 // KVStore abstracts key-value storage
+// Get returns nil (and no error) for keys that don't exist or have expired
 type KVStore interface {
 	Get(ctx context.Context, key string) ([]byte, error)
 	Put(ctx context.Context, key string, value []byte) error
+	// PutWithTTL stores a value that expires after ttl (0 means never)
+	PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error
 	Delete(ctx context.Context, key string) error
+	// List returns one page of keys starting with prefix
+	// Pass the returned Cursor back in to fetch the next page
+	List(ctx context.Context, prefix string, cursor string) (*KVListResult, error)
+}
+
+// KVListResult holds one page of KV listing results
+type KVListResult struct {
+	Keys   []string
+	Cursor string // Empty when there are no more pages
+}
+
+// AtomicKV is optionally implemented by KV backends that support compare-and-swap
+// Cloudflare KV is eventually consistent and does not implement it
+type AtomicKV interface {
+	KVStore
+	// CompareAndSwap stores value only if the current value equals old
+	// A nil old means the key must not exist. Returns false if the swap lost.
+	CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error)
+}
+
+// ListAllKV collects every key with prefix, following cursors across pages
+func ListAllKV(ctx context.Context, kv KVStore, prefix string) ([]string, error) {
+	var keys []string
+	cursor := ""
+	for {
+		page, err := kv.List(ctx, prefix, cursor)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page.Keys...)
+		if page.Cursor == "" {
+			return keys, nil
+		}
+		cursor = page.Cursor
+	}
 }
 
 // Publisher abstracts event publishing (NATS, etc.)
@@ -43,8 +94,11 @@ type Publisher interface {
 type Runtime struct {
 	InputStorage  Storage
 	OutputStorage Storage
+	FontStorage   Storage // Font cache shared by renders (DECKFS_FONTS on Workers)
 	KV            KVStore
 	Publisher     Publisher
+	Webhooks      *WebhookPublisher // Also included in Publisher; kept for subscription admin
+	Catalog       catalog.Catalog   // Optional processing history (SQLite natively, D1 on Workers)
 }
 
 // Global runtime instance - set by platform-specific init
@@ -58,7 +112,7 @@ func SetRuntime(r *Runtime) {
 // Input returns the input storage
 func Input() Storage {
 	if Current == nil || Current.InputStorage == nil {
-		return &noopStorage{}
+		return &noopStorage{role: "input storage"}
 	}
 	return Current.InputStorage
 }
@@ -66,11 +120,19 @@ func Input() Storage {
 // Output returns the output storage
 func Output() Storage {
 	if Current == nil || Current.OutputStorage == nil {
-		return &noopStorage{}
+		return &noopStorage{role: "output storage"}
 	}
 	return Current.OutputStorage
 }
 
+// Fonts returns the font cache storage
+func Fonts() Storage {
+	if Current == nil || Current.FontStorage == nil {
+		return &noopStorage{role: "font storage"}
+	}
+	return Current.FontStorage
+}
+
 // KV returns the KV store
 func KV() KVStore {
 	if Current == nil || Current.KV == nil {
@@ -79,36 +141,94 @@ func KV() KVStore {
 	return Current.KV
 }
 
-// noopStorage is a no-op implementation for when storage isn't configured
-type noopStorage struct{}
+// Webhooks returns the webhook publisher, or nil if webhooks aren't configured
+func Webhooks() *WebhookPublisher {
+	if Current == nil {
+		return nil
+	}
+	return Current.Webhooks
+}
+
+// Catalog returns the processing catalog, or nil if it isn't configured
+func Catalog() catalog.Catalog {
+	if Current == nil {
+		return nil
+	}
+	return Current.Catalog
+}
+
+// ErrNotConfigured is returned by the storage and KV that Input, Output, Fonts
+// and KV fall back to when the runtime has no backend for that role
+var ErrNotConfigured = errors.New("not configured")
+
+// notConfiguredError names the missing role and matches ErrNotConfigured
+type notConfiguredError struct {
+	role string
+}
+
+func (e notConfiguredError) Error() string {
+	return e.role + " is not configured on this server"
+}
+
+func (e notConfiguredError) Is(target error) bool {
+	return target == ErrNotConfigured
+}
+
+// Configured reports whether s is a real backend rather than the fallback
+// Input, Output and Fonts return when none is set
+func Configured(s Storage) bool {
+	_, fallback := s.(*noopStorage)
+	return !fallback
+}
+
+// noopStorage stands in for storage that isn't configured
+// Every call fails with ErrNotConfigured, so writes can't appear to succeed.
+type noopStorage struct {
+	role string
+}
+
+func (s *noopStorage) err() error {
+	return notConfiguredError{role: s.role}
+}
 
 func (s *noopStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
-	return nil, io.EOF
+	return nil, s.err()
 }
 
 func (s *noopStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
-	return nil
+	return s.err()
 }
 
 func (s *noopStorage) List(ctx context.Context, prefix string, delimiter string) (*ListResult, error) {
-	return &ListResult{}, nil
+	return nil, s.err()
 }
 
 func (s *noopStorage) Delete(ctx context.Context, key string) error {
-	return nil
+	return s.err()
 }
 
-// noopKV is a no-op implementation for when KV isn't configured
+// noopKV stands in for a KV store that isn't configured
+// Every call fails with ErrNotConfigured.
 type noopKV struct{}
 
+var errKVNotConfigured = notConfiguredError{role: "KV"}
+
 func (k *noopKV) Get(ctx context.Context, key string) ([]byte, error) {
-	return nil, nil
+	return nil, errKVNotConfigured
 }
 
 func (k *noopKV) Put(ctx context.Context, key string, value []byte) error {
-	return nil
+	return errKVNotConfigured
+}
+
+func (k *noopKV) PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return errKVNotConfigured
 }
 
 func (k *noopKV) Delete(ctx context.Context, key string) error {
-	return nil
+	return errKVNotConfigured
+}
+
+func (k *noopKV) List(ctx context.Context, prefix string, cursor string) (*KVListResult, error) {
+	return nil, errKVNotConfigured
 }
@@ -69,6 +69,12 @@ func (s *R2Storage) List(ctx context.Context, prefix string, delimiter string) (
 		// Filter by prefix if specified
 		if prefix == "" || len(obj.Key) >= len(prefix) && obj.Key[:len(prefix)] == prefix {
 			lr.Keys = append(lr.Keys, obj.Key)
+			lr.Objects = append(lr.Objects, ObjectInfo{
+				Key:      obj.Key,
+				Size:     int64(obj.Size),
+				ETag:     obj.ETag,
+				Modified: obj.Uploaded,
+			})
 		}
 	}
 	return lr, nil
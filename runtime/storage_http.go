@@ -5,11 +5,17 @@ package runtime
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 )
 
 // R2HTTPStorage implements Storage using R2's S3-compatible HTTP API
@@ -42,7 +48,7 @@ func NewR2HTTPStorage(cfg R2HTTPConfig) *R2HTTPStorage {
 }
 
 func (s *R2HTTPStorage) url(key string) string {
-	return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucketName, key)
+	return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucketName, awsEscape(key, false))
 }
 
 func (s *R2HTTPStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
@@ -51,7 +57,7 @@ func (s *R2HTTPStorage) Get(ctx context.Context, key string) (io.ReadCloser, err
 		return nil, err
 	}
 
-	s.signRequest(req)
+	s.signRequest(req, nil)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -82,7 +88,7 @@ func (s *R2HTTPStorage) Put(ctx context.Context, key string, data []byte, conten
 	}
 	req.ContentLength = int64(len(data))
 
-	s.signRequest(req)
+	s.signRequest(req, data)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -98,20 +104,20 @@ func (s *R2HTTPStorage) Put(ctx context.Context, key string, data []byte, conten
 }
 
 func (s *R2HTTPStorage) List(ctx context.Context, prefix string, delimiter string) (*ListResult, error) {
-	url := fmt.Sprintf("%s/%s?list-type=2", s.endpoint, s.bucketName)
+	query := url.Values{"list-type": {"2"}}
 	if prefix != "" {
-		url += "&prefix=" + prefix
+		query.Set("prefix", prefix)
 	}
 	if delimiter != "" {
-		url += "&delimiter=" + delimiter
+		query.Set("delimiter", delimiter)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/%s?%s", s.endpoint, s.bucketName, canonicalQuery(query)), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	s.signRequest(req)
+	s.signRequest(req, nil)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -126,7 +132,10 @@ func (s *R2HTTPStorage) List(ctx context.Context, prefix string, delimiter strin
 	// Parse S3 ListObjectsV2 response
 	var listResp struct {
 		Contents []struct {
-			Key string `xml:"Key"`
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			ETag         string    `xml:"ETag"`
+			LastModified time.Time `xml:"LastModified"`
 		} `xml:"Contents"`
 		CommonPrefixes []struct {
 			Prefix string `xml:"Prefix"`
@@ -139,11 +148,18 @@ func (s *R2HTTPStorage) List(ctx context.Context, prefix string, delimiter strin
 
 	result := &ListResult{
 		Keys:              make([]string, len(listResp.Contents)),
+		Objects:           make([]ObjectInfo, len(listResp.Contents)),
 		DelimitedPrefixes: make([]string, len(listResp.CommonPrefixes)),
 	}
 
 	for i, c := range listResp.Contents {
 		result.Keys[i] = c.Key
+		result.Objects[i] = ObjectInfo{
+			Key:      c.Key,
+			Size:     c.Size,
+			ETag:     strings.Trim(c.ETag, `"`),
+			Modified: c.LastModified,
+		}
 	}
 	for i, p := range listResp.CommonPrefixes {
 		result.DelimitedPrefixes[i] = p.Prefix
@@ -158,7 +174,7 @@ func (s *R2HTTPStorage) Delete(ctx context.Context, key string) error {
 		return err
 	}
 
-	s.signRequest(req)
+	s.signRequest(req, nil)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -173,16 +189,116 @@ func (s *R2HTTPStorage) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
-// signRequest adds AWS Signature V4 authentication
-// Simplified version - for production use github.com/aws/aws-sdk-go-v2
-func (s *R2HTTPStorage) signRequest(req *http.Request) {
-	// For now, if credentials are provided, use basic auth header approach
-	// In production, implement proper AWS Sig V4 or use presigned URLs
+// r2Region is the region R2 expects in request signatures
+const r2Region = "auto"
+
+// signRequest signs req for R2, which accepts only AWS Signature Version 4
+// payload is the request body. Without credentials requests go out unsigned.
+func (s *R2HTTPStorage) signRequest(req *http.Request, payload []byte) {
 	if s.accessKeyID != "" && s.secretKey != "" {
-		// R2 also supports Authorization header with access key
-		// This is a simplified approach - real implementation needs AWS Sig V4
-		req.SetBasicAuth(s.accessKeyID, s.secretKey)
+		signV4(req, payload, s.accessKeyID, s.secretKey, r2Region, time.Now())
+	}
+}
+
+// signV4 adds the x-amz-date, x-amz-content-sha256 and Authorization headers of
+// an S3 Signature Version 4, signing the host and every header set so far
+// The query is rewritten in canonical form so the request matches what was signed.
+func signV4(req *http.Request, payload []byte, accessKeyID, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	req.URL.RawQuery = canonicalQuery(req.URL.Query())
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		accessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// canonicalQuery encodes query sorted by name and value, as SigV4 signs it
+func canonicalQuery(query url.Values) string {
+	pairs := make([][2]string, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, [2]string{awsEscape(name, true), awsEscape(v, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters, and "/" too
+// when encodeSlash is set
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
 	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
 }
 
 // PublicR2Storage accesses public R2 buckets (no auth required)
@@ -4,6 +4,7 @@ package runtime
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -152,8 +153,9 @@ func (s *LocalFileStorage) List(ctx context.Context, prefix string, delimiter st
 					prefixesMap[dirPrefix] = true
 					result.DelimitedPrefixes = append(result.DelimitedPrefixes, dirPrefix)
 				}
-			} else {
+			} else if info, err := entry.Info(); err == nil {
 				result.Keys = append(result.Keys, relPath)
+				result.Objects = append(result.Objects, localObjectInfo(relPath, info))
 			}
 		}
 
@@ -183,7 +185,12 @@ func (s *LocalFileStorage) List(ctx context.Context, prefix string, delimiter st
 			return nil
 		}
 
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed while walking
+		}
 		result.Keys = append(result.Keys, relPath)
+		result.Objects = append(result.Objects, localObjectInfo(relPath, info))
 		return nil
 	})
 
@@ -194,6 +201,16 @@ func (s *LocalFileStorage) List(ctx context.Context, prefix string, delimiter st
 	return result, nil
 }
 
+// localObjectInfo derives an ETag from modification time and size, like a weak HTTP ETag
+func localObjectInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:      key,
+		Size:     info.Size(),
+		ETag:     fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		Modified: info.ModTime(),
+	}
+}
+
 func (s *LocalFileStorage) Delete(ctx context.Context, key string) error {
 	path, err := s.fullPath(key)
 	if err != nil {
@@ -204,6 +221,15 @@ func (s *LocalFileStorage) Delete(ctx context.Context, key string) error {
 	if err != nil && os.IsNotExist(err) {
 		return nil // Deletion of non-existent file is success
 	}
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Remove now-empty parent directories so prefixes disappear like in object stores
+	for dir := filepath.Dir(path); dir != s.baseDir && strings.HasPrefix(dir, s.baseDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
 }
@@ -0,0 +1,96 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage implements Storage in process memory
+// Used for tests and throwaway servers; everything is lost on restart.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// NewMemoryStorage creates empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject)}
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (s *MemoryStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{
+		data: append([]byte(nil), data...),
+		info: ObjectInfo{
+			Key:      key,
+			Size:     int64(len(data)),
+			ETag:     fmt.Sprintf("%x", sha256.Sum256(data)),
+			Modified: time.Now(),
+		},
+	}
+	return nil
+}
+
+// List returns keys with prefix in order; with a delimiter, keys below the next
+// delimiter are rolled up into DelimitedPrefixes as object stores do
+func (s *MemoryStorage) List(ctx context.Context, prefix string, delimiter string) (*ListResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := &ListResult{Keys: make([]string, 0), DelimitedPrefixes: make([]string, 0)}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				p := key[:len(prefix)+i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					result.DelimitedPrefixes = append(result.DelimitedPrefixes, p)
+				}
+				continue
+			}
+		}
+		result.Keys = append(result.Keys, key)
+		result.Objects = append(result.Objects, s.objects[key].info)
+	}
+	return result, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}